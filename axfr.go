@@ -0,0 +1,71 @@
+package cli53
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// axfrAddress adds the default DNS port to a server address if it has none.
+func axfrAddress(server string) string {
+	if _, _, err := net.SplitHostPort(server); err == nil {
+		return server
+	}
+	return net.JoinHostPort(strings.Trim(server, "[]"), "53")
+}
+
+// axfrSkipped reports whether a record type cannot be imported: DNSSEC
+// records are generated by the zone's signer, and route53 signs zones
+// itself.
+func axfrSkipped(rrtype uint16) bool {
+	switch rrtype {
+	case dns.TypeRRSIG, dns.TypeNSEC, dns.TypeNSEC3, dns.TypeNSEC3PARAM, dns.TypeDNSKEY, dns.TypeCDS, dns.TypeCDNSKEY, dns.TypeZONEMD:
+		return true
+	}
+	return false
+}
+
+// transferZone fetches the records of a zone from a server by AXFR. The
+// records are returned as parsed from a BIND file: the SOA that closes the
+// transfer is dropped, and DNSSEC records are skipped with a warning.
+func transferZone(server, zone string) ([]dns.RR, error) {
+	m := &dns.Msg{}
+	m.SetAxfr(dns.Fqdn(zone))
+	t := &dns.Transfer{}
+	envelopes, err := t.In(m, axfrAddress(server))
+	if err != nil {
+		return nil, fmt.Errorf("AXFR of %s from %s failed: %s", zone, server, err)
+	}
+	records := []dns.RR{}
+	soas := 0
+	skipped := map[string]int{}
+	for envelope := range envelopes {
+		if envelope.Error != nil {
+			return nil, fmt.Errorf("AXFR of %s from %s failed: %s", zone, server, envelope.Error)
+		}
+		for _, rr := range envelope.RR {
+			rrtype := rr.Header().Rrtype
+			if rrtype == dns.TypeSOA {
+				soas++
+				if soas > 1 {
+					continue
+				}
+			}
+			if axfrSkipped(rrtype) {
+				skipped[dns.TypeToString[rrtype]]++
+				continue
+			}
+			records = append(records, rr)
+		}
+	}
+	if soas == 0 {
+		return nil, fmt.Errorf("AXFR of %s from %s returned no SOA record", zone, server)
+	}
+	for rtype, count := range skipped {
+		fmt.Fprintf(os.Stderr, "Warning: Skipping %d %s records\n", count, rtype)
+	}
+	return records, nil
+}
@@ -0,0 +1,121 @@
+package cli53
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startAXFRServer serves a zone by AXFR on a local port, returning its
+// address.
+func startAXFRServer(t *testing.T, zone string, records []string) string {
+	rrs := []dns.RR{}
+	for _, s := range records {
+		rr, err := dns.NewRR(s)
+		require.NoError(t, err)
+		rrs = append(rrs, rr)
+	}
+	mux := dns.NewServeMux()
+	mux.HandleFunc(zone, func(w dns.ResponseWriter, req *dns.Msg) {
+		m := &dns.Msg{}
+		m.SetReply(req)
+		if req.Question[0].Qtype != dns.TypeAXFR {
+			m.Rcode = dns.RcodeRefused
+		} else {
+			m.Answer = append(rrs, rrs[0])
+		}
+		w.WriteMsg(m)
+	})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := &dns.Server{Listener: l, Handler: mux}
+	go server.ActivateAndServe()
+	t.Cleanup(func() { server.Shutdown() })
+	return l.Addr().String()
+}
+
+func TestAXFRAddress(t *testing.T) {
+	assert.Equal(t, "ns1.example.com:53", axfrAddress("ns1.example.com"))
+	assert.Equal(t, "192.0.2.1:5353", axfrAddress("192.0.2.1:5353"))
+	assert.Equal(t, "[2001:db8::1]:53", axfrAddress("2001:db8::1"))
+	assert.Equal(t, "[2001:db8::1]:53", axfrAddress("[2001:db8::1]"))
+}
+
+func TestTransferZone(t *testing.T) {
+	addr := startAXFRServer(t, "example.com.", []string{
+		"example.com. 3600 IN SOA ns1.example.com. hostmaster.example.com. 1 7200 900 1209600 86400",
+		"example.com. 3600 IN NS ns1.example.com.",
+		"www.example.com. 300 IN A 192.0.2.1",
+		"www.example.com. 300 IN RRSIG A 8 3 300 20300101000000 20200101000000 12345 example.com. AAAA",
+		"sub.example.com. 3600 IN NS ns1.sub.example.com.",
+	})
+	records, err := transferZone(addr, "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"example.com. 3600 IN SOA ns1.example.com. hostmaster.example.com. 1 7200 900 1209600 86400",
+		"example.com. 3600 IN NS ns1.example.com.",
+		"www.example.com. 300 IN A 192.0.2.1",
+		"sub.example.com. 3600 IN NS ns1.sub.example.com.",
+	}, recordStrings(records))
+
+	// the apex SOA and NS records are left alone without --editauth
+	additions, deletions := importChanges(testZone, records, nil, importArgs{})
+	names := []string{}
+	for _, change := range additions {
+		names = append(names, string(change.ResourceRecordSet.Type)+" "+*change.ResourceRecordSet.Name)
+	}
+	sort.Strings(names)
+	assert.Equal(t, []string{"A www.example.com.", "NS sub.example.com."}, names)
+	assert.Empty(t, deletions)
+}
+
+func TestTransferZoneRefused(t *testing.T) {
+	addr := startAXFRServer(t, "example.com.", []string{
+		"example.com. 3600 IN SOA ns1.example.com. hostmaster.example.com. 1 7200 900 1209600 86400",
+	})
+	_, err := transferZone(addr, "other.com")
+	assert.Error(t, err)
+}
+
+func TestImportAXFRCommand(t *testing.T) {
+	addr := startAXFRServer(t, "example.com.", []string{
+		"example.com. 3600 IN SOA ns1.example.com. hostmaster.example.com. 1 7200 900 1209600 86400",
+		"www.example.com. 300 IN A 192.0.2.1",
+	})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/2013-04-01/hostedzone/Z1RWMUCMCPKCJX" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, `<GetHostedZoneResponse><HostedZone><Id>/hostedzone/Z1RWMUCMCPKCJX</Id><Name>example.com.</Name><CallerReference>test</CallerReference></HostedZone></GetHostedZoneResponse>`)
+	}))
+	defer srv.Close()
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	os.Stdout = w
+	code := Main([]string{"cli53", "import", "--endpoint-url", srv.URL, "--axfr", addr, "--dry-run", "Z1RWMUCMCPKCJX"})
+	os.Stdout = stdout
+	w.Close()
+	out, err := io.ReadAll(r)
+	require.NoError(t, err)
+
+	assert.Equal(t, 0, code)
+	assert.Contains(t, string(out), "Dry-run, changes that would be made:\n+ www.example.com.\t300\tIN\tA\t192.0.2.1\n")
+}
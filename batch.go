@@ -0,0 +1,328 @@
+package cli53
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	route53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+// Limits on a single change batch: the number of changes, and the route53
+// limits on the number of resource records and characters in values.
+const (
+	ChangeBatchSize  = 100
+	BatchRecordLimit = 1000
+	BatchValueLimit  = 32000
+)
+
+// changeGroup holds all the changes to a single record set. A group is
+// always submitted in one batch, so a record set being replaced is never
+// missing between batches.
+type changeGroup struct {
+	id      rrsetIdentity
+	changes []route53types.Change
+	// number of aliases in this change set the record set depends on
+	depth int
+}
+
+func (g *changeGroup) deleteOnly() bool {
+	for _, change := range g.changes {
+		if change.Action != route53types.ChangeActionDelete {
+			return false
+		}
+	}
+	return true
+}
+
+// the record set as it will be after the changes (or before, if deleted)
+func (g *changeGroup) rrset() *route53types.ResourceRecordSet {
+	return g.changes[len(g.changes)-1].ResourceRecordSet
+}
+
+// aliasDepths sets the depth of each group: 0 for plain records, 1 for
+// aliases, and one more for each alias in the change set an alias targets.
+func aliasDepths(groups []*changeGroup, zone *route53types.HostedZone) {
+	zoneId := strings.Replace(*zone.Id, "/hostedzone/", "", 1)
+	aliases := map[string][]*changeGroup{}
+	for _, g := range groups {
+		if g.rrset().AliasTarget != nil {
+			aliases[g.id.Name] = append(aliases[g.id.Name], g)
+		}
+	}
+
+	visiting := map[*changeGroup]bool{}
+	var depth func(g *changeGroup) int
+	depth = func(g *changeGroup) int {
+		alias := g.rrset().AliasTarget
+		if alias == nil {
+			return 0
+		}
+		if g.depth > 0 {
+			return g.depth
+		}
+		d := 1
+		if !visiting[g] && aws.ToString(alias.HostedZoneId) == zoneId {
+			visiting[g] = true
+			target := strings.ToLower(absolute(aws.ToString(alias.DNSName)))
+			for _, t := range aliases[target] {
+				if t != g && depth(t)+1 > d {
+					d = depth(t) + 1
+				}
+			}
+			visiting[g] = false
+		}
+		g.depth = d
+		return d
+	}
+	for _, g := range groups {
+		depth(g)
+	}
+}
+
+// groupChanges groups changes by record set and orders the groups so that
+// deletions come first (aliases before their targets), followed by the
+// remaining changes with alias targets before the aliases pointing at them.
+func groupChanges(additions, deletions []route53types.Change, zone *route53types.HostedZone) []*changeGroup {
+	groups := []*changeGroup{}
+	byId := map[rrsetIdentity]*changeGroup{}
+	for _, change := range append(append([]route53types.Change{}, deletions...), additions...) {
+		id := identityOf(change.ResourceRecordSet)
+		g, ok := byId[id]
+		if !ok {
+			g = &changeGroup{id: id}
+			byId[id] = g
+			groups = append(groups, g)
+		}
+		g.changes = append(g.changes, change)
+	}
+	aliasDepths(groups, zone)
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		a, b := groups[i], groups[j]
+		if a.deleteOnly() != b.deleteOnly() {
+			return a.deleteOnly()
+		}
+		if a.depth != b.depth {
+			if a.deleteOnly() {
+				return a.depth > b.depth
+			}
+			return a.depth < b.depth
+		}
+		return a.id.String() < b.id.String()
+	})
+	return groups
+}
+
+// batchSize is the size of a batch as counted against the route53 limits.
+type batchSize struct {
+	changes int
+	records int
+	chars   int
+}
+
+// changeSize returns the size of a change. UPSERTs count double towards the
+// record and value limits, as they do in route53.
+func changeSize(change route53types.Change) batchSize {
+	size := batchSize{changes: 1}
+	for _, rr := range change.ResourceRecordSet.ResourceRecords {
+		size.records++
+		size.chars += len(aws.ToString(rr.Value))
+	}
+	if change.Action == route53types.ChangeActionUpsert {
+		size.records *= 2
+		size.chars *= 2
+	}
+	return size
+}
+
+func (s batchSize) add(o batchSize) batchSize {
+	return batchSize{s.changes + o.changes, s.records + o.records, s.chars + o.chars}
+}
+
+func (s batchSize) fits() bool {
+	return s.changes <= ChangeBatchSize && s.records <= BatchRecordLimit && s.chars <= BatchValueLimit
+}
+
+// planBatches splits changes into batches for submission, never splitting
+// the changes to a record set across batches. It is an error if the changes
+// to a single record set cannot fit in a batch.
+func planBatches(additions, deletions []route53types.Change, zone *route53types.HostedZone) ([][]route53types.Change, error) {
+	batches := [][]route53types.Change{}
+	var batch []route53types.Change
+	var size batchSize
+	for _, g := range groupChanges(additions, deletions, zone) {
+		var gsize batchSize
+		for _, change := range g.changes {
+			gsize = gsize.add(changeSize(change))
+		}
+		if !gsize.fits() {
+			return nil, fmt.Errorf("Changes to record '%s' are too large for a single batch (%d records / %d characters, limits are %d / %d)", g.id, gsize.records, gsize.chars, BatchRecordLimit, BatchValueLimit)
+		}
+		if len(batch) > 0 && !size.add(gsize).fits() {
+			batches = append(batches, batch)
+			batch = nil
+			size = batchSize{}
+		}
+		batch = append(batch, g.changes...)
+		size = size.add(gsize)
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return batches, nil
+}
+
+// inverseChanges returns the changes that undo a batch. before holds the
+// record sets as they were prior to any UPSERTs.
+func inverseChanges(batch []route53types.Change, before map[rrsetIdentity]*route53types.ResourceRecordSet) []route53types.Change {
+	inverse := []route53types.Change{}
+	for i := len(batch) - 1; i >= 0; i-- {
+		change := batch[i]
+		switch change.Action {
+		case route53types.ChangeActionCreate:
+			inverse = append(inverse, route53types.Change{
+				Action:            route53types.ChangeActionDelete,
+				ResourceRecordSet: change.ResourceRecordSet,
+			})
+		case route53types.ChangeActionDelete:
+			inverse = append(inverse, route53types.Change{
+				Action:            route53types.ChangeActionCreate,
+				ResourceRecordSet: change.ResourceRecordSet,
+			})
+		case route53types.ChangeActionUpsert:
+			if previous, ok := before[identityOf(change.ResourceRecordSet)]; ok {
+				inverse = append(inverse, route53types.Change{
+					Action:            route53types.ChangeActionUpsert,
+					ResourceRecordSet: previous,
+				})
+			} else {
+				inverse = append(inverse, route53types.Change{
+					Action:            route53types.ChangeActionDelete,
+					ResourceRecordSet: change.ResourceRecordSet,
+				})
+			}
+		}
+	}
+	return inverse
+}
+
+func hasUpserts(changes []route53types.Change) bool {
+	for _, change := range changes {
+		if change.Action == route53types.ChangeActionUpsert {
+			return true
+		}
+	}
+	return false
+}
+
+func submitBatch(ctx context.Context, zone *route53types.HostedZone, changes []route53types.Change) (*route53.ChangeResourceRecordSetsOutput, error) {
+	req := route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: zone.Id,
+		ChangeBatch: &route53types.ChangeBatch{
+			Changes: changes,
+		},
+	}
+	return r53.ChangeResourceRecordSets(ctx, &req)
+}
+
+// rollbackBatches undoes batches that have been applied, most recent first,
+// returning the number of batches still applied.
+func rollbackBatches(ctx context.Context, zone *route53types.HostedZone, batches [][]route53types.Change, before map[rrsetIdentity]*route53types.ResourceRecordSet) (int, error) {
+	for i := len(batches) - 1; i >= 0; i-- {
+		_, err := submitBatch(ctx, zone, inverseChanges(batches[i], before))
+		if err != nil {
+			return i + 1, fmt.Errorf("Rollback of batch %d failed: %s - the zone has been partially updated", i+1, err)
+		}
+		fmt.Printf("Rolled back batch %d\n", i+1)
+	}
+	return 0, nil
+}
+
+// batchChanges submits changes in batches within the route53 limits,
+// returning the change info for every batch, and exits if they could not all
+// be applied.
+func batchChanges(ctx context.Context, additions, deletions []route53types.Change, zone *route53types.HostedZone, rollback bool) []*route53types.ChangeInfo {
+	infos, err := submitChanges(ctx, additions, deletions, zone, rollback)
+	fatalIfErr(err)
+	return infos
+}
+
+// submitChanges submits changes in batches within the route53 limits,
+// returning the change info for every batch. If a batch fails the batches
+// already applied are reported, and if rollback is set they are undone. The
+// changes and the affected record sets are saved to the journal before they
+// are submitted, and updated with what was applied, and what was submitted is
+// appended to the history.
+func submitChanges(ctx context.Context, additions, deletions []route53types.Change, zone *route53types.HostedZone, rollback bool) ([]*route53types.ChangeInfo, error) {
+	batches, err := planBatches(additions, deletions, zone)
+	if err != nil {
+		return nil, err
+	}
+
+	var before map[rrsetIdentity]*route53types.ResourceRecordSet
+	if hasUpserts(additions) {
+		rrsets, err := ListAllRecordSets(ctx, r53, *zone.Id)
+		if err != nil {
+			return nil, err
+		}
+		before = map[rrsetIdentity]*route53types.ResourceRecordSet{}
+		for _, rrset := range rrsets {
+			before[identityOf(rrset)] = rrset
+		}
+	}
+
+	entry := newJournalEntry(zone, additions, deletions, before)
+	if len(batches) > 0 {
+		saveJournalEntry(entry)
+	}
+
+	record := newHistoryRecord(entry)
+	infos := []*route53types.ChangeInfo{}
+	for i, batch := range batches {
+		resp, err := submitBatch(ctx, zone, batch)
+		if err != nil {
+			fmt.Printf("Batch %d of %d failed: %s\n", i+1, len(batches), err)
+			record.Error = fmt.Sprintf("batch %d of %d failed: %s", i+1, len(batches), err)
+			if i == 0 {
+				removeJournalEntry(entry)
+				appendHistory(record)
+				return nil, errors.New("No changes were made")
+			}
+			fmt.Printf("Batches 1-%d of %d were applied\n", i, len(batches))
+			if rollback {
+				applied, err := rollbackBatches(ctx, zone, batches[:i], before)
+				record.RolledBack = err == nil
+				appendHistory(record)
+				if err != nil {
+					saveJournalEntry(entry.applied(zone, batches[:applied], before))
+					return nil, err
+				}
+				removeJournalEntry(entry)
+				return nil, errors.New("Changes were rolled back")
+			}
+			saveJournalEntry(entry.applied(zone, batches[:i], before))
+			appendHistory(record)
+			return infos, errors.New("The zone has been partially updated")
+		}
+		if len(batches) > 1 {
+			fmt.Printf("Batch %d of %d applied: %s (%d changes)\n", i+1, len(batches), *resp.ChangeInfo.Id, len(batch))
+		}
+		infos = append(infos, resp.ChangeInfo)
+		entry.ChangeIds = append(entry.ChangeIds, *resp.ChangeInfo.Id)
+		saveJournalEntry(entry)
+		record.Batches = append(record.Batches, historyBatch{
+			ChangeId: *resp.ChangeInfo.Id,
+			Status:   resp.ChangeInfo.Status,
+			Changes:  batch,
+		})
+	}
+	if len(batches) > 0 {
+		appendHistory(record)
+	}
+	return infos, nil
+}
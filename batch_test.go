@@ -0,0 +1,249 @@
+package cli53
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	route53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testAlias(name, target string) *route53types.ResourceRecordSet {
+	return &route53types.ResourceRecordSet{
+		Name: aws.String(name),
+		Type: route53types.RRTypeA,
+		AliasTarget: &route53types.AliasTarget{
+			DNSName:      aws.String(target),
+			HostedZoneId: aws.String("Z1RWMUCMCPKCJX"),
+		},
+	}
+}
+
+func change(action route53types.ChangeAction, rrset *route53types.ResourceRecordSet) route53types.Change {
+	return route53types.Change{Action: action, ResourceRecordSet: rrset}
+}
+
+func TestPlanBatchesKeepsReplacementsTogether(t *testing.T) {
+	additions := []route53types.Change{}
+	deletions := []route53types.Change{}
+	for i := 0; i < 60; i++ {
+		name := fmt.Sprintf("r%02d.example.com.", i)
+		deletions = append(deletions, change(route53types.ChangeActionDelete, testRRSet(name, route53types.RRTypeA, "127.0.0.1")))
+		additions = append(additions, change(route53types.ChangeActionCreate, testRRSet(name, route53types.RRTypeA, "127.0.0.2")))
+	}
+	batches, err := planBatches(additions, deletions, testZone)
+	require.NoError(t, err)
+	require.Len(t, batches, 2)
+	assert.Len(t, batches[0], 100)
+	assert.Len(t, batches[1], 20)
+	for _, batch := range batches {
+		for i := 0; i < len(batch); i += 2 {
+			assert.Equal(t, route53types.ChangeActionDelete, batch[i].Action)
+			assert.Equal(t, route53types.ChangeActionCreate, batch[i+1].Action)
+			assert.Equal(t, *batch[i].ResourceRecordSet.Name, *batch[i+1].ResourceRecordSet.Name)
+		}
+	}
+}
+
+func TestPlanBatchesOrdersAliases(t *testing.T) {
+	additions := []route53types.Change{
+		change(route53types.ChangeActionCreate, testAlias("a.example.com.", "b.example.com.")),
+		change(route53types.ChangeActionCreate, testAlias("b.example.com.", "c.example.com.")),
+		change(route53types.ChangeActionCreate, testRRSet("c.example.com.", route53types.RRTypeA, "127.0.0.1")),
+	}
+	deletions := []route53types.Change{
+		change(route53types.ChangeActionDelete, testRRSet("d.example.com.", route53types.RRTypeA, "127.0.0.1")),
+		change(route53types.ChangeActionDelete, testAlias("e.example.com.", "d.example.com.")),
+	}
+	batches, err := planBatches(additions, deletions, testZone)
+	require.NoError(t, err)
+	require.Len(t, batches, 1)
+	var names []string
+	for _, c := range batches[0] {
+		names = append(names, *c.ResourceRecordSet.Name)
+	}
+	assert.Equal(t, []string{"e.example.com.", "d.example.com.", "c.example.com.", "b.example.com.", "a.example.com."}, names)
+}
+
+func TestInverseChanges(t *testing.T) {
+	old := testRRSet("a.example.com.", route53types.RRTypeA, "127.0.0.1")
+	updated := testRRSet("a.example.com.", route53types.RRTypeA, "127.0.0.2")
+	upserted := testRRSet("b.example.com.", route53types.RRTypeA, "127.0.0.3")
+	previous := testRRSet("b.example.com.", route53types.RRTypeA, "127.0.0.4")
+	created := testRRSet("c.example.com.", route53types.RRTypeA, "127.0.0.5")
+	batch := []route53types.Change{
+		change(route53types.ChangeActionDelete, old),
+		change(route53types.ChangeActionCreate, updated),
+		change(route53types.ChangeActionUpsert, upserted),
+		change(route53types.ChangeActionUpsert, created),
+	}
+	before := map[rrsetIdentity]*route53types.ResourceRecordSet{identityOf(previous): previous}
+	assert.Equal(t, []route53types.Change{
+		change(route53types.ChangeActionDelete, created),
+		change(route53types.ChangeActionUpsert, previous),
+		change(route53types.ChangeActionDelete, updated),
+		change(route53types.ChangeActionCreate, old),
+	}, inverseChanges(batch, before))
+}
+
+func TestPlanBatchesValueLimit(t *testing.T) {
+	// 9 record sets of 4 x 1000 characters - 8 fit within 32000 characters
+	value := strings.Repeat("x", 1000)
+	additions := []route53types.Change{}
+	for i := 0; i < 9; i++ {
+		name := fmt.Sprintf("r%d.example.com.", i)
+		additions = append(additions, change(route53types.ChangeActionCreate, testRRSet(name, route53types.RRTypeTxt, value, value, value, value)))
+	}
+	batches, err := planBatches(additions, nil, testZone)
+	require.NoError(t, err)
+	assert.Len(t, batches, 2)
+
+	// upserts count double
+	for i := range additions {
+		additions[i].Action = route53types.ChangeActionUpsert
+	}
+	batches, err = planBatches(additions, nil, testZone)
+	require.NoError(t, err)
+	assert.Len(t, batches, 3)
+}
+
+func TestPlanBatchesRecordLimit(t *testing.T) {
+	values := []string{}
+	for i := 0; i < 600; i++ {
+		values = append(values, fmt.Sprintf("10.0.%d.%d", i/256, i%256))
+	}
+	additions := []route53types.Change{
+		change(route53types.ChangeActionCreate, testRRSet("a.example.com.", route53types.RRTypeA, values...)),
+		change(route53types.ChangeActionCreate, testRRSet("b.example.com.", route53types.RRTypeA, values...)),
+	}
+	batches, err := planBatches(additions, nil, testZone)
+	require.NoError(t, err)
+	assert.Len(t, batches, 2)
+
+	additions[0].Action = route53types.ChangeActionUpsert
+	_, err = planBatches(additions, nil, testZone)
+	assert.EqualError(t, err, "Changes to record 'a.example.com. A' are too large for a single batch (1200 records / 11364 characters, limits are 1000 / 32000)")
+}
+
+// testRoute53 points the route53 client at a fake endpoint, which fails the
+// requests numbered in fail and answers the rest as ChangeResourceRecordSets.
+func testRoute53(t *testing.T, fail ...int) {
+	testRoute53Func(t, func(request int) bool {
+		for _, n := range fail {
+			if n == request {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// testRoute53Func is testRoute53 with a function called for each request,
+// which returns whether it succeeds.
+func testRoute53Func(t *testing.T, succeed func(request int) bool) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if !succeed(requests) {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `<ErrorResponse><Error><Type>Sender</Type><Code>InvalidChangeBatch</Code><Message>bad batch</Message></Error></ErrorResponse>`)
+			return
+		}
+		fmt.Fprintf(w, `<ChangeResourceRecordSetsResponse><ChangeInfo><Id>/change/C%d</Id><Status>PENDING</Status></ChangeInfo></ChangeResourceRecordSetsResponse>`, requests)
+	}))
+	t.Cleanup(srv.Close)
+	saved := r53
+	r53 = route53.New(route53.Options{
+		Region:           "us-east-1",
+		BaseEndpoint:     aws.String(srv.URL),
+		Credentials:      aws.AnonymousCredentials{},
+		RetryMaxAttempts: 1,
+	})
+	t.Cleanup(func() { r53 = saved })
+}
+
+func TestSubmitChangesFirstBatchFails(t *testing.T) {
+	t.Setenv("CLI53_JOURNAL_DIR", t.TempDir())
+	testRoute53(t, 1)
+	additions := []route53types.Change{
+		change(route53types.ChangeActionCreate, testRRSet("a.example.com.", route53types.RRTypeA, "127.0.0.1")),
+	}
+	_, err := submitChanges(context.Background(), additions, nil, testZone, false)
+	assert.EqualError(t, err, "No changes were made")
+	ids, err := journalIds()
+	require.NoError(t, err)
+	assert.Empty(t, ids)
+}
+
+func TestSubmitChangesRolledBack(t *testing.T) {
+	t.Setenv("CLI53_JOURNAL_DIR", t.TempDir())
+	testRoute53(t, 2)
+	additions := []route53types.Change{}
+	for i := 0; i < 150; i++ {
+		additions = append(additions, change(route53types.ChangeActionCreate, testRRSet(fmt.Sprintf("r%03d.example.com.", i), route53types.RRTypeA, "127.0.0.1")))
+	}
+	_, err := submitChanges(context.Background(), additions, nil, testZone, true)
+	assert.EqualError(t, err, "Changes were rolled back")
+	ids, err := journalIds()
+	require.NoError(t, err)
+	assert.Empty(t, ids)
+
+	infos, err := submitChanges(context.Background(), additions[:1], nil, testZone, false)
+	require.NoError(t, err)
+	assert.Equal(t, "/change/C4", *infos[0].Id)
+	entry, err := loadJournalEntry("")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/change/C4"}, entry.ChangeIds)
+}
+
+func TestSubmitChangesJournalsFirst(t *testing.T) {
+	t.Setenv("CLI53_JOURNAL_DIR", t.TempDir())
+	journaled := []int{}
+	testRoute53Func(t, func(request int) bool {
+		ids, _ := journalIds()
+		journaled = append(journaled, len(ids))
+		return true
+	})
+	additions := []route53types.Change{
+		change(route53types.ChangeActionCreate, testRRSet("a.example.com.", route53types.RRTypeA, "127.0.0.1")),
+	}
+	_, err := submitChanges(context.Background(), additions, nil, testZone, false)
+	require.NoError(t, err)
+	assert.Equal(t, []int{1}, journaled)
+	entry, err := loadJournalEntry("")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/change/C1"}, entry.ChangeIds)
+}
+
+func TestSubmitChangesPartial(t *testing.T) {
+	t.Setenv("CLI53_JOURNAL_DIR", t.TempDir())
+	testRoute53(t, 2)
+	additions := []route53types.Change{}
+	for i := 0; i < 150; i++ {
+		additions = append(additions, change(route53types.ChangeActionCreate, testRRSet(fmt.Sprintf("r%03d.example.com.", i), route53types.RRTypeA, "127.0.0.1")))
+	}
+	_, err := submitChanges(context.Background(), additions, nil, testZone, false)
+	assert.EqualError(t, err, "The zone has been partially updated")
+
+	// only the first batch is journaled, so undo deletes just its records
+	entry, err := loadJournalEntry("")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/change/C1"}, entry.ChangeIds)
+	assert.Len(t, entry.Changes, 100)
+	require.Len(t, entry.After, 100)
+	live := map[rrsetIdentity]*route53types.ResourceRecordSet{}
+	for _, rrset := range entry.After {
+		live[identityOf(rrset)] = rrset
+	}
+	undoAdditions, undoDeletions, err := entry.undoChanges(live)
+	require.NoError(t, err)
+	assert.Empty(t, undoAdditions)
+	assert.Len(t, undoDeletions, 100)
+}
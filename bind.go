@@ -39,6 +39,13 @@ func parseComment(rr dns.RR, comment string) dns.RR {
 }
 
 func parseBindFile(reader io.Reader, filename, origin string) []dns.RR {
+	records, err := parseBindFileErr(reader, filename, origin)
+	fatalIfErr(err)
+	return records
+}
+
+// parseBindFileErr is parseBindFile, returning parse errors to the caller.
+func parseBindFileErr(reader io.Reader, filename, origin string) ([]dns.RR, error) {
 	parser := dns.NewZoneParser(reader, origin, filename)
 	records := []dns.RR{}
 	for {
@@ -50,9 +57,9 @@ func parseBindFile(reader io.Reader, filename, origin string) []dns.RR {
 		records = append(records, record)
 	}
 	if err := parser.Err(); err != nil {
-		fatalIfErr(err)
+		return nil, err
 	}
-	return records
+	return records, nil
 }
 
 func quoteValues(vals []string) string {
@@ -132,6 +139,19 @@ func ConvertBindToRR(record dns.RR) route53types.ResourceRecord {
 	return route53types.ResourceRecord{}
 }
 
+// supportedRecord reports whether a DNS record can be converted by
+// ConvertBindToRRSet.
+func supportedRecord(record dns.RR) bool {
+	if awsrr, ok := record.(*AWSRR); ok {
+		record = awsrr.RR
+	}
+	switch record.(type) {
+	case *dns.A, *dns.AAAA, *dns.CNAME, *dns.MX, *dns.NAPTR, *dns.NS, *dns.PTR, *dns.SOA, *dns.SPF, *dns.SRV, *dns.TXT, *dns.CAA, *dns.PrivateRR:
+		return true
+	}
+	return false
+}
+
 // ConvertAliasToRRSet will convert an alias to a ResourceRecordSet.
 func ConvertAliasToRRSet(alias *dns.PrivateRR) *route53types.ResourceRecordSet {
 	// AWS ALIAS extension record
@@ -0,0 +1,238 @@
+package cli53
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	route53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/miekg/dns"
+)
+
+// FormatChangeBatch is the ChangeBatch JSON document taken by
+// aws route53 change-resource-record-sets --change-batch.
+const FormatChangeBatch = "changebatch"
+
+// The ChangeBatch document, as written by the AWS CLI. Unset fields are
+// omitted, as the AWS CLI rejects empty values.
+type awsChangeBatch struct {
+	Comment string      `json:"Comment,omitempty"`
+	Changes []awsChange `json:"Changes"`
+}
+
+type awsChange struct {
+	Action            string    `json:"Action"`
+	ResourceRecordSet *awsRRSet `json:"ResourceRecordSet"`
+}
+
+type awsRRSet struct {
+	Name             string              `json:"Name"`
+	Type             string              `json:"Type"`
+	SetIdentifier    string              `json:"SetIdentifier,omitempty"`
+	Weight           *int64              `json:"Weight,omitempty"`
+	Region           string              `json:"Region,omitempty"`
+	GeoLocation      *awsGeoLocation     `json:"GeoLocation,omitempty"`
+	Failover         string              `json:"Failover,omitempty"`
+	MultiValueAnswer *bool               `json:"MultiValueAnswer,omitempty"`
+	TTL              *int64              `json:"TTL,omitempty"`
+	ResourceRecords  []awsResourceRecord `json:"ResourceRecords,omitempty"`
+	AliasTarget      *awsAliasTarget     `json:"AliasTarget,omitempty"`
+	HealthCheckId    string              `json:"HealthCheckId,omitempty"`
+}
+
+type awsGeoLocation struct {
+	ContinentCode   string `json:"ContinentCode,omitempty"`
+	CountryCode     string `json:"CountryCode,omitempty"`
+	SubdivisionCode string `json:"SubdivisionCode,omitempty"`
+}
+
+type awsResourceRecord struct {
+	Value string `json:"Value"`
+}
+
+type awsAliasTarget struct {
+	HostedZoneId         string `json:"HostedZoneId"`
+	DNSName              string `json:"DNSName"`
+	EvaluateTargetHealth bool   `json:"EvaluateTargetHealth"`
+}
+
+func newAWSRRSet(rrset *route53types.ResourceRecordSet) *awsRRSet {
+	a := &awsRRSet{
+		Name:             *rrset.Name,
+		Type:             string(rrset.Type),
+		SetIdentifier:    aws.ToString(rrset.SetIdentifier),
+		Weight:           rrset.Weight,
+		Region:           string(rrset.Region),
+		Failover:         string(rrset.Failover),
+		MultiValueAnswer: rrset.MultiValueAnswer,
+		TTL:              rrset.TTL,
+		HealthCheckId:    aws.ToString(rrset.HealthCheckId),
+	}
+	if geo := rrset.GeoLocation; geo != nil {
+		a.GeoLocation = &awsGeoLocation{
+			ContinentCode:   aws.ToString(geo.ContinentCode),
+			CountryCode:     aws.ToString(geo.CountryCode),
+			SubdivisionCode: aws.ToString(geo.SubdivisionCode),
+		}
+	}
+	for _, rr := range rrset.ResourceRecords {
+		a.ResourceRecords = append(a.ResourceRecords, awsResourceRecord{aws.ToString(rr.Value)})
+	}
+	if alias := rrset.AliasTarget; alias != nil {
+		a.AliasTarget = &awsAliasTarget{
+			HostedZoneId:         aws.ToString(alias.HostedZoneId),
+			DNSName:              aws.ToString(alias.DNSName),
+			EvaluateTargetHealth: alias.EvaluateTargetHealth,
+		}
+	}
+	return a
+}
+
+// rrset converts the record set for a change to the zone, expanding $self
+// alias targets. Names and alias targets are always absolute, as route53
+// treats them, even without the ending period.
+func (a *awsRRSet) rrset(zone *route53types.HostedZone) (*route53types.ResourceRecordSet, error) {
+	if a.Name == "" {
+		return nil, errors.New("Name is required")
+	}
+	name := strings.ToLower(absolute(a.Name))
+	if !dns.IsSubDomain(strings.ToLower(*zone.Name), name) {
+		return nil, fmt.Errorf("%s is not in the zone %s", name, *zone.Name)
+	}
+	if _, ok := dns.StringToType[a.Type]; !ok {
+		return nil, fmt.Errorf("%s: unknown Type '%s'", name, a.Type)
+	}
+	if (len(a.ResourceRecords) == 0) == (a.AliasTarget == nil) {
+		return nil, fmt.Errorf("%s %s: exactly one of ResourceRecords or AliasTarget is required", name, a.Type)
+	}
+	rrset := &route53types.ResourceRecordSet{
+		Name:             aws.String(name),
+		Type:             route53types.RRType(a.Type),
+		SetIdentifier:    optString(a.SetIdentifier),
+		Weight:           a.Weight,
+		Region:           route53types.ResourceRecordSetRegion(a.Region),
+		Failover:         route53types.ResourceRecordSetFailover(a.Failover),
+		MultiValueAnswer: a.MultiValueAnswer,
+		TTL:              a.TTL,
+		HealthCheckId:    optString(a.HealthCheckId),
+	}
+	if geo := a.GeoLocation; geo != nil {
+		rrset.GeoLocation = &route53types.GeoLocation{
+			ContinentCode:   optString(geo.ContinentCode),
+			CountryCode:     optString(geo.CountryCode),
+			SubdivisionCode: optString(geo.SubdivisionCode),
+		}
+	}
+	for _, rr := range a.ResourceRecords {
+		rrset.ResourceRecords = append(rrset.ResourceRecords, route53types.ResourceRecord{Value: aws.String(rr.Value)})
+	}
+	if alias := a.AliasTarget; alias != nil {
+		rrset.AliasTarget = &route53types.AliasTarget{
+			HostedZoneId:         aws.String(alias.HostedZoneId),
+			DNSName:              aws.String(absolute(alias.DNSName)),
+			EvaluateTargetHealth: alias.EvaluateTargetHealth,
+		}
+		if alias.HostedZoneId == "$self" {
+			rrset.AliasTarget.HostedZoneId = aws.String(strings.Replace(*zone.Id, "/hostedzone/", "", 1))
+		}
+	}
+	return rrset, nil
+}
+
+// readChangeBatch reads a ChangeBatch document, returning the changes split
+// into the additions and deletions batchChanges expects.
+func readChangeBatch(r io.Reader, zone *route53types.HostedZone) (additions, deletions []route53types.Change, err error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	batch := awsChangeBatch{}
+	if err := dec.Decode(&batch); err != nil {
+		return nil, nil, err
+	}
+	additions = []route53types.Change{}
+	deletions = []route53types.Change{}
+	for i, change := range batch.Changes {
+		if change.ResourceRecordSet == nil {
+			return nil, nil, fmt.Errorf("change %d: ResourceRecordSet is required", i+1)
+		}
+		rrset, err := change.ResourceRecordSet.rrset(zone)
+		if err != nil {
+			return nil, nil, fmt.Errorf("change %d: %s", i+1, err)
+		}
+		c := route53types.Change{
+			Action:            route53types.ChangeAction(change.Action),
+			ResourceRecordSet: rrset,
+		}
+		switch c.Action {
+		case route53types.ChangeActionCreate, route53types.ChangeActionUpsert:
+			additions = append(additions, c)
+		case route53types.ChangeActionDelete:
+			deletions = append(deletions, c)
+		default:
+			return nil, nil, fmt.Errorf("change %d: Action must be CREATE, DELETE or UPSERT, not '%s'", i+1, change.Action)
+		}
+	}
+	return
+}
+
+// writeChangeBatch writes changes as a single ChangeBatch document, warning
+// if they are too large for route53 to accept in one request.
+func writeChangeBatch(w io.Writer, zone *route53types.HostedZone, additions, deletions []route53types.Change) error {
+	if batches, err := planBatches(additions, deletions, zone); err != nil || len(batches) > 1 {
+		fmt.Fprintln(os.Stderr, "Warning: the changes exceed the route53 limits for a single change batch")
+	}
+	batch := awsChangeBatch{
+		Comment: fmt.Sprintf("cli53 changes to %s", *zone.Name),
+		Changes: []awsChange{},
+	}
+	for _, change := range append(append([]route53types.Change{}, deletions...), additions...) {
+		batch.Changes = append(batch.Changes, awsChange{string(change.Action), newAWSRRSet(change.ResourceRecordSet)})
+	}
+	data, err := json.MarshalIndent(batch, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+func writeChangeBatchFile(filename string, zone *route53types.HostedZone, additions, deletions []route53types.Change) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := writeChangeBatch(f, zone, additions, deletions); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// exportChangeBatch exports a zone as a ChangeBatch creating its records,
+// other than the SOA and NS records route53 creates with the zone.
+func exportChangeBatch(ctx context.Context, name string, writer io.Writer) {
+	zone := lookupZone(ctx, name)
+	rrsets, err := ListAllRecordSets(ctx, r53, *zone.Id)
+	fatalIfErr(err)
+	sort.Sort(exportSorter{rrsets, *zone.Name})
+	additions := []route53types.Change{}
+	for _, rrset := range rrsets {
+		if isAuthRecord(zone, rrset) {
+			continue
+		}
+		if rrset.TrafficPolicyInstanceId != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Skipping traffic policy record %s\n", *rrset.Name)
+			continue
+		}
+		additions = append(additions, route53types.Change{
+			Action:            route53types.ChangeActionCreate,
+			ResourceRecordSet: rrset,
+		})
+	}
+	fatalIfErr(writeChangeBatch(writer, zone, additions, nil))
+}
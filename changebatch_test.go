@@ -0,0 +1,75 @@
+package cli53
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	route53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadChangeBatch(t *testing.T) {
+	input := `{
+  "Comment": "runbook",
+  "Changes": [
+    {"Action": "UPSERT", "ResourceRecordSet": {"Name": "www.example.com.", "Type": "A", "TTL": 300, "ResourceRecords": [{"Value": "192.0.2.1"}]}},
+    {"Action": "DELETE", "ResourceRecordSet": {"Name": "old.example.com", "Type": "TXT", "TTL": 3600, "ResourceRecords": [{"Value": "\"gone\""}]}},
+    {"Action": "CREATE", "ResourceRecordSet": {"Name": "example.com", "Type": "A", "AliasTarget": {"HostedZoneId": "$self", "DNSName": "www.example.com", "EvaluateTargetHealth": false}}},
+    {"Action": "CREATE", "ResourceRecordSet": {"Name": "lb.example.com", "Type": "A", "AliasTarget": {"HostedZoneId": "Z35SXDOTRQ7X7K", "DNSName": "lb.elb.amazonaws.com", "EvaluateTargetHealth": true}}}
+  ]
+}`
+	additions, deletions, err := readChangeBatch(strings.NewReader(input), testZone)
+	require.NoError(t, err)
+	upsert := testRRSet("www.example.com.", route53types.RRTypeA, "192.0.2.1")
+	upsert.TTL = aws.Int64(300)
+	external := testAlias("lb.example.com.", "lb.elb.amazonaws.com.")
+	external.AliasTarget.HostedZoneId = aws.String("Z35SXDOTRQ7X7K")
+	external.AliasTarget.EvaluateTargetHealth = true
+	assert.Equal(t, []route53types.Change{
+		change(route53types.ChangeActionUpsert, upsert),
+		change(route53types.ChangeActionCreate, testAlias("example.com.", "www.example.com.")),
+		change(route53types.ChangeActionCreate, external),
+	}, additions)
+	assert.Equal(t, []route53types.Change{
+		change(route53types.ChangeActionDelete, testRRSet("old.example.com.", route53types.RRTypeTxt, `"gone"`)),
+	}, deletions)
+}
+
+func TestReadChangeBatchErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{`{"Changes": [{"Action": "REPLACE", "ResourceRecordSet": {"Name": "www.example.com", "Type": "A", "TTL": 300, "ResourceRecords": [{"Value": "192.0.2.1"}]}}]}`, "change 1: Action must be CREATE, DELETE or UPSERT, not 'REPLACE'"},
+		{`{"Changes": [{"Action": "CREATE"}]}`, "change 1: ResourceRecordSet is required"},
+		{`{"Changes": [{"Action": "CREATE", "ResourceRecordSet": {"Name": "www.example.com", "Type": "A", "TTL": 300}}]}`, "change 1: www.example.com. A: exactly one of ResourceRecords or AliasTarget is required"},
+		{`{"Changes": [{"Action": "CREATE", "ResourceRecordSet": {"Name": "www.example.com", "Type": "A", "Ttl": 300, "Records": []}}]}`, `json: unknown field "Records"`},
+		{`{"Changes": [{"Action": "CREATE", "ResourceRecordSet": {"Name": "www", "Type": "A", "TTL": 300, "ResourceRecords": [{"Value": "192.0.2.1"}]}}]}`, "change 1: www. is not in the zone example.com."},
+	}
+	for _, test := range tests {
+		_, _, err := readChangeBatch(strings.NewReader(test.input), testZone)
+		assert.EqualError(t, err, test.err)
+	}
+}
+
+func TestChangeBatchRoundTrip(t *testing.T) {
+	additions := []route53types.Change{}
+	for _, rrset := range routedRRSets() {
+		additions = append(additions, change(route53types.ChangeActionCreate, rrset))
+	}
+	deletions := []route53types.Change{
+		change(route53types.ChangeActionDelete, testRRSet("old.example.com.", route53types.RRTypeA, "127.0.0.9")),
+	}
+	w := &bytes.Buffer{}
+	require.NoError(t, writeChangeBatch(w, testZone, additions, deletions))
+	assert.Contains(t, w.String(), `"Action": "DELETE"`)
+	assert.NotContains(t, w.String(), `"Failover": ""`)
+
+	a, d, err := readChangeBatch(w, testZone)
+	require.NoError(t, err)
+	assert.Equal(t, additions, a)
+	assert.Equal(t, deletions, d)
+}
@@ -0,0 +1,262 @@
+package cli53
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	route53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"gopkg.in/yaml.v2"
+)
+
+// Formats exporting a zone as a CloudFormation template, in YAML or JSON.
+const (
+	FormatCloudFormation     = "cloudformation"
+	FormatCloudFormationJSON = "cloudformation-json"
+)
+
+// The maximum number of resources in a CloudFormation template.
+const cloudFormationResourceLimit = 500
+
+const cloudFormationZoneResource = "HostedZone"
+
+type cfnTemplate struct {
+	AWSTemplateFormatVersion string                `json:"AWSTemplateFormatVersion" yaml:"AWSTemplateFormatVersion"`
+	Description              string                `json:"Description" yaml:"Description"`
+	Resources                cfnResources          `json:"Resources" yaml:"Resources"`
+	Outputs                  map[string]*cfnOutput `json:"Outputs" yaml:"Outputs"`
+}
+
+// cfnResources are the template's resources, written in order.
+type cfnResources []cfnNamedResource
+
+type cfnNamedResource struct {
+	name     string
+	resource *cfnResource
+}
+
+func (r cfnResources) MarshalYAML() (interface{}, error) {
+	m := yaml.MapSlice{}
+	for _, named := range r {
+		m = append(m, yaml.MapItem{Key: named.name, Value: named.resource})
+	}
+	return m, nil
+}
+
+func (r cfnResources) MarshalJSON() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteString("{")
+	for i, named := range r {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		key, _ := json.Marshal(named.name)
+		value, err := json.Marshal(named.resource)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteString(":")
+		buf.Write(value)
+	}
+	buf.WriteString("}")
+	return buf.Bytes(), nil
+}
+
+type cfnResource struct {
+	Type       string      `json:"Type" yaml:"Type"`
+	DependsOn  string      `json:"DependsOn,omitempty" yaml:"DependsOn,omitempty"`
+	Properties interface{} `json:"Properties" yaml:"Properties"`
+}
+
+type cfnOutput struct {
+	Value interface{} `json:"Value" yaml:"Value"`
+}
+
+// cfnRef is the Ref intrinsic function, equivalent to !Ref in YAML.
+type cfnRef struct {
+	Ref string `json:"Ref" yaml:"Ref"`
+}
+
+type cfnHostedZone struct {
+	Name             string               `json:"Name" yaml:"Name"`
+	HostedZoneConfig *cfnHostedZoneConfig `json:"HostedZoneConfig,omitempty" yaml:"HostedZoneConfig,omitempty"`
+	VPCs             []cfnVPC             `json:"VPCs,omitempty" yaml:"VPCs,omitempty"`
+}
+
+type cfnHostedZoneConfig struct {
+	Comment string `json:"Comment" yaml:"Comment"`
+}
+
+type cfnVPC struct {
+	VPCId     string `json:"VPCId" yaml:"VPCId"`
+	VPCRegion string `json:"VPCRegion" yaml:"VPCRegion"`
+}
+
+type cfnRecordSetGroup struct {
+	HostedZoneId interface{}     `json:"HostedZoneId" yaml:"HostedZoneId"`
+	RecordSets   []*cfnRecordSet `json:"RecordSets" yaml:"RecordSets"`
+}
+
+type cfnRecordSet struct {
+	Name             string          `json:"Name" yaml:"Name"`
+	Type             string          `json:"Type" yaml:"Type"`
+	SetIdentifier    string          `json:"SetIdentifier,omitempty" yaml:"SetIdentifier,omitempty"`
+	Weight           *int64          `json:"Weight,omitempty" yaml:"Weight,omitempty"`
+	Region           string          `json:"Region,omitempty" yaml:"Region,omitempty"`
+	GeoLocation      *cfnGeoLocation `json:"GeoLocation,omitempty" yaml:"GeoLocation,omitempty"`
+	Failover         string          `json:"Failover,omitempty" yaml:"Failover,omitempty"`
+	MultiValueAnswer *bool           `json:"MultiValueAnswer,omitempty" yaml:"MultiValueAnswer,omitempty"`
+	TTL              string          `json:"TTL,omitempty" yaml:"TTL,omitempty"`
+	ResourceRecords  []string        `json:"ResourceRecords,omitempty" yaml:"ResourceRecords,omitempty"`
+	AliasTarget      *cfnAliasTarget `json:"AliasTarget,omitempty" yaml:"AliasTarget,omitempty"`
+	HealthCheckId    string          `json:"HealthCheckId,omitempty" yaml:"HealthCheckId,omitempty"`
+}
+
+type cfnGeoLocation struct {
+	ContinentCode   string `json:"ContinentCode,omitempty" yaml:"ContinentCode,omitempty"`
+	CountryCode     string `json:"CountryCode,omitempty" yaml:"CountryCode,omitempty"`
+	SubdivisionCode string `json:"SubdivisionCode,omitempty" yaml:"SubdivisionCode,omitempty"`
+}
+
+type cfnAliasTarget struct {
+	DNSName              string      `json:"DNSName" yaml:"DNSName"`
+	HostedZoneId         interface{} `json:"HostedZoneId" yaml:"HostedZoneId"`
+	EvaluateTargetHealth bool        `json:"EvaluateTargetHealth" yaml:"EvaluateTargetHealth"`
+}
+
+// newCfnRecordSet converts a record set, referring to the hosted zone
+// resource for aliases to the zone itself.
+func newCfnRecordSet(rrset *route53types.ResourceRecordSet, zoneId string) *cfnRecordSet {
+	r := &cfnRecordSet{
+		Name:             unescaper.Replace(*rrset.Name),
+		Type:             string(rrset.Type),
+		SetIdentifier:    aws.ToString(rrset.SetIdentifier),
+		Weight:           rrset.Weight,
+		Region:           string(rrset.Region),
+		Failover:         string(rrset.Failover),
+		MultiValueAnswer: rrset.MultiValueAnswer,
+		HealthCheckId:    aws.ToString(rrset.HealthCheckId),
+	}
+	if rrset.TTL != nil {
+		r.TTL = fmt.Sprint(*rrset.TTL)
+	}
+	for _, rr := range rrset.ResourceRecords {
+		r.ResourceRecords = append(r.ResourceRecords, aws.ToString(rr.Value))
+	}
+	if geo := rrset.GeoLocation; geo != nil {
+		r.GeoLocation = &cfnGeoLocation{
+			ContinentCode:   aws.ToString(geo.ContinentCode),
+			CountryCode:     aws.ToString(geo.CountryCode),
+			SubdivisionCode: aws.ToString(geo.SubdivisionCode),
+		}
+	}
+	if alias := rrset.AliasTarget; alias != nil {
+		r.AliasTarget = &cfnAliasTarget{
+			DNSName:              aws.ToString(alias.DNSName),
+			HostedZoneId:         aws.ToString(alias.HostedZoneId),
+			EvaluateTargetHealth: alias.EvaluateTargetHealth,
+		}
+		if aws.ToString(alias.HostedZoneId) == zoneId {
+			r.AliasTarget.HostedZoneId = cfnRef{cloudFormationZoneResource}
+		}
+	}
+	return r
+}
+
+// newCloudFormationTemplate builds a template recreating the zone. The
+// records, other than the SOA and NS records route53 creates with the zone,
+// are split into record set groups within the limits of a change batch,
+// each depending on the last so alias targets are created first.
+func newCloudFormationTemplate(zone *route53types.HostedZone, vpcs []route53types.VPC, rrsets []*route53types.ResourceRecordSet) (*cfnTemplate, error) {
+	zoneId := strings.Replace(*zone.Id, "/hostedzone/", "", 1)
+	hostedZone := &cfnHostedZone{Name: unescaper.Replace(*zone.Name)}
+	if zone.Config != nil && aws.ToString(zone.Config.Comment) != "" {
+		hostedZone.HostedZoneConfig = &cfnHostedZoneConfig{*zone.Config.Comment}
+	}
+	for _, vpc := range vpcs {
+		hostedZone.VPCs = append(hostedZone.VPCs, cfnVPC{aws.ToString(vpc.VPCId), string(vpc.VPCRegion)})
+	}
+	template := &cfnTemplate{
+		AWSTemplateFormatVersion: "2010-09-09",
+		Description:              fmt.Sprintf("Route 53 hosted zone %s, exported by cli53", *zone.Name),
+		Resources: cfnResources{
+			{cloudFormationZoneResource, &cfnResource{Type: "AWS::Route53::HostedZone", Properties: hostedZone}},
+		},
+		Outputs: map[string]*cfnOutput{
+			"HostedZoneId": {cfnRef{cloudFormationZoneResource}},
+		},
+	}
+
+	additions := []route53types.Change{}
+	for _, rrset := range rrsets {
+		if isAuthRecord(zone, rrset) {
+			continue
+		}
+		if rrset.TrafficPolicyInstanceId != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Skipping traffic policy record %s\n", *rrset.Name)
+			continue
+		}
+		additions = append(additions, route53types.Change{
+			Action:            route53types.ChangeActionCreate,
+			ResourceRecordSet: rrset,
+		})
+	}
+	batches, err := planBatches(additions, nil, zone)
+	if err != nil {
+		return nil, err
+	}
+	previous := ""
+	for i, batch := range batches {
+		group := &cfnRecordSetGroup{HostedZoneId: cfnRef{cloudFormationZoneResource}}
+		for _, change := range batch {
+			group.RecordSets = append(group.RecordSets, newCfnRecordSet(change.ResourceRecordSet, zoneId))
+		}
+		name := fmt.Sprintf("RecordSetGroup%d", i+1)
+		template.Resources = append(template.Resources, cfnNamedResource{name, &cfnResource{
+			Type:       "AWS::Route53::RecordSetGroup",
+			DependsOn:  previous,
+			Properties: group,
+		}})
+		previous = name
+	}
+	if len(template.Resources) > cloudFormationResourceLimit {
+		return nil, fmt.Errorf("Zone needs %d resources, more than the CloudFormation limit of %d", len(template.Resources), cloudFormationResourceLimit)
+	}
+	return template, nil
+}
+
+func writeCloudFormationTemplate(w io.Writer, format string, template *cfnTemplate) error {
+	var data []byte
+	var err error
+	if format == FormatCloudFormationJSON {
+		data, err = json.MarshalIndent(template, "", "  ")
+		data = append(data, '\n')
+	} else {
+		data, err = yaml.Marshal(template)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func exportCloudFormation(ctx context.Context, name, format string, writer io.Writer) {
+	zone := lookupZone(ctx, name)
+	resp, err := r53.GetHostedZone(ctx, &route53.GetHostedZoneInput{Id: zone.Id})
+	fatalIfErr(err)
+	rrsets, err := ListAllRecordSets(ctx, r53, *zone.Id)
+	fatalIfErr(err)
+	sort.Sort(exportSorter{rrsets, *zone.Name})
+	template, err := newCloudFormationTemplate(resp.HostedZone, resp.VPCs, rrsets)
+	fatalIfErr(err)
+	fatalIfErr(writeCloudFormationTemplate(writer, format, template))
+}
@@ -0,0 +1,90 @@
+package cli53
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	route53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCloudFormationTemplateYAML(t *testing.T) {
+	zone := &route53types.HostedZone{
+		Id:     testZone.Id,
+		Name:   testZone.Name,
+		Config: &route53types.HostedZoneConfig{Comment: aws.String("internal"), PrivateZone: true},
+	}
+	vpcs := []route53types.VPC{{VPCId: aws.String("vpc-1"), VPCRegion: route53types.VPCRegionEuWest1}}
+	rrsets := []*route53types.ResourceRecordSet{
+		testRRSet("example.com.", route53types.RRTypeNs, "ns-1.awsdns-1.com."),
+		testRRSet("www.example.com.", route53types.RRTypeA, "127.0.0.1"),
+		testAlias("alias.example.com.", "www.example.com."),
+	}
+	template, err := newCloudFormationTemplate(zone, vpcs, rrsets)
+	require.NoError(t, err)
+	w := &bytes.Buffer{}
+	require.NoError(t, writeCloudFormationTemplate(w, FormatCloudFormation, template))
+	assert.Equal(t, `AWSTemplateFormatVersion: "2010-09-09"
+Description: Route 53 hosted zone example.com., exported by cli53
+Resources:
+  HostedZone:
+    Type: AWS::Route53::HostedZone
+    Properties:
+      Name: example.com.
+      HostedZoneConfig:
+        Comment: internal
+      VPCs:
+      - VPCId: vpc-1
+        VPCRegion: eu-west-1
+  RecordSetGroup1:
+    Type: AWS::Route53::RecordSetGroup
+    Properties:
+      HostedZoneId:
+        Ref: HostedZone
+      RecordSets:
+      - Name: www.example.com.
+        Type: A
+        TTL: "3600"
+        ResourceRecords:
+        - 127.0.0.1
+      - Name: alias.example.com.
+        Type: A
+        AliasTarget:
+          DNSName: www.example.com.
+          HostedZoneId:
+            Ref: HostedZone
+          EvaluateTargetHealth: false
+Outputs:
+  HostedZoneId:
+    Value:
+      Ref: HostedZone
+`, w.String())
+}
+
+func TestCloudFormationTemplateSplitsGroups(t *testing.T) {
+	rrsets := []*route53types.ResourceRecordSet{}
+	for i := 0; i < ChangeBatchSize+1; i++ {
+		rrsets = append(rrsets, testRRSet(fmt.Sprintf("host%03d.example.com.", i), route53types.RRTypeA, "127.0.0.1"))
+	}
+	template, err := newCloudFormationTemplate(testZone, nil, rrsets)
+	require.NoError(t, err)
+	w := &bytes.Buffer{}
+	require.NoError(t, writeCloudFormationTemplate(w, FormatCloudFormationJSON, template))
+
+	var parsed struct {
+		Resources map[string]struct {
+			Type       string
+			DependsOn  string
+			Properties struct{ RecordSets []interface{} }
+		}
+	}
+	require.NoError(t, json.Unmarshal(w.Bytes(), &parsed))
+	assert.Len(t, parsed.Resources, 3)
+	assert.Len(t, parsed.Resources["RecordSetGroup1"].Properties.RecordSets, ChangeBatchSize)
+	assert.Len(t, parsed.Resources["RecordSetGroup2"].Properties.RecordSets, 1)
+	assert.Equal(t, "RecordSetGroup1", parsed.Resources["RecordSetGroup2"].DependsOn)
+}
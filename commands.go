@@ -14,8 +14,6 @@ import (
 	"github.com/miekg/dns"
 )
 
-const ChangeBatchSize = 100
-
 func createZone(ctx context.Context, name, comment, vpcId, vpcRegion, delegationSetId string) {
 	callerReference := uniqueReference()
 	req := route53.CreateHostedZoneInput{
@@ -84,47 +82,32 @@ func deleteReusableDelegationSet(ctx context.Context, id string) {
 	fmt.Printf("Deleted reusable delegation set\n")
 }
 
-func deleteRecordSets(ctx context.Context, zone *route53types.HostedZone, rrsets []*route53types.ResourceRecordSet, wait bool) (int, error) {
-	// delete all non-default SOA/NS records
-	changes := []route53types.Change{}
-	for _, rrset := range rrsets {
-		if !isAuthRecord(zone, rrset) {
-			change := route53types.Change{
-				Action:            route53types.ChangeActionDelete,
-				ResourceRecordSet: rrset,
-			}
-			changes = append(changes, change)
-		}
-	}
-
-	if len(changes) > 0 {
-		req := route53.ChangeResourceRecordSetsInput{
-			HostedZoneId: zone.Id,
-			ChangeBatch: &route53types.ChangeBatch{
-				Changes: changes,
-			},
-		}
-		resp, err := r53.ChangeResourceRecordSets(ctx, &req)
-		if err != nil {
-			return 0, err
-		}
-		if wait {
-			waitForChange(ctx, resp.ChangeInfo)
-		}
-	}
-	return len(changes), nil
-}
-
 func purgeZoneRecords(ctx context.Context, zone *route53types.HostedZone, wait bool) {
 	total := 0
+	changes := []*route53types.ChangeInfo{}
 	err := batchListAllRecordSets(ctx, r53, *zone.Id, func(rrsets []*route53types.ResourceRecordSet) {
-		n, err := deleteRecordSets(ctx, zone, rrsets, wait)
-		fatalIfErr(err)
-		total += n
+		// delete all non-default SOA/NS records
+		deletions := []route53types.Change{}
+		for _, rrset := range rrsets {
+			if !isAuthRecord(zone, rrset) {
+				change := route53types.Change{
+					Action:            route53types.ChangeActionDelete,
+					ResourceRecordSet: rrset,
+				}
+				deletions = append(deletions, change)
+			}
+		}
+		if len(deletions) > 0 {
+			changes = append(changes, batchChanges(ctx, nil, deletions, zone, false)...)
+			total += len(deletions)
+		}
 	})
 	fatalIfErr(err)
 
 	fmt.Printf("%d record sets deleted\n", total)
+	if wait {
+		waitForChanges(ctx, changes)
+	}
 }
 
 func deleteZone(ctx context.Context, name string, purge bool) {
@@ -184,56 +167,44 @@ type Key struct {
 	Identifier string
 }
 
-type changeSorter struct {
-	changes []route53types.Change
-}
-
-func (r changeSorter) Len() int {
-	return len(r.changes)
-}
-
-func (r changeSorter) Swap(i, j int) {
-	r.changes[i], r.changes[j] = r.changes[j], r.changes[i]
-}
-
-func (r changeSorter) Less(i, j int) bool {
-	// sort non-aliases first
-	if r.changes[i].ResourceRecordSet.AliasTarget == nil {
-		return true
+// recordKey is the record set a record belongs to: its name, type and
+// optionally identifier.
+func recordKey(record dns.RR) Key {
+	var identifier string
+	if aws, ok := record.(*AWSRR); ok {
+		identifier = aws.Identifier
 	}
-	if r.changes[j].ResourceRecordSet.AliasTarget == nil {
-		return false
+	if alias, ok := record.(*dns.PrivateRR); ok {
+		// issue #195: alias records need to be keyed by the type of the alias too
+		rdata := alias.Data.(*ALIASRdata)
+		identifier += "@" + rdata.Type
 	}
-	return *r.changes[i].ResourceRecordSet.Name < *r.changes[j].ResourceRecordSet.Name
+	return Key{record.Header().Name, record.Header().Rrtype, identifier}
 }
 
 func groupRecords(records []dns.RR) map[Key][]dns.RR {
-	// group records by name+type and optionally identifier
 	grouped := map[Key][]dns.RR{}
 	for _, record := range records {
-		var identifier string
-		if aws, ok := record.(*AWSRR); ok {
-			identifier = aws.Identifier
-		}
-		if alias, ok := record.(*dns.PrivateRR); ok {
-			// issue #195: alias records need to be keyed by the type of the alias too
-			rdata := alias.Data.(*ALIASRdata)
-			identifier += "@" + rdata.Type
-		}
-		key := Key{record.Header().Name, record.Header().Rrtype, identifier}
+		key := recordKey(record)
 		grouped[key] = append(grouped[key], record)
 	}
 	return grouped
 }
 
 type importArgs struct {
-	name     string
-	file     string
-	wait     bool
-	editauth bool
-	replace  bool
-	upsert   bool
-	dryrun   bool
+	name       string
+	file       string
+	wait       bool
+	editauth   bool
+	replace    bool
+	upsert     bool
+	dryrun     bool
+	planOut    string
+	rollback   bool
+	format     string
+	planFormat string
+	axfr       string
+	verify     verifyOptions
 }
 
 func rrsetKey(rrset *route53types.ResourceRecordSet) string {
@@ -256,49 +227,36 @@ func rrsetKey(rrset *route53types.ResourceRecordSet) string {
 }
 
 func validateBindFile(args importArgs) {
-	var reader io.Reader
-	if args.file == "-" {
-		reader = os.Stdin
-	} else {
-		f, err := os.Open(args.file)
-		fatalIfErr(err)
-		defer f.Close()
-		reader = f
-	}
+	reader, closer := openInput(args.file)
+	defer closer()
 
 	parseBindFile(reader, args.file, "validate.test")
 }
 
-func importBind(ctx context.Context, args importArgs) {
-	zone := lookupZone(ctx, args.name)
-
-	var reader io.Reader
-	if args.file == "-" {
-		reader = os.Stdin
-	} else {
-		f, err := os.Open(args.file)
-		fatalIfErr(err)
-		defer f.Close()
-		reader = f
+func openInput(file string) (io.Reader, func()) {
+	if file == "-" {
+		return os.Stdin, func() {}
 	}
+	f, err := os.Open(file)
+	fatalIfErr(err)
+	return f, func() { f.Close() }
+}
 
-	records := parseBindFile(reader, args.file, *zone.Name)
-	expandSelfAliases(records, zone)
-
+// importChanges compares the records parsed from a zone file with the
+// existing record sets of the zone and returns the changes needed to make
+// the zone match the file. rrsets should only be given for --replace or
+// --upsert imports.
+func importChanges(zone *route53types.HostedZone, records []dns.RR, rrsets []*route53types.ResourceRecordSet, args importArgs) (additions, deletions []route53types.Change) {
 	grouped := groupRecords(records)
 	existing := map[string]*route53types.ResourceRecordSet{}
-	if args.replace || args.upsert {
-		rrsets, err := ListAllRecordSets(ctx, r53, *zone.Id)
-		fatalIfErr(err)
-		for _, rrset := range rrsets {
-			if args.editauth || !isAuthRecord(zone, rrset) {
-				rrset.Name = aws.String(unescaper.Replace(*rrset.Name))
-				existing[rrsetKey(rrset)] = rrset
-			}
+	for _, rrset := range rrsets {
+		if args.editauth || !isAuthRecord(zone, rrset) {
+			rrset.Name = aws.String(unescaper.Replace(*rrset.Name))
+			existing[rrsetKey(rrset)] = rrset
 		}
 	}
 
-	additions := []route53types.Change{}
+	additions = []route53types.Change{}
 	for _, values := range grouped {
 		rrset := ConvertBindToRRSet(values)
 		if rrset != nil && (args.editauth || !isAuthRecord(zone, rrset)) {
@@ -326,7 +284,7 @@ func importBind(ctx context.Context, args importArgs) {
 	}
 
 	// remaining records in existing should be deleted
-	deletions := []route53types.Change{}
+	deletions = []route53types.Change{}
 	if !args.upsert {
 		for _, rrset := range existing {
 			change := route53types.Change{
@@ -336,59 +294,126 @@ func importBind(ctx context.Context, args importArgs) {
 			deletions = append(deletions, change)
 		}
 	}
+	return
+}
 
-	if args.dryrun {
-		if len(additions)+len(deletions) == 0 {
-			fmt.Println("Dry-run, but no changes would have been made.")
-		} else {
-			fmt.Println("Dry-run, changes that would be made:")
-			for _, addition := range additions {
-				rrs := ConvertRRSetToBind(addition.ResourceRecordSet)
-				for _, rr := range rrs {
-					fmt.Printf("+ %s\n", rr.String())
-				}
-			}
-			for _, deletion := range deletions {
-				rrs := ConvertRRSetToBind(deletion.ResourceRecordSet)
-				for _, rr := range rrs {
-					fmt.Printf("- %s\n", rr.String())
-				}
-			}
+func printChanges(additions, deletions []route53types.Change) {
+	for _, addition := range additions {
+		rrs := ConvertRRSetToBind(addition.ResourceRecordSet)
+		for _, rr := range rrs {
+			fmt.Printf("+ %s\n", rr.String())
 		}
-	} else {
-		resp := batchChanges(ctx, additions, deletions, zone)
-		fmt.Printf("%d records imported (%d changes / %d additions / %d deletions)\n", len(records), len(additions)+len(deletions), len(additions), len(deletions))
-
-		if args.wait && resp != nil {
-			waitForChange(ctx, resp.ChangeInfo)
+	}
+	for _, deletion := range deletions {
+		rrs := ConvertRRSetToBind(deletion.ResourceRecordSet)
+		for _, rr := range rrs {
+			fmt.Printf("- %s\n", rr.String())
 		}
 	}
 }
 
-func batchChanges(ctx context.Context, additions, deletions []route53types.Change, zone *route53types.HostedZone) *route53.ChangeResourceRecordSetsOutput {
-	// sort additions so aliases are last
-	sort.Sort(changeSorter{additions})
+func importBind(ctx context.Context, args importArgs) {
+	zone := lookupZone(ctx, args.name)
 
-	changes := append(deletions, additions...)
+	var reader io.Reader
+	if args.axfr == "" {
+		var closer func()
+		reader, closer = openInput(args.file)
+		defer closer()
+	}
+
+	var rrsets []*route53types.ResourceRecordSet
+	if args.replace || args.upsert || args.planOut != "" {
+		var err error
+		rrsets, err = ListAllRecordSets(ctx, r53, *zone.Id)
+		fatalIfErr(err)
+	}
 
-	var resp *route53.ChangeResourceRecordSetsOutput
-	for i := 0; i < len(changes); i += ChangeBatchSize {
-		end := i + ChangeBatchSize
-		if end > len(changes) {
-			end = len(changes)
+	var additions, deletions []route53types.Change
+	var imported int
+	if args.format == FormatChangeBatch {
+		var err error
+		additions, deletions, err = readChangeBatch(reader, zone)
+		fatalIfErr(err)
+		imported = len(additions) + len(deletions)
+	} else {
+		var records []dns.RR
+		if args.axfr != "" {
+			var err error
+			records, err = transferZone(args.axfr, unescaper.Replace(*zone.Name))
+			fatalIfErr(err)
+		} else if args.format == "" || args.format == FormatBind {
+			records = parseBindFile(reader, args.file, *zone.Name)
+		} else if args.format == FormatOctoDNS {
+			var err error
+			records, err = readOctoDNS(reader, *zone.Name)
+			fatalIfErr(err)
+		} else if args.format == FormatCSV {
+			var err error
+			records, err = readCSV(reader, *zone.Name)
+			fatalIfErr(err)
+		} else if args.format == FormatTinydns {
+			var err error
+			records, err = readTinydns(reader, *zone.Name)
+			fatalIfErr(err)
+		} else if args.format == FormatHosts {
+			var err error
+			records, err = readHosts(reader, *zone.Name)
+			fatalIfErr(err)
+		} else if args.format == FormatDnsmasq {
+			var err error
+			records, err = readDnsmasq(reader, *zone.Name)
+			fatalIfErr(err)
+		} else {
+			rrsets, err := readRecordSets(reader, args.format, *zone.Name)
+			fatalIfErr(err)
+			records, err = rrsetsToRecords(rrsets)
+			fatalIfErr(err)
 		}
-		batch := route53types.ChangeBatch{
-			Changes: changes[i:end],
+		expandSelfAliases(records, zone)
+
+		var existing []*route53types.ResourceRecordSet
+		if args.replace || args.upsert {
+			existing = rrsets
 		}
-		req := route53.ChangeResourceRecordSetsInput{
-			HostedZoneId: zone.Id,
-			ChangeBatch:  &batch,
+		additions, deletions = importChanges(zone, records, existing, args)
+		imported = len(records)
+	}
+
+	if args.planOut != "" {
+		if args.planFormat == FormatChangeBatch {
+			fatalIfErr(writeChangeBatchFile(args.planOut, zone, additions, deletions))
+		} else {
+			plan := newImportPlan(zone, zoneFingerprint(rrsets), additions, deletions)
+			fatalIfErr(writePlanFile(args.planOut, plan))
+		}
+		if len(additions)+len(deletions) == 0 {
+			fmt.Println("No changes would be made.")
+		} else {
+			fmt.Println("Changes that would be made:")
+			printChanges(additions, deletions)
+		}
+		fmt.Printf("Plan written to %s\n", args.planOut)
+	} else if args.dryrun && args.planFormat == FormatChangeBatch {
+		fatalIfErr(writeChangeBatch(os.Stdout, zone, additions, deletions))
+	} else if args.dryrun {
+		if len(additions)+len(deletions) == 0 {
+			fmt.Println("Dry-run, but no changes would have been made.")
+		} else {
+			fmt.Println("Dry-run, changes that would be made:")
+			printChanges(additions, deletions)
+		}
+	} else {
+		changes := batchChanges(ctx, additions, deletions, zone, args.rollback)
+		fmt.Printf("%d records imported (%d changes / %d additions / %d deletions)\n", imported, len(additions)+len(deletions), len(additions), len(deletions))
+
+		if args.wait {
+			waitForChanges(ctx, changes)
+		}
+		if args.verify.enabled {
+			verifyChanges(ctx, zone, additions, deletions, args.verify)
 		}
-		var err error
-		resp, err = r53.ChangeResourceRecordSets(ctx, &req)
-		fatalIfErr(err)
 	}
-	return resp
 }
 
 func UnexpandSelfAliases(records []dns.RR, zone *route53types.HostedZone, full bool) {
@@ -444,8 +469,16 @@ func (r exportSorter) Less(i, j int) bool {
 }
 
 func ExportBindToWriter(ctx context.Context, r53 *route53.Client, zone *route53types.HostedZone, full bool, out io.Writer) {
+	fatalIfErr(writeBindExport(ctx, r53, zone, full, out))
+}
+
+// writeBindExport writes a zone in bind format, returning any error listing
+// its record sets.
+func writeBindExport(ctx context.Context, r53 *route53.Client, zone *route53types.HostedZone, full bool, out io.Writer) error {
 	rrsets, err := ListAllRecordSets(ctx, r53, *zone.Id)
-	fatalIfErr(err)
+	if err != nil {
+		return err
+	}
 
 	sort.Sort(exportSorter{rrsets, *zone.Name})
 	dnsname := *zone.Name
@@ -466,12 +499,14 @@ func ExportBindToWriter(ctx context.Context, r53 *route53.Client, zone *route53t
 			fmt.Fprintln(out, line)
 		}
 	}
+	return nil
 }
 
 type createArgs struct {
 	name            string
 	records         []string
 	wait            bool
+	verify          verifyOptions
 	append          bool
 	replace         bool
 	identifier      string
@@ -647,7 +682,7 @@ func createRecords(ctx context.Context, args createArgs) {
 		}
 	}
 
-	resp := batchChanges(ctx, additions, deletions, zone)
+	changes := batchChanges(ctx, additions, deletions, zone, false)
 
 	for _, record := range records {
 		txt := strings.Replace(record.String(), "\t", " ", -1)
@@ -655,7 +690,10 @@ func createRecords(ctx context.Context, args createArgs) {
 	}
 
 	if args.wait {
-		waitForChange(ctx, resp.ChangeInfo)
+		waitForChanges(ctx, changes)
+	}
+	if args.verify.enabled {
+		verifyChanges(ctx, zone, additions, deletions, args.verify)
 	}
 }
 
@@ -693,7 +731,7 @@ func ListAllRecordSets(ctx context.Context, r53 *route53.Client, id string) (rrs
 	return
 }
 
-func deleteRecord(ctx context.Context, name string, match string, rtype string, wait bool, identifier string) {
+func deleteRecord(ctx context.Context, name string, match string, rtype string, wait bool, identifier string, verify verifyOptions) {
 	zone := lookupZone(ctx, name)
 	rrsets, err := ListAllRecordSets(ctx, r53, *zone.Id)
 	fatalIfErr(err)
@@ -711,17 +749,13 @@ func deleteRecord(ctx context.Context, name string, match string, rtype string,
 	}
 
 	if len(changes) > 0 {
-		req2 := route53.ChangeResourceRecordSetsInput{
-			HostedZoneId: zone.Id,
-			ChangeBatch: &route53types.ChangeBatch{
-				Changes: changes,
-			},
-		}
-		resp, err := r53.ChangeResourceRecordSets(ctx, &req2)
-		fatalIfErr(err)
+		infos := batchChanges(ctx, nil, changes, zone, false)
 		fmt.Printf("%d record sets deleted\n", len(changes))
 		if wait {
-			waitForChange(ctx, resp.ChangeInfo)
+			waitForChanges(ctx, infos)
+		}
+		if verify.enabled {
+			verifyChanges(ctx, zone, nil, changes, verify)
 		}
 	} else {
 		fmt.Println("Warning: no records matched - nothing deleted")
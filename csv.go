@@ -0,0 +1,245 @@
+package cli53
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	route53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/miekg/dns"
+)
+
+// FormatCSV is one row per resource record, for editing in a spreadsheet.
+const FormatCSV = "csv"
+
+// csvColumns are the columns of a record CSV file. On import the header
+// row names the columns, which can be in any order, and only name, type and
+// value (or alias_target) are required.
+var csvColumns = []string{
+	"name", "type", "ttl", "value", "identifier", "weight", "failover", "region",
+	"continent", "country", "subdivision", "multivalue", "health_check_id",
+	"alias_target", "alias_zone_id", "evaluate_target_health",
+}
+
+func formatOptInt(i *int64) string {
+	if i == nil {
+		return ""
+	}
+	return fmt.Sprint(*i)
+}
+
+func formatOptBool(b bool) string {
+	if !b {
+		return ""
+	}
+	return "true"
+}
+
+// csvRows converts a record set to rows, one for each value, or one for an
+// alias.
+func csvRows(entry *recordSetEntry) [][]string {
+	row := map[string]string{
+		"name":            entry.Name,
+		"type":            entry.Type,
+		"ttl":             formatOptInt(entry.TTL),
+		"identifier":      entry.SetIdentifier,
+		"weight":          formatOptInt(entry.Weight),
+		"failover":        entry.Failover,
+		"region":          entry.Region,
+		"multivalue":      formatOptBool(entry.MultiValue),
+		"health_check_id": entry.HealthCheckId,
+	}
+	if geo := entry.GeoLocation; geo != nil {
+		row["continent"] = geo.ContinentCode
+		row["country"] = geo.CountryCode
+		row["subdivision"] = geo.SubdivisionCode
+	}
+	if alias := entry.Alias; alias != nil {
+		row["alias_target"] = alias.Target
+		row["alias_zone_id"] = alias.ZoneId
+		row["evaluate_target_health"] = strconv.FormatBool(alias.EvaluateTargetHealth)
+	}
+	values := entry.Values
+	if len(values) == 0 {
+		values = []string{""}
+	}
+	rows := [][]string{}
+	for _, value := range values {
+		row["value"] = value
+		cells := []string{}
+		for _, column := range csvColumns {
+			cells = append(cells, row[column])
+		}
+		rows = append(rows, cells)
+	}
+	return rows
+}
+
+// writeCSV writes a header row, then a row for each resource record.
+func writeCSV(w io.Writer, zone *route53types.HostedZone, rrsets []*route53types.ResourceRecordSet) error {
+	wr := csv.NewWriter(w)
+	wr.Write(csvColumns)
+	for _, rrset := range rrsets {
+		if rrset.TrafficPolicyInstanceId != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Skipping traffic policy record %s\n", *rrset.Name)
+			continue
+		}
+		wr.WriteAll(csvRows(newRecordSetEntry(rrset, zone)))
+	}
+	wr.Flush()
+	return wr.Error()
+}
+
+func parseOptInt(s string) (*int64, error) {
+	if s == "" {
+		return nil, nil
+	}
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid number '%s'", s)
+	}
+	return &i, nil
+}
+
+func parseOptBool(s string) (bool, error) {
+	if s == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, fmt.Errorf("invalid boolean '%s'", s)
+	}
+	return b, nil
+}
+
+// csvEntry converts a row to a record set with a single value.
+func csvEntry(row map[string]string) (*recordSetEntry, error) {
+	entry := &recordSetEntry{
+		Name:          row["name"],
+		Type:          strings.ToUpper(row["type"]),
+		SetIdentifier: row["identifier"],
+		Failover:      row["failover"],
+		Region:        row["region"],
+		HealthCheckId: row["health_check_id"],
+	}
+	var err error
+	if entry.TTL, err = parseOptInt(row["ttl"]); err != nil {
+		return nil, fmt.Errorf("ttl: %s", err)
+	}
+	if entry.Weight, err = parseOptInt(row["weight"]); err != nil {
+		return nil, fmt.Errorf("weight: %s", err)
+	}
+	if entry.MultiValue, err = parseOptBool(row["multivalue"]); err != nil {
+		return nil, fmt.Errorf("multivalue: %s", err)
+	}
+	if row["value"] != "" {
+		entry.Values = []string{row["value"]}
+	}
+	if row["continent"] != "" || row["country"] != "" || row["subdivision"] != "" {
+		entry.GeoLocation = &geoLocationEntry{row["continent"], row["country"], row["subdivision"]}
+	}
+	if row["alias_target"] != "" {
+		entry.Alias = &aliasEntry{Target: row["alias_target"], ZoneId: row["alias_zone_id"]}
+		if entry.Alias.ZoneId == "" {
+			entry.Alias.ZoneId = "$self"
+		}
+		if entry.Alias.EvaluateTargetHealth, err = parseOptBool(row["evaluate_target_health"]); err != nil {
+			return nil, fmt.Errorf("evaluate_target_health: %s", err)
+		}
+	}
+	return entry, nil
+}
+
+// readCSV reads records from a CSV file, validating each row. Rows are
+// grouped into record sets by name, type and identifier, so the rows of a
+// record set must agree on everything but the value.
+func readCSV(r io.Reader, origin string) ([]dns.RR, error) {
+	rd := csv.NewReader(r)
+	rd.FieldsPerRecord = -1
+	header, err := rd.Read()
+	if err == io.EOF {
+		return []dns.RR{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	known := map[string]bool{}
+	for _, column := range csvColumns {
+		known[column] = true
+	}
+	for i, column := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(column))
+		if !known[header[i]] {
+			return nil, fmt.Errorf("row 1: unknown column '%s'", column)
+		}
+	}
+
+	type seen struct {
+		row   int
+		entry recordSetEntry
+	}
+	first := map[Key]seen{}
+	records := []dns.RR{}
+	for n := 2; ; n++ {
+		cells, err := rd.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if len(cells) > len(header) {
+			return nil, fmt.Errorf("row %d: expected %d columns, found %d", n, len(header), len(cells))
+		}
+		row := map[string]string{}
+		blank := true
+		for i, cell := range cells {
+			row[header[i]] = strings.TrimSpace(cell)
+			blank = blank && row[header[i]] == ""
+		}
+		if blank {
+			continue
+		}
+		entry, err := csvEntry(row)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %s", n, err)
+		}
+		rrset, err := entry.rrset(origin)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %s", n, err)
+		}
+		if entry.Alias == nil {
+			if _, err := dns.NewRR(fmt.Sprintf("%s %d IN %s %s", *rrset.Name, *rrset.TTL, entry.Type, entry.Values[0])); err != nil {
+				return nil, fmt.Errorf("row %d: invalid %s value '%s'", n, entry.Type, entry.Values[0])
+			}
+		}
+		rrs := ConvertRRSetToBind(rrset)
+		if len(rrs) == 0 {
+			return nil, fmt.Errorf("row %d: unsupported type '%s'", n, entry.Type)
+		}
+
+		key := recordKey(rrs[0])
+		entry.Name, entry.Values = *rrset.Name, nil
+		if prev, ok := first[key]; !ok {
+			first[key] = seen{n, *entry}
+		} else if entry.Alias != nil {
+			return nil, fmt.Errorf("row %d: duplicate alias %s %s (row %d)", n, *rrset.Name, entry.Type, prev.row)
+		} else if !reflect.DeepEqual(prev.entry, *entry) {
+			return nil, fmt.Errorf("row %d: %s %s differs from row %d in its ttl or routing", n, *rrset.Name, entry.Type, prev.row)
+		}
+		records = append(records, rrs...)
+	}
+	return records, nil
+}
+
+func exportCSV(ctx context.Context, name string, writer io.Writer) {
+	zone := lookupZone(ctx, name)
+	rrsets, err := ListAllRecordSets(ctx, r53, *zone.Id)
+	fatalIfErr(err)
+	sort.Sort(exportSorter{rrsets, *zone.Name})
+	fatalIfErr(writeCSV(writer, zone, rrsets))
+}
@@ -0,0 +1,64 @@
+package cli53
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteCSV(t *testing.T) {
+	w := &bytes.Buffer{}
+	require.NoError(t, writeCSV(w, testZone, routedRRSets()))
+	lines := strings.Split(strings.TrimSpace(w.String()), "\n")
+	assert.Equal(t, "name,type,ttl,value,identifier,weight,failover,region,continent,country,subdivision,multivalue,health_check_id,alias_target,alias_zone_id,evaluate_target_health", lines[0])
+	assert.Contains(t, lines, `example.com.,TXT,3600,"""v=spf1 -all""",,,,,,,,,,,,`)
+	assert.Contains(t, lines, `example.com.,TXT,3600,"""hello world""",,,,,,,,,,,,`)
+	assert.Contains(t, lines, "w.example.com.,A,3600,127.0.0.1,one,10,,,,,,,,,,")
+}
+
+func TestCSVRoundTrip(t *testing.T) {
+	w := &bytes.Buffer{}
+	require.NoError(t, writeCSV(w, testZone, routedRRSets()))
+	records, err := readCSV(w, "example.com.")
+	require.NoError(t, err)
+	expected, err := rrsetsToRecords(routedRRSets())
+	require.NoError(t, err)
+	// aliases to the zone itself are exported as $self
+	expected[len(expected)-1].(*dns.PrivateRR).Data.(*ALIASRdata).ZoneId = "$self"
+	assert.Equal(t, expected, records)
+}
+
+func TestReadCSV(t *testing.T) {
+	records, err := readCSV(strings.NewReader(`Name,Type,TTL,Value
+www,A,300,127.0.0.1
+www,A,300,127.0.0.2
+,,,
+mail,cname,300,mx.example.net.
+`), "example.com.")
+	require.NoError(t, err)
+	grouped := groupRecords(records)
+	assert.Len(t, grouped, 2)
+	assert.Len(t, grouped[Key{"www.example.com.", dns.TypeA, ""}], 2)
+	assert.Len(t, grouped[Key{"mail.example.com.", dns.TypeCNAME, ""}], 1)
+}
+
+func TestReadCSVErrors(t *testing.T) {
+	tests := []struct {
+		csv string
+		err string
+	}{
+		{"name,type,colour\n", "row 1: unknown column 'colour'"},
+		{"name,type,ttl,value\nwww,A,abc,127.0.0.1\n", "row 2: ttl: invalid number 'abc'"},
+		{"name,type,ttl,value\nwww,A,300,127.0.0.1\nwww,A,300,not-an-ip\n", "row 3: invalid A value 'not-an-ip'"},
+		{"name,type,ttl,value\nwww,A,300,127.0.0.1\nwww,A,60,127.0.0.2\n", "row 3: www.example.com. A differs from row 2 in its ttl or routing"},
+		{"name,type,ttl,value,weight\nwww,A,300,127.0.0.1,10\n", "row 2: www.example.com. A: setIdentifier is required with a routing policy"},
+	}
+	for _, test := range tests {
+		_, err := readCSV(strings.NewReader(test.csv), "example.com.")
+		assert.EqualError(t, err, test.err)
+	}
+}
@@ -0,0 +1,564 @@
+package cli53
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	route53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/miekg/dns"
+	"gopkg.in/yaml.v2"
+)
+
+type ddnsArgs struct {
+	zones   []string
+	listen  string
+	config  string
+	timeout time.Duration
+}
+
+// ddnsConfig is the gateway's config file, listing the TSIG keys updates
+// may be signed with:
+//
+//	keys:
+//	- name: dhcp-key
+//	  algorithm: hmac-sha256
+//	  secret: c2VjcmV0
+//	  zones: [example.com, 2.0.192.in-addr.arpa]
+//
+// A key without zones may update every zone served.
+type ddnsConfig struct {
+	Keys []ddnsKeyConfig `yaml:"keys"`
+}
+
+type ddnsKeyConfig struct {
+	Name      string   `yaml:"name"`
+	Algorithm string   `yaml:"algorithm"`
+	Secret    string   `yaml:"secret"`
+	Zones     []string `yaml:"zones"`
+}
+
+// ddnsKey is a TSIG key and the zones it may update, or nil for all zones.
+type ddnsKey struct {
+	*tsigKey
+	zones map[string]bool
+}
+
+func (k *ddnsKey) allows(zone string) bool {
+	return k.zones == nil || k.zones[zone]
+}
+
+// readDDNSConfig reads the gateway's keys, rejecting unknown fields.
+func readDDNSConfig(r io.Reader) ([]*ddnsKey, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	config := ddnsConfig{}
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, err
+	}
+	if len(config.Keys) == 0 {
+		return nil, errors.New("No keys in config")
+	}
+	keys := []*ddnsKey{}
+	seen := map[string]bool{}
+	for i, k := range config.Keys {
+		if k.Name == "" {
+			return nil, fmt.Errorf("key %d: missing name", i+1)
+		}
+		algorithm := k.Algorithm
+		if algorithm == "" {
+			algorithm = "hmac-sha256"
+		}
+		tsig, err := newTSIGKey(algorithm, k.Name, k.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("key %d: %s", i+1, err)
+		}
+		if seen[tsig.name] {
+			return nil, fmt.Errorf("key %d: duplicate key '%s'", i+1, k.Name)
+		}
+		seen[tsig.name] = true
+		key := &ddnsKey{tsigKey: tsig}
+		if len(k.Zones) > 0 {
+			key.zones = map[string]bool{}
+			for _, zone := range k.Zones {
+				key.zones[dns.Fqdn(strings.ToLower(zone))] = true
+			}
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// ddnsSetKey is a record set as seen over DNS, without route53 routing.
+type ddnsSetKey struct {
+	name   string
+	rrtype uint16
+}
+
+// ddnsSet is the state of a record set while an update is applied.
+type ddnsSet struct {
+	live    *route53types.ResourceRecordSet
+	records []dns.RR
+	ttl     uint32
+	// routed and alias record sets have no plain records, and cannot be
+	// updated over DNS
+	fixed   bool
+	touched bool
+}
+
+func (s *ddnsSet) exists() bool {
+	return s.fixed || len(s.records) > 0
+}
+
+func (s *ddnsSet) contains(rr dns.RR) bool {
+	for _, record := range s.records {
+		if dns.IsDuplicate(record, rr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ddnsZone is the state of a zone while an update is applied.
+type ddnsZone struct {
+	origin string
+	sets   map[ddnsSetKey]*ddnsSet
+}
+
+func newDDNSZone(zone *route53types.HostedZone, rrsets []*route53types.ResourceRecordSet) *ddnsZone {
+	z := &ddnsZone{origin: strings.ToLower(unescaper.Replace(*zone.Name)), sets: map[ddnsSetKey]*ddnsSet{}}
+	for _, rrset := range rrsets {
+		name := strings.ToLower(unescaper.Replace(*rrset.Name))
+		key := ddnsSetKey{name, dns.StringToType[string(rrset.Type)]}
+		set := z.set(key)
+		if rrset.SetIdentifier != nil || rrset.AliasTarget != nil || rrset.TrafficPolicyInstanceId != nil {
+			set.fixed = true
+			continue
+		}
+		set.live = rrset
+		set.ttl = uint32(*rrset.TTL)
+		for _, rr := range ConvertRRSetToBind(rrset) {
+			rr.Header().Name = name
+			set.records = append(set.records, rr)
+		}
+	}
+	return z
+}
+
+func (z *ddnsZone) set(key ddnsSetKey) *ddnsSet {
+	set := z.sets[key]
+	if set == nil {
+		set = &ddnsSet{}
+		z.sets[key] = set
+	}
+	return set
+}
+
+func (z *ddnsZone) nameInUse(name string) bool {
+	for key, set := range z.sets {
+		if key.name == name && set.exists() {
+			return true
+		}
+	}
+	return false
+}
+
+// protected reports whether a record set is managed by route53: the SOA
+// and NS records at the apex.
+func (z *ddnsZone) protected(key ddnsSetKey) bool {
+	return key.name == z.origin && (key.rrtype == dns.TypeSOA || key.rrtype == dns.TypeNS)
+}
+
+// checkPrerequisites checks the prerequisite section of an update, as RFC
+// 2136 section 3.2.
+func (z *ddnsZone) checkPrerequisites(prereqs []dns.RR) int {
+	values := map[ddnsSetKey][]dns.RR{}
+	for _, rr := range prereqs {
+		hdr := rr.Header()
+		name := strings.ToLower(hdr.Name)
+		if hdr.Ttl != 0 {
+			return dns.RcodeFormatError
+		}
+		if !dns.IsSubDomain(z.origin, name) {
+			return dns.RcodeNotZone
+		}
+		key := ddnsSetKey{name, hdr.Rrtype}
+		switch hdr.Class {
+		case dns.ClassANY:
+			if hdr.Rrtype == dns.TypeANY {
+				if !z.nameInUse(name) {
+					return dns.RcodeNameError
+				}
+			} else if set := z.sets[key]; set == nil || !set.exists() {
+				return dns.RcodeNXRrset
+			}
+		case dns.ClassNONE:
+			if hdr.Rrtype == dns.TypeANY {
+				if z.nameInUse(name) {
+					return dns.RcodeYXDomain
+				}
+			} else if set := z.sets[key]; set != nil && set.exists() {
+				return dns.RcodeYXRrset
+			}
+		case dns.ClassINET:
+			values[key] = append(values[key], inClass(rr))
+		default:
+			return dns.RcodeFormatError
+		}
+	}
+	for key, rrs := range values {
+		set := z.sets[key]
+		if set == nil || set.fixed {
+			return dns.RcodeNXRrset
+		}
+		for _, rr := range rrs {
+			if !set.contains(rr) {
+				return dns.RcodeNXRrset
+			}
+		}
+		for _, record := range set.records {
+			found := false
+			for _, rr := range rrs {
+				found = found || dns.IsDuplicate(record, rr)
+			}
+			if !found {
+				return dns.RcodeNXRrset
+			}
+		}
+	}
+	return dns.RcodeSuccess
+}
+
+// inClass copies a record with its class set to IN, so it can be compared
+// with the zone's records.
+func inClass(rr dns.RR) dns.RR {
+	rr = dns.Copy(rr)
+	rr.Header().Class = dns.ClassINET
+	rr.Header().Name = strings.ToLower(rr.Header().Name)
+	return rr
+}
+
+// applyUpdates applies the update section of an update, as RFC 2136
+// section 3.4.2. Updates to SOA records and the apex NS records, which
+// route53 manages, and CNAME records that would conflict with other data,
+// are ignored.
+func (z *ddnsZone) applyUpdates(updates []dns.RR) int {
+	for _, rr := range updates {
+		hdr := rr.Header()
+		name := strings.ToLower(hdr.Name)
+		if !dns.IsSubDomain(z.origin, name) {
+			return dns.RcodeNotZone
+		}
+		switch hdr.Rrtype {
+		case dns.TypeAXFR, dns.TypeIXFR, dns.TypeMAILA, dns.TypeMAILB:
+			return dns.RcodeFormatError
+		}
+		key := ddnsSetKey{name, hdr.Rrtype}
+		switch hdr.Class {
+		case dns.ClassINET:
+			if hdr.Rrtype == dns.TypeANY {
+				return dns.RcodeFormatError
+			}
+			if z.protected(key) || hdr.Rrtype == dns.TypeSOA {
+				continue
+			}
+			if _, alias := rr.(*dns.PrivateRR); alias || !supportedRecord(rr) {
+				return dns.RcodeRefused
+			}
+			if z.cnameConflict(key) {
+				continue
+			}
+			set := z.set(key)
+			if set.fixed {
+				return dns.RcodeRefused
+			}
+			rr = inClass(rr)
+			set.ttl = hdr.Ttl
+			set.touched = true
+			if !set.contains(rr) {
+				if hdr.Rrtype == dns.TypeCNAME {
+					set.records = nil
+				}
+				set.records = append(set.records, rr)
+			}
+		case dns.ClassANY:
+			if hdr.Ttl != 0 {
+				return dns.RcodeFormatError
+			}
+			for k, set := range z.sets {
+				if k.name != name || (hdr.Rrtype != dns.TypeANY && k.rrtype != hdr.Rrtype) || z.protected(k) || !set.exists() {
+					continue
+				}
+				if set.fixed {
+					return dns.RcodeRefused
+				}
+				set.records = nil
+				set.touched = true
+			}
+		case dns.ClassNONE:
+			if hdr.Ttl != 0 || hdr.Rrtype == dns.TypeANY {
+				return dns.RcodeFormatError
+			}
+			set := z.sets[key]
+			if z.protected(key) || set == nil || !set.exists() {
+				continue
+			}
+			if set.fixed {
+				return dns.RcodeRefused
+			}
+			rr = inClass(rr)
+			records := []dns.RR{}
+			for _, record := range set.records {
+				if !dns.IsDuplicate(record, rr) {
+					records = append(records, record)
+				}
+			}
+			set.records = records
+			set.touched = true
+		default:
+			return dns.RcodeFormatError
+		}
+	}
+	return dns.RcodeSuccess
+}
+
+// cnameConflict reports whether adding to a record set would put a CNAME
+// alongside other data at its name.
+func (z *ddnsZone) cnameConflict(key ddnsSetKey) bool {
+	for k, set := range z.sets {
+		if k.name != key.name || k.rrtype == key.rrtype || !set.exists() {
+			continue
+		}
+		if k.rrtype == dns.TypeCNAME || key.rrtype == dns.TypeCNAME {
+			return true
+		}
+	}
+	return false
+}
+
+// changes returns the route53 changes for the record sets updated: each
+// changed record set is deleted and created again.
+func (z *ddnsZone) changes() (additions, deletions []route53types.Change) {
+	keys := []ddnsSetKey{}
+	for key, set := range z.sets {
+		if set.touched {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].name != keys[j].name {
+			return keys[i].name < keys[j].name
+		}
+		return keys[i].rrtype < keys[j].rrtype
+	})
+	additions = []route53types.Change{}
+	deletions = []route53types.Change{}
+	for _, key := range keys {
+		set := z.sets[key]
+		var rrset *route53types.ResourceRecordSet
+		if len(set.records) > 0 {
+			for _, rr := range set.records {
+				rr.Header().Ttl = set.ttl
+			}
+			rrset = ConvertBindToRRSet(set.records)
+		}
+		if set.live != nil && rrset != nil && sameValues(set.live, rrset) {
+			continue
+		}
+		if set.live != nil {
+			deletions = append(deletions, route53types.Change{
+				Action:            route53types.ChangeActionDelete,
+				ResourceRecordSet: set.live,
+			})
+		}
+		if rrset != nil {
+			additions = append(additions, route53types.Change{
+				Action:            route53types.ChangeActionCreate,
+				ResourceRecordSet: rrset,
+			})
+		}
+	}
+	return additions, deletions
+}
+
+// sameValues reports whether two record sets have the same TTL and values.
+func sameValues(a, b *route53types.ResourceRecordSet) bool {
+	if *a.TTL != *b.TTL || len(a.ResourceRecords) != len(b.ResourceRecords) {
+		return false
+	}
+	values := map[string]bool{}
+	for _, rr := range a.ResourceRecords {
+		values[*rr.Value] = true
+	}
+	for _, rr := range b.ResourceRecords {
+		if !values[*rr.Value] {
+			return false
+		}
+	}
+	return true
+}
+
+// planUpdate checks the prerequisites of a DNS UPDATE against the zone's
+// record sets, and returns the changes that apply its updates, or the
+// rcode to reply with if it cannot be applied.
+func planUpdate(zone *route53types.HostedZone, rrsets []*route53types.ResourceRecordSet, req *dns.Msg) (additions, deletions []route53types.Change, rcode int) {
+	z := newDDNSZone(zone, rrsets)
+	if rcode := z.checkPrerequisites(req.Answer); rcode != dns.RcodeSuccess {
+		return nil, nil, rcode
+	}
+	if rcode := z.applyUpdates(req.Ns); rcode != dns.RcodeSuccess {
+		return nil, nil, rcode
+	}
+	additions, deletions = z.changes()
+	return additions, deletions, dns.RcodeSuccess
+}
+
+// ddnsGateway applies signed DNS UPDATE messages to route53 zones. Updates
+// to a zone are applied one at a time.
+type ddnsGateway struct {
+	zones   map[string]*route53types.HostedZone
+	locks   map[string]*sync.Mutex
+	keys    map[string]*ddnsKey
+	timeout time.Duration
+}
+
+// authorized returns the rcode for a request not signed with a key allowed
+// to update the zone, or success.
+func (g *ddnsGateway) authorized(w dns.ResponseWriter, req *dns.Msg, zone string) int {
+	tsig := req.IsTsig()
+	if tsig == nil {
+		return dns.RcodeRefused
+	}
+	if w.TsigStatus() != nil {
+		return dns.RcodeNotAuth
+	}
+	key := g.keys[strings.ToLower(tsig.Hdr.Name)]
+	if key == nil || !key.allows(zone) {
+		return dns.RcodeRefused
+	}
+	return dns.RcodeSuccess
+}
+
+func (g *ddnsGateway) update(zone *route53types.HostedZone, req *dns.Msg) int {
+	ctx, cancel := context.Background(), func() {}
+	if g.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, g.timeout)
+	}
+	defer cancel()
+	rrsets, err := ListAllRecordSets(ctx, r53, *zone.Id)
+	if err != nil {
+		log.Printf("Listing %s failed: %s", *zone.Name, err)
+		return dns.RcodeServerFailure
+	}
+	additions, deletions, rcode := planUpdate(zone, rrsets, req)
+	if rcode != dns.RcodeSuccess || len(additions)+len(deletions) == 0 {
+		return rcode
+	}
+	if _, err := submitChanges(ctx, additions, deletions, zone, false); err != nil {
+		log.Printf("Updating %s failed: %s", *zone.Name, err)
+		return dns.RcodeServerFailure
+	}
+	for _, change := range append(deletions, additions...) {
+		log.Printf("%s %s %s", change.Action, *change.ResourceRecordSet.Name, change.ResourceRecordSet.Type)
+	}
+	return dns.RcodeSuccess
+}
+
+func (g *ddnsGateway) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	if req.Opcode != dns.OpcodeUpdate {
+		writeReply(w, req, dns.RcodeNotImplemented)
+		return
+	}
+	if len(req.Question) != 1 || req.Question[0].Qtype != dns.TypeSOA {
+		writeReply(w, req, dns.RcodeFormatError)
+		return
+	}
+	name := strings.ToLower(req.Question[0].Name)
+	zone := g.zones[name]
+	if zone == nil {
+		writeReply(w, req, dns.RcodeNotAuth)
+		return
+	}
+	if rcode := g.authorized(w, req, name); rcode != dns.RcodeSuccess {
+		log.Printf("Refused update of %s from %s", name, w.RemoteAddr())
+		writeReply(w, req, rcode)
+		return
+	}
+	g.locks[name].Lock()
+	rcode := g.update(zone, req)
+	g.locks[name].Unlock()
+	if rcode != dns.RcodeSuccess {
+		log.Printf("Update of %s from %s failed: %s", name, w.RemoteAddr(), dns.RcodeToString[rcode])
+	}
+	writeReply(w, req, rcode)
+}
+
+func newDDNSGateway(ctx context.Context, args ddnsArgs) (*ddnsGateway, error) {
+	f, err := os.Open(args.config)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	keys, err := readDDNSConfig(f)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid config %s: %s", args.config, err)
+	}
+	g := &ddnsGateway{
+		zones:   map[string]*route53types.HostedZone{},
+		locks:   map[string]*sync.Mutex{},
+		keys:    map[string]*ddnsKey{},
+		timeout: args.timeout,
+	}
+	for _, key := range keys {
+		g.keys[key.name] = key
+	}
+	for _, nameOrId := range args.zones {
+		zone, err := findZone(ctx, nameOrId)
+		if err != nil {
+			return nil, err
+		}
+		name := strings.ToLower(unescaper.Replace(*zone.Name))
+		g.zones[name] = zone
+		g.locks[name] = &sync.Mutex{}
+	}
+	return g, nil
+}
+
+func (g *ddnsGateway) tsigKeys() []*tsigKey {
+	keys := []*tsigKey{}
+	for _, key := range g.keys {
+		keys = append(keys, key.tsigKey)
+	}
+	return keys
+}
+
+// runDDNSGateway serves DNS UPDATE over UDP and TCP until the context is
+// done.
+func runDDNSGateway(ctx context.Context, args ddnsArgs) error {
+	g, err := newDDNSGateway(ctx, args)
+	if err != nil {
+		return err
+	}
+	servers, err := startDNSServers(args.listen, g, tsigSecrets(g.tsigKeys()))
+	if err != nil {
+		return err
+	}
+	defer servers.shutdown()
+	log.Printf("Accepting updates to %d zones on %s", len(g.zones), args.listen)
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-servers.errs:
+		return err
+	}
+}
@@ -0,0 +1,175 @@
+package cli53
+
+import (
+	"strings"
+	"testing"
+
+	route53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testDDNSRRSets() []*route53types.ResourceRecordSet {
+	weighted := routed(testRRSet("lb.example.com.", route53types.RRTypeA, "192.0.2.9"), "one")
+	return []*route53types.ResourceRecordSet{
+		testRRSet("example.com.", route53types.RRTypeSoa, testSOA),
+		testRRSet("example.com.", route53types.RRTypeNs, "ns-1.awsdns-1.com."),
+		testRRSet("www.example.com.", route53types.RRTypeA, "192.0.2.1", "192.0.2.2"),
+		testRRSet("mail.example.com.", route53types.RRTypeCname, "www.example.com."),
+		weighted,
+	}
+}
+
+func testUpdate(t *testing.T, prereqs []string, insert []string, remove func(m *dns.Msg)) *dns.Msg {
+	m := &dns.Msg{}
+	m.SetUpdate("example.com.")
+	for _, s := range prereqs {
+		rr, err := dns.NewRR(s)
+		require.NoError(t, err)
+		m.Used([]dns.RR{rr})
+	}
+	for _, s := range insert {
+		rr, err := dns.NewRR(s)
+		require.NoError(t, err)
+		m.Insert([]dns.RR{rr})
+	}
+	if remove != nil {
+		remove(m)
+	}
+	return m
+}
+
+func changeStrings(changes []route53types.Change) []string {
+	ret := []string{}
+	for _, change := range changes {
+		rrset := change.ResourceRecordSet
+		values := []string{}
+		for _, rr := range rrset.ResourceRecords {
+			values = append(values, *rr.Value)
+		}
+		ret = append(ret, string(change.Action)+" "+*rrset.Name+" "+string(rrset.Type)+" "+strings.Join(values, ","))
+	}
+	return ret
+}
+
+func TestPlanUpdateAdd(t *testing.T) {
+	req := testUpdate(t, nil, []string{
+		"www.example.com. 300 IN A 192.0.2.3",
+		"host.example.com. 300 IN A 192.0.2.4",
+		"host.example.com. 300 IN A 192.0.2.4",
+	}, nil)
+	additions, deletions, rcode := planUpdate(testZone, testDDNSRRSets(), req)
+	assert.Equal(t, dns.RcodeSuccess, rcode)
+	assert.Equal(t, []string{
+		"CREATE host.example.com. A 192.0.2.4",
+		"CREATE www.example.com. A 192.0.2.1,192.0.2.2,192.0.2.3",
+	}, changeStrings(additions))
+	assert.Equal(t, []string{"DELETE www.example.com. A 192.0.2.1,192.0.2.2"}, changeStrings(deletions))
+	assert.Equal(t, int64(300), *additions[1].ResourceRecordSet.TTL)
+}
+
+func TestPlanUpdateDelete(t *testing.T) {
+	rr, err := dns.NewRR("www.example.com. 0 IN A 192.0.2.1")
+	require.NoError(t, err)
+	req := testUpdate(t, nil, nil, func(m *dns.Msg) {
+		m.Remove([]dns.RR{rr})
+		m.RemoveRRset([]dns.RR{&dns.ANY{Hdr: dns.RR_Header{Name: "mail.example.com.", Rrtype: dns.TypeCNAME}}})
+	})
+	additions, deletions, rcode := planUpdate(testZone, testDDNSRRSets(), req)
+	assert.Equal(t, dns.RcodeSuccess, rcode)
+	assert.Equal(t, []string{"CREATE www.example.com. A 192.0.2.2"}, changeStrings(additions))
+	assert.Equal(t, []string{
+		"DELETE mail.example.com. CNAME www.example.com.",
+		"DELETE www.example.com. A 192.0.2.1,192.0.2.2",
+	}, changeStrings(deletions))
+
+	// the apex SOA and NS records are left alone
+	req = testUpdate(t, nil, nil, func(m *dns.Msg) {
+		m.RemoveName([]dns.RR{&dns.ANY{Hdr: dns.RR_Header{Name: "example.com."}}})
+	})
+	additions, deletions, rcode = planUpdate(testZone, testDDNSRRSets(), req)
+	assert.Equal(t, dns.RcodeSuccess, rcode)
+	assert.Empty(t, additions)
+	assert.Empty(t, deletions)
+}
+
+func TestPlanUpdateUnchanged(t *testing.T) {
+	req := testUpdate(t, nil, []string{"www.example.com. 3600 IN A 192.0.2.1"}, nil)
+	additions, deletions, rcode := planUpdate(testZone, testDDNSRRSets(), req)
+	assert.Equal(t, dns.RcodeSuccess, rcode)
+	assert.Empty(t, additions)
+	assert.Empty(t, deletions)
+}
+
+func TestPlanUpdatePrerequisites(t *testing.T) {
+	rcode := func(prereqs func(m *dns.Msg)) int {
+		req := testUpdate(t, nil, []string{"new.example.com. 300 IN A 192.0.2.5"}, prereqs)
+		_, _, rcode := planUpdate(testZone, testDDNSRRSets(), req)
+		return rcode
+	}
+	name := func(name string) []dns.RR {
+		return []dns.RR{&dns.ANY{Hdr: dns.RR_Header{Name: name}}}
+	}
+	rrset := func(name string, rrtype uint16) []dns.RR {
+		return []dns.RR{&dns.ANY{Hdr: dns.RR_Header{Name: name, Rrtype: rrtype}}}
+	}
+	assert.Equal(t, dns.RcodeSuccess, rcode(func(m *dns.Msg) { m.NameUsed(name("www.example.com.")) }))
+	assert.Equal(t, dns.RcodeNameError, rcode(func(m *dns.Msg) { m.NameUsed(name("nope.example.com.")) }))
+	assert.Equal(t, dns.RcodeSuccess, rcode(func(m *dns.Msg) { m.NameNotUsed(name("new.example.com.")) }))
+	assert.Equal(t, dns.RcodeYXDomain, rcode(func(m *dns.Msg) { m.NameNotUsed(name("lb.example.com.")) }))
+	assert.Equal(t, dns.RcodeSuccess, rcode(func(m *dns.Msg) { m.RRsetUsed(rrset("lb.example.com.", dns.TypeA)) }))
+	assert.Equal(t, dns.RcodeNXRrset, rcode(func(m *dns.Msg) { m.RRsetUsed(rrset("www.example.com.", dns.TypeAAAA)) }))
+	assert.Equal(t, dns.RcodeSuccess, rcode(func(m *dns.Msg) { m.RRsetNotUsed(rrset("www.example.com.", dns.TypeAAAA)) }))
+	assert.Equal(t, dns.RcodeYXRrset, rcode(func(m *dns.Msg) { m.RRsetNotUsed(rrset("www.example.com.", dns.TypeA)) }))
+	assert.Equal(t, dns.RcodeNotZone, rcode(func(m *dns.Msg) { m.NameUsed(name("www.example.org.")) }))
+
+	// value dependent prerequisites must match the whole record set
+	req := testUpdate(t, []string{"www.example.com. 0 IN A 192.0.2.1", "www.example.com. 0 IN A 192.0.2.2"}, nil, nil)
+	_, _, code := planUpdate(testZone, testDDNSRRSets(), req)
+	assert.Equal(t, dns.RcodeSuccess, code)
+	req = testUpdate(t, []string{"www.example.com. 0 IN A 192.0.2.1"}, nil, nil)
+	_, _, code = planUpdate(testZone, testDDNSRRSets(), req)
+	assert.Equal(t, dns.RcodeNXRrset, code)
+}
+
+func TestPlanUpdateRefused(t *testing.T) {
+	// routed record sets cannot be updated
+	req := testUpdate(t, nil, []string{"lb.example.com. 300 IN A 192.0.2.6"}, nil)
+	_, _, rcode := planUpdate(testZone, testDDNSRRSets(), req)
+	assert.Equal(t, dns.RcodeRefused, rcode)
+
+	req = testUpdate(t, nil, []string{"www.example.org. 300 IN A 192.0.2.6"}, nil)
+	_, _, rcode = planUpdate(testZone, testDDNSRRSets(), req)
+	assert.Equal(t, dns.RcodeNotZone, rcode)
+
+	// a CNAME cannot be added alongside other data
+	req = testUpdate(t, nil, []string{"www.example.com. 300 IN CNAME mail.example.com."}, nil)
+	additions, deletions, rcode := planUpdate(testZone, testDDNSRRSets(), req)
+	assert.Equal(t, dns.RcodeSuccess, rcode)
+	assert.Empty(t, additions)
+	assert.Empty(t, deletions)
+}
+
+func TestReadDDNSConfig(t *testing.T) {
+	keys, err := readDDNSConfig(strings.NewReader(`keys:
+- name: dhcp-key
+  secret: c2VjcmV0
+  zones: [Example.com]
+- name: admin-key
+  algorithm: hmac-sha512
+  secret: c2VjcmV0
+`))
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	assert.Equal(t, &tsigKey{"dhcp-key.", dns.HmacSHA256, "c2VjcmV0"}, keys[0].tsigKey)
+	assert.True(t, keys[0].allows("example.com."))
+	assert.False(t, keys[0].allows("example.org."))
+	assert.Equal(t, dns.HmacSHA512, keys[1].algorithm)
+	assert.True(t, keys[1].allows("example.org."))
+
+	_, err = readDDNSConfig(strings.NewReader("keys:\n- name: k\n  secret: c2VjcmV0\n  zone: example.com\n"))
+	assert.Error(t, err)
+	_, err = readDDNSConfig(strings.NewReader("keys:\n- name: k\n  algorithm: hmac-md4\n  secret: c2VjcmV0\n"))
+	assert.EqualError(t, err, "key 1: Unsupported TSIG algorithm 'hmac-md4'")
+}
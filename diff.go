@@ -0,0 +1,159 @@
+package cli53
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	route53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+type diffArgs struct {
+	origin string
+	from   string
+	to     string
+}
+
+// rrsetIdentity identifies a record set in the same way route53 does - by
+// name, type and (for routed records) set identifier.
+type rrsetIdentity struct {
+	Name       string
+	Type       route53types.RRType
+	Identifier string
+}
+
+func identityOf(rrset *route53types.ResourceRecordSet) rrsetIdentity {
+	return rrsetIdentity{
+		Name:       strings.ToLower(*rrset.Name),
+		Type:       rrset.Type,
+		Identifier: aws.ToString(rrset.SetIdentifier),
+	}
+}
+
+func (id rrsetIdentity) String() string {
+	if id.Identifier != "" {
+		return fmt.Sprintf("%s %s %s", id.Name, id.Type, id.Identifier)
+	}
+	return fmt.Sprintf("%s %s", id.Name, id.Type)
+}
+
+// canonicalRRSet returns a representation of every field of the record set,
+// independent of the order of its values.
+func canonicalRRSet(rrset *route53types.ResourceRecordSet) string {
+	c := *rrset
+	c.Name = aws.String(strings.ToLower(*rrset.Name))
+	c.ResourceRecords = append([]route53types.ResourceRecord{}, rrset.ResourceRecords...)
+	sort.Slice(c.ResourceRecords, func(i, j int) bool {
+		return aws.ToString(c.ResourceRecords[i].Value) < aws.ToString(c.ResourceRecords[j].Value)
+	})
+	data, err := json.Marshal(c)
+	fatalIfErr(err)
+	return string(data)
+}
+
+type rrsetModification struct {
+	Old *route53types.ResourceRecordSet
+	New *route53types.ResourceRecordSet
+}
+
+type rrsetDiff struct {
+	Added    []*route53types.ResourceRecordSet
+	Removed  []*route53types.ResourceRecordSet
+	Modified []rrsetModification
+}
+
+func (d rrsetDiff) empty() bool {
+	return len(d.Added)+len(d.Removed)+len(d.Modified) == 0
+}
+
+func sortRRSets(rrsets []*route53types.ResourceRecordSet) {
+	sort.Slice(rrsets, func(i, j int) bool {
+		return identityOf(rrsets[i]).String() < identityOf(rrsets[j]).String()
+	})
+}
+
+// diffRecordSets compares two sets of record sets by identity, reporting
+// those added, removed and modified going from a to b.
+func diffRecordSets(a, b []*route53types.ResourceRecordSet) rrsetDiff {
+	from := map[rrsetIdentity]*route53types.ResourceRecordSet{}
+	for _, rrset := range a {
+		from[identityOf(rrset)] = rrset
+	}
+
+	var diff rrsetDiff
+	for _, rrset := range b {
+		id := identityOf(rrset)
+		if old, ok := from[id]; ok {
+			if canonicalRRSet(old) != canonicalRRSet(rrset) {
+				diff.Modified = append(diff.Modified, rrsetModification{old, rrset})
+			}
+			delete(from, id)
+		} else {
+			diff.Added = append(diff.Added, rrset)
+		}
+	}
+	for _, rrset := range from {
+		diff.Removed = append(diff.Removed, rrset)
+	}
+
+	sortRRSets(diff.Added)
+	sortRRSets(diff.Removed)
+	sort.Slice(diff.Modified, func(i, j int) bool {
+		return identityOf(diff.Modified[i].New).String() < identityOf(diff.Modified[j].New).String()
+	})
+	return diff
+}
+
+func printRRSet(w io.Writer, prefix string, rrset *route53types.ResourceRecordSet) {
+	for _, rr := range ConvertRRSetToBind(rrset) {
+		fmt.Fprintf(w, "%s%s\n", prefix, rr.String())
+	}
+}
+
+func printDiff(w io.Writer, diff rrsetDiff) {
+	for _, rrset := range diff.Added {
+		printRRSet(w, "+ ", rrset)
+	}
+	for _, rrset := range diff.Removed {
+		printRRSet(w, "- ", rrset)
+	}
+	for _, mod := range diff.Modified {
+		fmt.Fprintf(w, "~ %s\n", identityOf(mod.New))
+		printRRSet(w, "  - ", mod.Old)
+		printRRSet(w, "  + ", mod.New)
+	}
+	fmt.Fprintf(w, "%d added, %d removed, %d modified\n", len(diff.Added), len(diff.Removed), len(diff.Modified))
+}
+
+// readZoneFileRRSets parses a bind zone file into route53 record sets.
+func readZoneFileRRSets(filename, origin string) []*route53types.ResourceRecordSet {
+	reader, closer := openInput(filename)
+	defer closer()
+
+	records := parseBindFile(reader, filename, origin)
+	rrsets := []*route53types.ResourceRecordSet{}
+	for _, values := range groupRecords(records) {
+		if rrset := ConvertBindToRRSet(values); rrset != nil {
+			rrsets = append(rrsets, rrset)
+		}
+	}
+	return rrsets
+}
+
+func diffZoneFiles(args diffArgs, w io.Writer) {
+	origin := dnsOrigin(args.origin)
+	from := readZoneFileRRSets(args.from, origin)
+	to := readZoneFileRRSets(args.to, origin)
+	printDiff(w, diffRecordSets(from, to))
+}
+
+// dnsOrigin returns a fully qualified origin, defaulting to the root.
+func dnsOrigin(origin string) string {
+	if origin == "" {
+		return "."
+	}
+	return absolute(origin)
+}
@@ -0,0 +1,51 @@
+package cli53
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	route53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func zoneRRSets(t *testing.T, text string) []*route53types.ResourceRecordSet {
+	records, err := parseBindFileErr(strings.NewReader(text), "", "example.com.")
+	require.NoError(t, err)
+	rrsets := []*route53types.ResourceRecordSet{}
+	for _, values := range groupRecords(records) {
+		rrsets = append(rrsets, ConvertBindToRRSet(values))
+	}
+	return rrsets
+}
+
+func TestDiffRecordSetsReordered(t *testing.T) {
+	a := zoneRRSets(t, "a 300 IN A 127.0.0.1\na 300 IN A 127.0.0.2\nb 300 IN TXT \"x\"\n")
+	b := zoneRRSets(t, "b 300 IN TXT \"x\"\na 300 IN A 127.0.0.2\na 300 IN A 127.0.0.1\n")
+	assert.True(t, diffRecordSets(a, b).empty())
+}
+
+func TestDiffRecordSetsChanges(t *testing.T) {
+	a := zoneRRSets(t, `a 300 IN A 127.0.0.1
+b 300 IN A 127.0.0.2
+w 300 IN A 127.0.0.3 ; AWS routing="WEIGHTED" weight=1 identifier="One"
+`)
+	b := zoneRRSets(t, `a 600 IN A 127.0.0.1
+c 300 IN A 127.0.0.4
+w 300 IN A 127.0.0.3 ; AWS routing="WEIGHTED" weight=5 identifier="One"
+`)
+	diff := diffRecordSets(a, b)
+	require.Len(t, diff.Added, 1)
+	assert.Equal(t, "c.example.com.", *diff.Added[0].Name)
+	require.Len(t, diff.Removed, 1)
+	assert.Equal(t, "b.example.com.", *diff.Removed[0].Name)
+	require.Len(t, diff.Modified, 2)
+	assert.Equal(t, "a.example.com. A", identityOf(diff.Modified[0].New).String())
+	assert.Equal(t, "w.example.com. A One", identityOf(diff.Modified[1].New).String())
+
+	w := &bytes.Buffer{}
+	printDiff(w, diff)
+	assert.Contains(t, w.String(), `+ w.example.com.	300	IN	A	127.0.0.3 ; AWS routing="WEIGHTED" weight=5 identifier="One"`)
+	assert.Contains(t, w.String(), "1 added, 1 removed, 2 modified\n")
+}
@@ -0,0 +1,124 @@
+package cli53
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// tsigKey is a TSIG key for signing DNS messages.
+type tsigKey struct {
+	name      string
+	algorithm string
+	secret    string
+}
+
+var tsigAlgorithms = map[string]string{
+	"hmac-sha1":   dns.HmacSHA1,
+	"hmac-sha224": dns.HmacSHA224,
+	"hmac-sha256": dns.HmacSHA256,
+	"hmac-sha384": dns.HmacSHA384,
+	"hmac-sha512": dns.HmacSHA512,
+}
+
+func newTSIGKey(algorithm, name, secret string) (*tsigKey, error) {
+	alg, ok := tsigAlgorithms[strings.ToLower(algorithm)]
+	if !ok {
+		return nil, fmt.Errorf("Unsupported TSIG algorithm '%s'", algorithm)
+	}
+	if _, err := base64.StdEncoding.DecodeString(secret); err != nil || secret == "" {
+		return nil, fmt.Errorf("Invalid TSIG secret for key '%s'", name)
+	}
+	return &tsigKey{dns.Fqdn(strings.ToLower(name)), alg, secret}, nil
+}
+
+// parseTSIGKey parses a key given as [algorithm:]name:secret, as for dig -y.
+// The algorithm defaults to hmac-sha256.
+func parseTSIGKey(s string) (*tsigKey, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) == 2 {
+		parts = append([]string{"hmac-sha256"}, parts...)
+	}
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("Invalid TSIG key '%s', expected [algorithm:]name:secret", s)
+	}
+	return newTSIGKey(parts[0], parts[1], parts[2])
+}
+
+// tsigSecrets returns the secrets of keys by name, for dns.Server and
+// dns.Client, or nil if there are none.
+func tsigSecrets(keys []*tsigKey) map[string]string {
+	if len(keys) == 0 {
+		return nil
+	}
+	secrets := map[string]string{}
+	for _, key := range keys {
+		secrets[key.name] = key.secret
+	}
+	return secrets
+}
+
+func remoteIP(addr net.Addr) net.IP {
+	switch addr := addr.(type) {
+	case *net.TCPAddr:
+		return addr.IP
+	case *net.UDPAddr:
+		return addr.IP
+	}
+	return nil
+}
+
+// writeReply replies to a request, signing the reply if the request was
+// signed with a valid key.
+func writeReply(w dns.ResponseWriter, req *dns.Msg, rcode int, answer ...dns.RR) {
+	m := &dns.Msg{}
+	m.SetRcode(req, rcode)
+	m.Authoritative = rcode == dns.RcodeSuccess
+	m.Answer = answer
+	if tsig := req.IsTsig(); tsig != nil && w.TsigStatus() == nil {
+		m.SetTsig(tsig.Hdr.Name, tsig.Algorithm, tsig.Fudge, time.Now().Unix())
+	}
+	w.WriteMsg(m)
+}
+
+// dnsServers are a handler's UDP and TCP servers. errs receives an error if
+// either stops.
+type dnsServers struct {
+	servers []*dns.Server
+	errs    chan error
+}
+
+// startDNSServers listens on an address over UDP and TCP, returning once
+// both are ready.
+func startDNSServers(listen string, handler dns.Handler, secrets map[string]string) (*dnsServers, error) {
+	s := &dnsServers{errs: make(chan error, 2)}
+	for _, network := range []string{"udp", "tcp"} {
+		started := make(chan struct{})
+		server := &dns.Server{
+			Addr:              listen,
+			Net:               network,
+			Handler:           handler,
+			TsigSecret:        secrets,
+			NotifyStartedFunc: func() { close(started) },
+		}
+		go func() { s.errs <- server.ListenAndServe() }()
+		select {
+		case <-started:
+		case err := <-s.errs:
+			s.shutdown()
+			return nil, err
+		}
+		s.servers = append(s.servers, server)
+	}
+	return s, nil
+}
+
+func (s *dnsServers) shutdown() {
+	for _, server := range s.servers {
+		server.Shutdown()
+	}
+}
@@ -0,0 +1,91 @@
+package cli53
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	route53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+// Exit code returned by drift when the zone differs from the file.
+const DriftExitCode = 2
+
+type driftArgs struct {
+	name     string
+	file     string
+	editauth bool
+	output   string
+}
+
+// driftReport lists the record sets that differ between a zone file and the
+// live zone: missing are in the file only, unexpected are live only.
+type driftReport struct {
+	ZoneId     string                            `json:"zoneId"`
+	ZoneName   string                            `json:"zoneName"`
+	InSync     bool                              `json:"inSync"`
+	Missing    []*route53types.ResourceRecordSet `json:"missing"`
+	Unexpected []*route53types.ResourceRecordSet `json:"unexpected"`
+}
+
+func newDriftReport(zone *route53types.HostedZone, additions, deletions []route53types.Change) *driftReport {
+	report := &driftReport{
+		ZoneId:     *zone.Id,
+		ZoneName:   *zone.Name,
+		InSync:     len(additions)+len(deletions) == 0,
+		Missing:    []*route53types.ResourceRecordSet{},
+		Unexpected: []*route53types.ResourceRecordSet{},
+	}
+	for _, change := range additions {
+		report.Missing = append(report.Missing, change.ResourceRecordSet)
+	}
+	for _, change := range deletions {
+		report.Unexpected = append(report.Unexpected, change.ResourceRecordSet)
+	}
+	sortRRSets(report.Missing)
+	sortRRSets(report.Unexpected)
+	return report
+}
+
+func (r *driftReport) write(w io.Writer, output string) error {
+	switch output {
+	case "json":
+		return json.NewEncoder(w).Encode(r)
+	case "text":
+		if r.InSync {
+			fmt.Fprintf(w, "Zone '%s' is in sync\n", r.ZoneName)
+			return nil
+		}
+		fmt.Fprintf(w, "Zone '%s' has drifted (%d missing / %d unexpected):\n", r.ZoneName, len(r.Missing), len(r.Unexpected))
+		for _, rrset := range r.Missing {
+			printRRSet(w, "+ ", rrset)
+		}
+		for _, rrset := range r.Unexpected {
+			printRRSet(w, "- ", rrset)
+		}
+		return nil
+	}
+	return fmt.Errorf("Unknown output format '%s'", output)
+}
+
+// checkDrift compares a zone file with the live zone without making any
+// changes, returning whether they are in sync.
+func checkDrift(ctx context.Context, args driftArgs, w io.Writer) bool {
+	zone := lookupZone(ctx, args.name)
+
+	reader, closer := openInput(args.file)
+	defer closer()
+
+	records := parseBindFile(reader, args.file, *zone.Name)
+	expandSelfAliases(records, zone)
+
+	rrsets, err := ListAllRecordSets(ctx, r53, *zone.Id)
+	fatalIfErr(err)
+	diffArgs := importArgs{replace: true, editauth: args.editauth}
+	additions, deletions := importChanges(zone, records, rrsets, diffArgs)
+
+	report := newDriftReport(zone, additions, deletions)
+	fatalIfErr(report.write(w, args.output))
+	return report.InSync
+}
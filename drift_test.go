@@ -0,0 +1,43 @@
+package cli53
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	route53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDriftReportInSync(t *testing.T) {
+	report := newDriftReport(testZone, []route53types.Change{}, []route53types.Change{})
+	w := &bytes.Buffer{}
+	require.NoError(t, report.write(w, "text"))
+	assert.Equal(t, "Zone 'example.com.' is in sync\n", w.String())
+}
+
+func TestDriftReport(t *testing.T) {
+	additions := []route53types.Change{
+		{Action: route53types.ChangeActionCreate, ResourceRecordSet: testRRSet("a.example.com.", route53types.RRTypeA, "127.0.0.1")},
+	}
+	deletions := []route53types.Change{
+		{Action: route53types.ChangeActionDelete, ResourceRecordSet: testRRSet("b.example.com.", route53types.RRTypeA, "127.0.0.2")},
+	}
+	report := newDriftReport(testZone, additions, deletions)
+	assert.False(t, report.InSync)
+
+	w := &bytes.Buffer{}
+	require.NoError(t, report.write(w, "text"))
+	assert.Equal(t, "Zone 'example.com.' has drifted (1 missing / 1 unexpected):\n+ a.example.com.\t3600\tIN\tA\t127.0.0.1\n- b.example.com.\t3600\tIN\tA\t127.0.0.2\n", w.String())
+
+	w.Reset()
+	require.NoError(t, report.write(w, "json"))
+	var decoded driftReport
+	require.NoError(t, json.Unmarshal(w.Bytes(), &decoded))
+	assert.Equal(t, "/hostedzone/Z1RWMUCMCPKCJX", decoded.ZoneId)
+	require.Len(t, decoded.Missing, 1)
+	assert.Equal(t, "a.example.com.", *decoded.Missing[0].Name)
+
+	assert.Error(t, report.write(w, "xml"))
+}
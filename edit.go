@@ -0,0 +1,118 @@
+package cli53
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	route53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/miekg/dns"
+)
+
+type editArgs struct {
+	name     string
+	wait     bool
+	editauth bool
+}
+
+// editorCommand returns the user's preferred editor command line.
+func editorCommand() []string {
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		if fields := strings.Fields(os.Getenv(env)); len(fields) > 0 {
+			return fields
+		}
+	}
+	return []string{"vi"}
+}
+
+func runEditor(filename string) error {
+	args := append(editorCommand(), filename)
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// parseEditedFile parses the edited zone file, returning any error rather
+// than exiting so the user can correct it.
+func parseEditedFile(filename string, zone *route53types.HostedZone) ([]dns.RR, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	records, err := parseBindFileErr(f, filename, *zone.Name)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		if !supportedRecord(record) {
+			return nil, fmt.Errorf("Unsupported resource record: %s", record)
+		}
+	}
+	return records, nil
+}
+
+func prompt(in *bufio.Reader, msg string) string {
+	fmt.Print(msg)
+	answer, _ := in.ReadString('\n')
+	return strings.ToLower(strings.TrimSpace(answer))
+}
+
+func editZone(ctx context.Context, args editArgs) {
+	zone := lookupZone(ctx, args.name)
+
+	f, err := os.CreateTemp("", "cli53-*.zone")
+	fatalIfErr(err)
+	filename := f.Name()
+	ExportBindToWriter(ctx, r53, zone, false, f)
+	fatalIfErr(f.Close())
+
+	in := bufio.NewReader(os.Stdin)
+	for {
+		fatalIfErr(runEditor(filename))
+
+		records, err := parseEditedFile(filename, zone)
+		if err != nil {
+			fmt.Printf("Error: %s\n", err)
+			if prompt(in, "Edit again? [Y/n] ") == "n" {
+				fmt.Printf("Your edits have been left in %s\n", filename)
+				return
+			}
+			continue
+		}
+		expandSelfAliases(records, zone)
+
+		rrsets, err := ListAllRecordSets(ctx, r53, *zone.Id)
+		fatalIfErr(err)
+		diffArgs := importArgs{replace: true, editauth: args.editauth}
+		additions, deletions := importChanges(zone, records, rrsets, diffArgs)
+		if len(additions)+len(deletions) == 0 {
+			fmt.Println("No changes made.")
+			os.Remove(filename)
+			return
+		}
+
+		fmt.Println("Changes that will be made:")
+		printChanges(additions, deletions)
+		switch prompt(in, "Apply these changes? [y/N/e(dit)] ") {
+		case "y", "yes":
+			changes := batchChanges(ctx, additions, deletions, zone, false)
+			fmt.Printf("%d changes applied (%d additions / %d deletions)\n", len(additions)+len(deletions), len(additions), len(deletions))
+			os.Remove(filename)
+			if args.wait {
+				waitForChanges(ctx, changes)
+			}
+			return
+		case "e", "edit":
+			continue
+		default:
+			fmt.Printf("No changes made. Your edits have been left in %s\n", filename)
+			return
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package cli53
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEditorCommand(t *testing.T) {
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", "")
+	assert.Equal(t, []string{"vi"}, editorCommand())
+	t.Setenv("EDITOR", "code --wait")
+	assert.Equal(t, []string{"code", "--wait"}, editorCommand())
+	t.Setenv("VISUAL", "emacs")
+	assert.Equal(t, []string{"emacs"}, editorCommand())
+}
+
+func TestParseEditedFile(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.zone")
+	require.NoError(t, os.WriteFile(valid, []byte("a 300 IN A 127.0.0.1\n"), 0o600))
+	records, err := parseEditedFile(valid, testZone)
+	require.NoError(t, err)
+	assert.Len(t, records, 1)
+
+	invalid := filepath.Join(dir, "invalid.zone")
+	require.NoError(t, os.WriteFile(invalid, []byte("a 300 IN A not-an-ip\n"), 0o600))
+	_, err = parseEditedFile(invalid, testZone)
+	assert.Error(t, err)
+
+	unsupported := filepath.Join(dir, "unsupported.zone")
+	require.NoError(t, os.WriteFile(unsupported, []byte("a 300 IN HINFO cpu os\n"), 0o600))
+	_, err = parseEditedFile(unsupported, testZone)
+	assert.Error(t, err)
+}
@@ -0,0 +1,185 @@
+package cli53
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	route53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+// The route53 API allows 5 requests per second per account, so requests made
+// exporting zones are sent no faster than this.
+var exportRateLimit = 5
+
+const exportIndexFile = "index.json"
+
+type exportAllArgs struct {
+	dir         string
+	full        bool
+	concurrency int
+}
+
+type exportIndexVPC struct {
+	VPCId     string `json:"vpcId"`
+	VPCRegion string `json:"vpcRegion"`
+}
+
+// exportIndexEntry describes an exported zone in the index file.
+type exportIndexEntry struct {
+	Name           string           `json:"name"`
+	Id             string           `json:"id"`
+	File           string           `json:"file"`
+	Comment        string           `json:"comment,omitempty"`
+	Private        bool             `json:"private"`
+	VPCs           []exportIndexVPC `json:"vpcs,omitempty"`
+	RecordSetCount int64            `json:"recordSetCount"`
+}
+
+// exportFileNames returns the file name each zone is exported to, keyed by
+// zone id. Zones sharing a name (split-horizon public and private zones) are
+// disambiguated by their id.
+func exportFileNames(zones []route53types.HostedZone) map[string]string {
+	count := map[string]int{}
+	for _, zone := range zones {
+		count[strings.ToLower(*zone.Name)]++
+	}
+	names := map[string]string{}
+	for _, zone := range zones {
+		name := strings.TrimSuffix(*zone.Name, ".")
+		if count[strings.ToLower(*zone.Name)] > 1 {
+			name += "_" + strings.Replace(*zone.Id, "/hostedzone/", "", 1)
+		}
+		names[*zone.Id] = name + syncFileSuffix
+	}
+	return names
+}
+
+func newExportIndexEntry(zone *route53types.HostedZone, file string) *exportIndexEntry {
+	entry := &exportIndexEntry{
+		Name:           *zone.Name,
+		Id:             strings.Replace(*zone.Id, "/hostedzone/", "", 1),
+		File:           file,
+		RecordSetCount: aws.ToInt64(zone.ResourceRecordSetCount),
+	}
+	if zone.Config != nil {
+		entry.Comment = aws.ToString(zone.Config.Comment)
+		entry.Private = zone.Config.PrivateZone
+	}
+	return entry
+}
+
+// pacedHTTPClient sends each request no sooner than the next tick, so every
+// route53 call made, including each page of a listing, is rate limited.
+type pacedHTTPClient struct {
+	route53.HTTPClient
+	pace <-chan time.Time
+}
+
+func (c pacedHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	select {
+	case <-c.pace:
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+	return c.HTTPClient.Do(req)
+}
+
+// exportZoneFile exports a zone to a file, with a zone-id header so sync maps
+// it back to the same hosted zone. The file is removed if the export fails.
+func exportZoneFile(ctx context.Context, client *route53.Client, zone *route53types.HostedZone, filename string, full bool) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(f, "; zone-id: %s\n", strings.Replace(*zone.Id, "/hostedzone/", "", 1))
+	err = writeBindExport(ctx, client, zone, full, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(filename)
+	}
+	return err
+}
+
+func writeExportIndex(filename string, entries []*exportIndexEntry) error {
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append(data, '\n'), 0o644)
+}
+
+// exportAll exports every hosted zone to a file in a directory, several at a
+// time, and writes an index of the zones exported.
+func exportAll(ctx context.Context, args exportAllArgs) {
+	limiter := time.NewTicker(time.Second / time.Duration(exportRateLimit))
+	defer limiter.Stop()
+	client := route53.New(r53.Options(), func(o *route53.Options) {
+		o.HTTPClient = pacedHTTPClient{o.HTTPClient, limiter.C}
+	})
+
+	zones, err := listAllZones(ctx, client)
+	fatalIfErr(err)
+	fatalIfErr(os.MkdirAll(args.dir, 0o755))
+	names := exportFileNames(zones)
+
+	entries := make([]*exportIndexEntry, len(zones))
+	errs := make([]error, len(zones))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < args.concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				zone := &zones[i]
+				entry := newExportIndexEntry(zone, names[*zone.Id])
+				if entry.Private {
+					resp, err := client.GetHostedZone(ctx, &route53.GetHostedZoneInput{Id: zone.Id})
+					if err != nil {
+						errs[i] = err
+						continue
+					}
+					for _, vpc := range resp.VPCs {
+						entry.VPCs = append(entry.VPCs, exportIndexVPC{aws.ToString(vpc.VPCId), string(vpc.VPCRegion)})
+					}
+				}
+				errs[i] = exportZoneFile(ctx, client, zone, filepath.Join(args.dir, entry.File), args.full)
+				entries[i] = entry
+			}
+		}()
+	}
+	for i := range zones {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	index := []*exportIndexEntry{}
+	failed := 0
+	for i, zone := range zones {
+		if errs[i] != nil {
+			fmt.Fprintf(os.Stderr, "Error exporting %s: %s\n", *zone.Name, errs[i])
+			failed++
+			continue
+		}
+		index = append(index, entries[i])
+	}
+	sort.SliceStable(index, func(i, j int) bool { return index[i].File < index[j].File })
+	fatalIfErr(writeExportIndex(filepath.Join(args.dir, exportIndexFile), index))
+	fmt.Printf("%d zones exported to %s\n", len(index), args.dir)
+	if failed > 0 {
+		errorAndExit(fmt.Sprintf("%d zones failed to export", failed))
+	}
+}
@@ -0,0 +1,56 @@
+package cli53
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	route53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportFileNames(t *testing.T) {
+	zones := []route53types.HostedZone{
+		{Id: aws.String("/hostedzone/Z1PUBLIC000000"), Name: aws.String("example.com.")},
+		{Id: aws.String("/hostedzone/Z2PRIVATE00000"), Name: aws.String("example.com.")},
+		{Id: aws.String("/hostedzone/Z3OTHER0000000"), Name: aws.String("example.org.")},
+	}
+	assert.Equal(t, map[string]string{
+		"/hostedzone/Z1PUBLIC000000": "example.com_Z1PUBLIC000000.zone",
+		"/hostedzone/Z2PRIVATE00000": "example.com_Z2PRIVATE00000.zone",
+		"/hostedzone/Z3OTHER0000000": "example.org.zone",
+	}, exportFileNames(zones))
+}
+
+func TestNewExportIndexEntry(t *testing.T) {
+	zone := &route53types.HostedZone{
+		Id:                     aws.String("/hostedzone/Z2PRIVATE00000"),
+		Name:                   aws.String("example.com."),
+		ResourceRecordSetCount: aws.Int64(7),
+		Config: &route53types.HostedZoneConfig{
+			Comment:     aws.String("internal"),
+			PrivateZone: true,
+		},
+	}
+	assert.Equal(t, &exportIndexEntry{
+		Name:           "example.com.",
+		Id:             "Z2PRIVATE00000",
+		File:           "example.com.zone",
+		Comment:        "internal",
+		Private:        true,
+		RecordSetCount: 7,
+	}, newExportIndexEntry(zone, "example.com.zone"))
+}
+
+func TestExportZoneFileError(t *testing.T) {
+	testRoute53(t, 1)
+	filename := filepath.Join(t.TempDir(), "example.com.zone")
+	err := exportZoneFile(context.Background(), r53, testZone, filename, false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "bad batch")
+	_, err = os.Stat(filename)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -16,6 +16,7 @@ require (
 	github.com/miekg/dns v1.1.65
 	github.com/stretchr/testify v1.4.0
 	github.com/urfave/cli/v2 v2.27.6
+	gopkg.in/yaml.v2 v2.2.8
 )
 
 require (
@@ -39,5 +40,4 @@ require (
 	golang.org/x/sync v0.13.0 // indirect
 	golang.org/x/sys v0.32.0 // indirect
 	golang.org/x/tools v0.32.0 // indirect
-	gopkg.in/yaml.v2 v2.2.8 // indirect
 )
@@ -0,0 +1,223 @@
+package cli53
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	route53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+// historyBatch is a batch of changes submitted to route53.
+type historyBatch struct {
+	ChangeId string                    `json:"changeId"`
+	Status   route53types.ChangeStatus `json:"status"`
+	Changes  []route53types.Change     `json:"changes"`
+}
+
+// historyRecord is a line in the history log, recording the changes made by
+// one invocation of cli53.
+type historyRecord struct {
+	Id         string         `json:"id"`
+	Time       time.Time      `json:"time"`
+	Command    string         `json:"command"`
+	Args       []string       `json:"args"`
+	Profile    string         `json:"profile"`
+	RoleArn    string         `json:"roleArn,omitempty"`
+	ZoneId     string         `json:"zoneId"`
+	ZoneName   string         `json:"zoneName"`
+	Batches    []historyBatch `json:"batches"`
+	Error      string         `json:"error,omitempty"`
+	RolledBack bool           `json:"rolledBack,omitempty"`
+}
+
+func newHistoryRecord(entry *journalEntry) *historyRecord {
+	return &historyRecord{
+		Id:       entry.Id,
+		Time:     entry.Time,
+		Command:  entry.Command,
+		Args:     entry.Args,
+		Profile:  invocation.profile,
+		RoleArn:  invocation.roleArn,
+		ZoneId:   entry.ZoneId,
+		ZoneName: entry.ZoneName,
+		Batches:  []historyBatch{},
+	}
+}
+
+func historyFile() (string, error) {
+	dir, err := journalDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "history.jsonl"), nil
+}
+
+func (r *historyRecord) append() error {
+	filename, err := historyFile()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(r)
+}
+
+// appendHistory appends a record to the history log, warning rather than
+// failing the command if it cannot be written.
+func appendHistory(record *historyRecord) {
+	if err := record.append(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: unable to write history: %s\n", err)
+	}
+}
+
+func readHistory(r io.Reader) ([]*historyRecord, error) {
+	records := []*historyRecord{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		record := &historyRecord{}
+		if err := json.Unmarshal(scanner.Bytes(), record); err != nil {
+			return nil, fmt.Errorf("history line %d: %s", line, err)
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+func loadHistory() ([]*historyRecord, error) {
+	filename, err := historyFile()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return []*historyRecord{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readHistory(f)
+}
+
+type historyArgs struct {
+	zone  string
+	name  string
+	since time.Time
+	until time.Time
+}
+
+// parseHistoryTime parses a date or timestamp given on the command line.
+func parseHistoryTime(s string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("Invalid date '%s', expected YYYY-MM-DD or RFC3339", s)
+}
+
+func (r *historyRecord) matches(args historyArgs) bool {
+	if args.zone != "" {
+		zone := strings.TrimSuffix(args.zone, ".")
+		if r.ZoneId != zone && r.ZoneId != "/hostedzone/"+zone && zoneName(r.ZoneName) != zone {
+			return false
+		}
+	}
+	if !args.since.IsZero() && r.Time.Before(args.since) {
+		return false
+	}
+	if !args.until.IsZero() && !r.Time.Before(args.until) {
+		return false
+	}
+	if args.name != "" {
+		name := strings.ToLower(qualifyName(args.name, r.ZoneName))
+		found := false
+		for _, batch := range r.Batches {
+			for _, change := range batch.Changes {
+				if strings.ToLower(*change.ResourceRecordSet.Name) == name {
+					found = true
+				}
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *historyRecord) changeCount() int {
+	n := 0
+	for _, batch := range r.Batches {
+		n += len(batch.Changes)
+	}
+	return n
+}
+
+func listHistory(records []*historyRecord, args historyArgs, w io.Writer) {
+	wr := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+	fmt.Fprintln(wr, "ID\tTime\tCommand\tZone\tChanges\tProfile")
+	for _, record := range records {
+		if !record.matches(args) {
+			continue
+		}
+		command := record.Command
+		if record.Error != "" {
+			command += " (failed)"
+		}
+		fmt.Fprintf(wr, "%s\t%s\t%s\t%s\t%d\t%s\n", record.Id, record.Time.Local().Format("2006-01-02 15:04:05"), command, record.ZoneName, record.changeCount(), record.Profile)
+	}
+	wr.Flush()
+}
+
+func showHistory(records []*historyRecord, id string, w io.Writer) error {
+	for _, record := range records {
+		if record.Id != id {
+			continue
+		}
+		fmt.Fprintf(w, "ID: %s\n", record.Id)
+		fmt.Fprintf(w, "Time: %s\n", record.Time.Local().Format(time.RFC1123))
+		fmt.Fprintf(w, "Command: %s\n", strings.Join(append([]string{"cli53", record.Command}, record.Args...), " "))
+		fmt.Fprintf(w, "Profile: %s\n", record.Profile)
+		if record.RoleArn != "" {
+			fmt.Fprintf(w, "Role: %s\n", record.RoleArn)
+		}
+		fmt.Fprintf(w, "Zone: %s (%s)\n", record.ZoneName, record.ZoneId)
+		if record.Error != "" {
+			fmt.Fprintf(w, "Error: %s\n", record.Error)
+		}
+		if record.RolledBack {
+			fmt.Fprintln(w, "Rolled back: yes")
+		}
+		for _, batch := range record.Batches {
+			fmt.Fprintf(w, "\nChange %s (%s):\n", batch.ChangeId, batch.Status)
+			for _, change := range batch.Changes {
+				prefix := "+ "
+				if change.Action == route53types.ChangeActionDelete {
+					prefix = "- "
+				}
+				printRRSet(w, prefix, change.ResourceRecordSet)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("History entry '%s' not found", id)
+}
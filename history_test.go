@@ -0,0 +1,86 @@
+package cli53
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	route53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testHistoryRecord(t time.Time, changes ...route53types.Change) *historyRecord {
+	entry := newJournalEntry(testZone, changes, nil, nil)
+	entry.Time = t
+	record := newHistoryRecord(entry)
+	record.Batches = append(record.Batches, historyBatch{
+		ChangeId: "/change/C1",
+		Status:   route53types.ChangeStatusPending,
+		Changes:  changes,
+	})
+	return record
+}
+
+func TestHistoryAppendLoad(t *testing.T) {
+	t.Setenv("CLI53_JOURNAL_DIR", t.TempDir())
+	records, err := loadHistory()
+	require.NoError(t, err)
+	assert.Empty(t, records)
+
+	first := testHistoryRecord(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), change(route53types.ChangeActionCreate, testRRSet("a.example.com.", route53types.RRTypeA, "127.0.0.1")))
+	second := testHistoryRecord(time.Date(2024, 2, 2, 3, 4, 5, 0, time.UTC), change(route53types.ChangeActionDelete, testRRSet("b.example.com.", route53types.RRTypeA, "127.0.0.2")))
+	require.NoError(t, first.append())
+	require.NoError(t, second.append())
+
+	records, err = loadHistory()
+	require.NoError(t, err)
+	assert.Equal(t, []*historyRecord{first, second}, records)
+}
+
+func TestHistoryMatches(t *testing.T) {
+	record := testHistoryRecord(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), change(route53types.ChangeActionCreate, testRRSet("a.example.com.", route53types.RRTypeA, "127.0.0.1")))
+	day := func(s string) time.Time {
+		t, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			panic(err)
+		}
+		return t
+	}
+
+	assert.True(t, record.matches(historyArgs{}))
+	assert.True(t, record.matches(historyArgs{zone: "example.com"}))
+	assert.True(t, record.matches(historyArgs{zone: "example.com."}))
+	assert.True(t, record.matches(historyArgs{zone: "Z1RWMUCMCPKCJX"}))
+	assert.False(t, record.matches(historyArgs{zone: "example.org"}))
+	assert.True(t, record.matches(historyArgs{name: "a"}))
+	assert.True(t, record.matches(historyArgs{name: "A.example.com."}))
+	assert.False(t, record.matches(historyArgs{name: "b"}))
+	assert.True(t, record.matches(historyArgs{since: day("2024-01-02")}))
+	assert.False(t, record.matches(historyArgs{since: day("2024-01-03")}))
+	assert.True(t, record.matches(historyArgs{until: day("2024-01-03")}))
+	assert.False(t, record.matches(historyArgs{until: day("2024-01-02")}))
+}
+
+func TestParseHistoryTime(t *testing.T) {
+	ts, err := parseHistoryTime("2024-01-02T03:04:05Z")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), ts.UTC())
+	ts, err = parseHistoryTime("2024-01-02")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 1, 2, 0, 0, 0, 0, time.Local), ts)
+	_, err = parseHistoryTime("yesterday")
+	assert.EqualError(t, err, "Invalid date 'yesterday', expected YYYY-MM-DD or RFC3339")
+}
+
+func TestShowHistory(t *testing.T) {
+	record := testHistoryRecord(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		change(route53types.ChangeActionDelete, testRRSet("a.example.com.", route53types.RRTypeA, "127.0.0.1")),
+		change(route53types.ChangeActionCreate, testRRSet("a.example.com.", route53types.RRTypeA, "127.0.0.2")),
+	)
+	w := &bytes.Buffer{}
+	require.NoError(t, showHistory([]*historyRecord{record}, record.Id, w))
+	assert.Contains(t, w.String(), "Change /change/C1 (PENDING):\n- a.example.com.\t3600\tIN\tA\t127.0.0.1\n+ a.example.com.\t3600\tIN\tA\t127.0.0.2\n")
+
+	assert.EqualError(t, showHistory([]*historyRecord{record}, "missing", w), "History entry 'missing' not found")
+}
@@ -0,0 +1,227 @@
+package cli53
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	route53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/miekg/dns"
+)
+
+// Formats for /etc/hosts files and dnsmasq configuration.
+const (
+	FormatHosts   = "hosts"
+	FormatDnsmasq = "dnsmasq"
+)
+
+// The TTL of records imported from hosts files, which have none.
+const hostsTTL = 3600
+
+// hostsSpecialNames are the names hosts files define for the local machine,
+// which are never imported.
+var hostsSpecialNames = map[string]bool{
+	"localhost":             true,
+	"localhost.localdomain": true,
+	"broadcasthost":         true,
+	"ip6-localhost":         true,
+	"ip6-loopback":          true,
+	"ip6-localnet":          true,
+	"ip6-mcastprefix":       true,
+	"ip6-allnodes":          true,
+	"ip6-allrouters":        true,
+	"ip6-allhosts":          true,
+}
+
+// hostsName qualifies a host name in the zone origin. Names without a dot
+// are relative to the zone, and names outside it are ignored.
+func hostsName(name, origin string) (string, bool) {
+	name = strings.ToLower(name)
+	if hostsSpecialNames[name] {
+		return "", false
+	}
+	if !strings.Contains(strings.TrimSuffix(name, "."), ".") {
+		name = qualifyName(strings.TrimSuffix(name, "."), origin)
+	}
+	name = dns.Fqdn(name)
+	if !dns.IsSubDomain(origin, name) {
+		return "", false
+	}
+	return name, true
+}
+
+func hostsRecord(name string, ip net.IP, ttl uint32) dns.RR {
+	if ip4 := ip.To4(); ip4 != nil {
+		return &dns.A{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: ttl}, A: ip4}
+	}
+	return &dns.AAAA{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: ttl}, AAAA: ip}
+}
+
+// hostsRecords accumulates records, ignoring duplicates which route53 would
+// reject.
+type hostsRecords struct {
+	origin  string
+	seen    map[string]bool
+	records []dns.RR
+}
+
+func (h *hostsRecords) add(name string, ip net.IP, ttl uint32) {
+	name, ok := hostsName(name, h.origin)
+	if !ok {
+		return
+	}
+	rr := hostsRecord(name, ip, ttl)
+	key := fmt.Sprintf("%s %s", name, ip)
+	if !h.seen[key] {
+		h.seen[key] = true
+		h.records = append(h.records, rr)
+	}
+}
+
+func parseHostsIP(s string) (net.IP, error) {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address '%s'", s)
+	}
+	return ip, nil
+}
+
+// readHosts reads A and AAAA records from an /etc/hosts file: an address,
+// then the host names for it.
+func readHosts(r io.Reader, origin string) ([]dns.RR, error) {
+	h := &hostsRecords{origin: origin, seen: map[string]bool{}}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) == 1 {
+			return nil, fmt.Errorf("line %d: expected an address and host names", n)
+		}
+		ip, err := parseHostsIP(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		for _, name := range fields[1:] {
+			h.add(name, ip, hostsTTL)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return h.records, nil
+}
+
+// readDnsmasq reads A and AAAA records from dnsmasq configuration.
+// host-record=name[,name...][,ipv4][,ipv6][,ttl] defines records for exactly
+// the names given, and address=/name[/name...]/ip also for all their
+// subdomains, so it is imported with a wildcard record. Other options are
+// ignored.
+func readDnsmasq(r io.Reader, origin string) ([]dns.RR, error) {
+	h := &hostsRecords{origin: origin, seen: map[string]bool{}}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		option, value, _ := strings.Cut(line, "=")
+		switch strings.TrimSpace(option) {
+		case "address":
+			parts := strings.Split(strings.TrimSpace(value), "/")
+			if len(parts) < 3 || parts[0] != "" {
+				return nil, fmt.Errorf("line %d: expected address=/name/address", n)
+			}
+			address := parts[len(parts)-1]
+			if address == "" || address == "#" {
+				fmt.Fprintf(os.Stderr, "Warning: line %d: Skipping address without an IP address\n", n)
+				continue
+			}
+			ip, err := parseHostsIP(address)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", n, err)
+			}
+			for _, name := range parts[1 : len(parts)-1] {
+				if !strings.Contains(name, ".") {
+					// a bare label is relative to the zone, like hosts names
+					name = qualifyName(name, origin)
+				}
+				h.add(name, ip, hostsTTL)
+				h.add("*."+dns.Fqdn(name), ip, hostsTTL)
+			}
+		case "host-record":
+			names := []string{}
+			ips := []net.IP{}
+			ttl := uint32(hostsTTL)
+			for _, field := range strings.Split(value, ",") {
+				field = strings.TrimSpace(field)
+				if ip := net.ParseIP(field); ip != nil {
+					ips = append(ips, ip)
+				} else if t, err := strconv.ParseUint(field, 10, 32); err == nil {
+					ttl = uint32(t)
+				} else if field != "" {
+					names = append(names, field)
+				}
+			}
+			if len(names) == 0 || len(ips) == 0 {
+				return nil, fmt.Errorf("line %d: expected host-record=name,address", n)
+			}
+			for _, name := range names {
+				for _, ip := range ips {
+					h.add(name, ip, ttl)
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return h.records, nil
+}
+
+// writeHosts writes the A and AAAA records in hosts or dnsmasq format.
+// Aliases, records with routing and wildcards cannot be represented, and are
+// skipped with a warning.
+func writeHosts(w io.Writer, format string, rrsets []*route53types.ResourceRecordSet) error {
+	for _, rrset := range rrsets {
+		if rrset.Type != route53types.RRTypeA && rrset.Type != route53types.RRTypeAaaa {
+			continue
+		}
+		name := strings.TrimSuffix(unescaper.Replace(*rrset.Name), ".")
+		if rrset.AliasTarget != nil || rrset.SetIdentifier != nil || strings.HasPrefix(name, "*") {
+			fmt.Fprintf(os.Stderr, "Warning: Skipping %s %s, which cannot be represented in %s format\n", name, rrset.Type, format)
+			continue
+		}
+		for _, rr := range rrset.ResourceRecords {
+			var err error
+			if format == FormatDnsmasq {
+				_, err = fmt.Fprintf(w, "host-record=%s,%s,%d\n", name, *rr.Value, *rrset.TTL)
+			} else {
+				_, err = fmt.Fprintf(w, "%s\t%s\n", *rr.Value, name)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func exportHosts(ctx context.Context, name, format string, writer io.Writer) {
+	zone := lookupZone(ctx, name)
+	rrsets, err := ListAllRecordSets(ctx, r53, *zone.Id)
+	fatalIfErr(err)
+	sort.Sort(exportSorter{rrsets, *zone.Name})
+	fatalIfErr(writeHosts(writer, format, rrsets))
+}
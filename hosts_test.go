@@ -0,0 +1,71 @@
+package cli53
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	route53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadHosts(t *testing.T) {
+	records, err := readHosts(strings.NewReader(`127.0.0.1	localhost
+::1		localhost ip6-localhost
+# lab machines
+10.0.0.1	web web.example.com # web server
+10.0.0.2	db.lab.example.com db.other.net
+10.0.0.3	web
+fd00::1		web
+`), "example.com.")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"web.example.com. 3600 IN A 10.0.0.1",
+		"db.lab.example.com. 3600 IN A 10.0.0.2",
+		"web.example.com. 3600 IN A 10.0.0.3",
+		"web.example.com. 3600 IN AAAA fd00::1",
+	}, recordStrings(records))
+
+	_, err = readHosts(strings.NewReader("10.0.0.1 web\nweb 10.0.0.1\n"), "example.com.")
+	assert.EqualError(t, err, "line 2: invalid IP address 'web'")
+}
+
+func TestReadDnsmasq(t *testing.T) {
+	records, err := readDnsmasq(strings.NewReader(`# lab
+domain-needed
+address=/lab.example.com/10.0.0.1
+address=/blocked.example.com/
+host-record=db.example.com,db2,10.0.0.2,fd00::2,300
+`), "example.com.")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"lab.example.com. 3600 IN A 10.0.0.1",
+		"*.lab.example.com. 3600 IN A 10.0.0.1",
+		"db.example.com. 300 IN A 10.0.0.2",
+		"db.example.com. 300 IN AAAA fd00::2",
+		"db2.example.com. 300 IN A 10.0.0.2",
+		"db2.example.com. 300 IN AAAA fd00::2",
+	}, recordStrings(records))
+}
+
+func TestWriteHosts(t *testing.T) {
+	weighted := testRRSet("w.example.com.", route53types.RRTypeA, "10.0.0.9")
+	weighted.SetIdentifier = aws.String("one")
+	weighted.Weight = aws.Int64(1)
+	rrsets := []*route53types.ResourceRecordSet{
+		testRRSet("example.com.", route53types.RRTypeMx, "10 mail.example.com."),
+		testRRSet("web.example.com.", route53types.RRTypeA, "10.0.0.1", "10.0.0.3"),
+		testRRSet("web.example.com.", route53types.RRTypeAaaa, "fd00::1"),
+		testAlias("alias.example.com.", "web.example.com."),
+		weighted,
+	}
+	w := &bytes.Buffer{}
+	require.NoError(t, writeHosts(w, FormatHosts, rrsets))
+	assert.Equal(t, "10.0.0.1\tweb.example.com\n10.0.0.3\tweb.example.com\nfd00::1\tweb.example.com\n", w.String())
+
+	w.Reset()
+	require.NoError(t, writeHosts(w, FormatDnsmasq, rrsets[1:2]))
+	assert.Equal(t, "host-record=web.example.com,10.0.0.1,3600\nhost-record=web.example.com,10.0.0.3,3600\n", w.String())
+}
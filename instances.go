@@ -139,11 +139,11 @@ func instances(ctx context.Context, args instancesArgs, config aws.Config) {
 			fmt.Printf("+ %s %s %v\n", *rr.Name, rr.Type, *rr.ResourceRecords[0].Value)
 		}
 	} else {
-		resp := batchChanges(ctx, upserts, []route53types.Change{}, zone)
+		changes := batchChanges(ctx, upserts, []route53types.Change{}, zone, false)
 		fmt.Printf("%d records upserted\n", len(upserts))
 
-		if args.wait && resp != nil {
-			waitForChange(ctx, resp.ChangeInfo)
+		if args.wait {
+			waitForChanges(ctx, changes)
 		}
 	}
 }
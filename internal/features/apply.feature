@@ -0,0 +1,18 @@
+@apply
+Feature: apply
+  Scenario: I can import to a plan file and apply it
+    Given I have a domain "$domain"
+    When I run "cli53 import --file tests/replace1.txt $domain"
+    And I run "cli53 import --replace --file tests/replace2.txt --plan-out /tmp/$domain.plan $domain"
+    Then the output contains "+ mail.$domain.	86400	IN	A	10.0.0.4"
+    And the output contains "Plan written to"
+    When I run "cli53 apply --file /tmp/$domain.plan"
+    Then the domain "$domain" export matches file "tests/replace2.txt"
+
+  Scenario: I cannot apply a plan when the zone has changed
+    Given I have a domain "$domain"
+    When I run "cli53 import --file tests/replace1.txt $domain"
+    And I run "cli53 import --replace --file tests/replace2.txt --plan-out /tmp/$domain.plan $domain"
+    And I run "cli53 rrcreate $domain 'extra A 127.0.0.1'"
+    And I execute "cli53 apply --file /tmp/$domain.plan"
+    Then the exit code was 1
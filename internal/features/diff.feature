@@ -0,0 +1,11 @@
+@diff
+Feature: diff zone files
+  Scenario: identical zone files have no differences
+    When I execute "cli53 diff --origin example.com tests/replace1.txt tests/replace1.txt"
+    Then the exit code was 0
+    And the output contains "0 added, 0 removed, 0 modified"
+
+  Scenario: changed zone files are reported
+    When I execute "cli53 diff --origin example.com tests/replace1.txt tests/replace2.txt"
+    Then the output contains "~ mail.example.com. A"
+    And the output contains "0 added, 0 removed, 9 modified"
@@ -0,0 +1,16 @@
+@drift
+Feature: drift
+  Scenario: a zone matching the file is in sync
+    Given I have a domain "$domain"
+    When I run "cli53 import --file tests/replace1.txt $domain"
+    And I execute "cli53 drift --file tests/replace1.txt $domain"
+    Then the exit code was 0
+    And the output contains "is in sync"
+
+  Scenario: a zone changed outside the file has drifted
+    Given I have a domain "$domain"
+    When I run "cli53 import --file tests/replace1.txt $domain"
+    And I run "cli53 rrcreate $domain 'extra A 127.0.0.1'"
+    And I execute "cli53 drift --file tests/replace1.txt $domain"
+    Then the exit code was 2
+    And the output contains "- extra.$domain.	3600	IN	A	127.0.0.1"
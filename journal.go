@@ -0,0 +1,325 @@
+package cli53
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	route53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/urfave/cli/v2"
+)
+
+// The command line being run and the credentials it is run with, recorded
+// in the journal and history.
+var invocation struct {
+	command string
+	args    []string
+	profile string
+	roleArn string
+}
+
+func recordInvocation(c *cli.Context) error {
+	invocation.command = c.Command.Name
+	invocation.args = c.Args().Slice()
+	invocation.profile = effectiveSharedConfigProfile(c.String("profile"))
+	invocation.roleArn = c.String("role-arn")
+	if invocation.roleArn == "" {
+		if settings, found, err := loadAWSProfileSettings(invocation.profile); err == nil && found {
+			invocation.roleArn = settings.RoleARN
+		}
+	}
+	return nil
+}
+
+// journalDir returns the directory journal entries are saved in, which can
+// be overridden with CLI53_JOURNAL_DIR.
+func journalDir() (string, error) {
+	if dir := os.Getenv("CLI53_JOURNAL_DIR"); dir != "" {
+		return dir, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "cli53", "journal"), nil
+}
+
+// journalEntry is a snapshot of the record sets affected by a set of changes,
+// taken before they are submitted, from which the changes can be undone.
+type journalEntry struct {
+	Id        string                            `json:"id"`
+	Time      time.Time                         `json:"time"`
+	Command   string                            `json:"command"`
+	Args      []string                          `json:"args"`
+	ZoneId    string                            `json:"zoneId"`
+	ZoneName  string                            `json:"zoneName"`
+	Changes   []route53types.Change             `json:"changes"`
+	Before    []*route53types.ResourceRecordSet `json:"before"`
+	After     []*route53types.ResourceRecordSet `json:"after"`
+	ChangeIds []string                          `json:"changeIds"`
+}
+
+func newJournalId(t time.Time) string {
+	return fmt.Sprintf("%s-%.6s", t.UTC().Format("20060102T150405Z"), uniqueReference())
+}
+
+// newJournalEntry records the state of the record sets affected by the
+// changes, before and after. current holds the live record sets, and is only
+// needed if there are UPSERTs.
+func newJournalEntry(zone *route53types.HostedZone, additions, deletions []route53types.Change, current map[rrsetIdentity]*route53types.ResourceRecordSet) *journalEntry {
+	now := time.Now()
+	entry := &journalEntry{
+		Id:        newJournalId(now),
+		Time:      now.UTC(),
+		Command:   invocation.command,
+		Args:      invocation.args,
+		ZoneId:    *zone.Id,
+		ZoneName:  *zone.Name,
+		Changes:   append(append([]route53types.Change{}, deletions...), additions...),
+		Before:    []*route53types.ResourceRecordSet{},
+		After:     []*route53types.ResourceRecordSet{},
+		ChangeIds: []string{},
+	}
+
+	before := map[rrsetIdentity]*route53types.ResourceRecordSet{}
+	for _, change := range entry.Changes {
+		id := identityOf(change.ResourceRecordSet)
+		switch change.Action {
+		case route53types.ChangeActionDelete:
+			before[id] = change.ResourceRecordSet
+		case route53types.ChangeActionUpsert:
+			if rrset, ok := current[id]; ok {
+				before[id] = rrset
+			}
+		}
+	}
+	after := map[rrsetIdentity]*route53types.ResourceRecordSet{}
+	for id, rrset := range before {
+		after[id] = rrset
+	}
+	for _, change := range entry.Changes {
+		id := identityOf(change.ResourceRecordSet)
+		if change.Action == route53types.ChangeActionDelete {
+			delete(after, id)
+		} else {
+			after[id] = change.ResourceRecordSet
+		}
+	}
+
+	for _, rrset := range before {
+		entry.Before = append(entry.Before, rrset)
+	}
+	for _, rrset := range after {
+		entry.After = append(entry.After, rrset)
+	}
+	sortRRSets(entry.Before)
+	sortRRSets(entry.After)
+	return entry
+}
+
+// applied returns the entry for just the batches of its changes that were
+// applied, so a partial update can be undone.
+func (e *journalEntry) applied(zone *route53types.HostedZone, batches [][]route53types.Change, current map[rrsetIdentity]*route53types.ResourceRecordSet) *journalEntry {
+	var additions, deletions []route53types.Change
+	for _, batch := range batches {
+		for _, change := range batch {
+			if change.Action == route53types.ChangeActionDelete {
+				deletions = append(deletions, change)
+			} else {
+				additions = append(additions, change)
+			}
+		}
+	}
+	applied := newJournalEntry(zone, additions, deletions, current)
+	applied.Id, applied.Time, applied.ChangeIds = e.Id, e.Time, e.ChangeIds
+	return applied
+}
+
+func (e *journalEntry) save() error {
+	dir, err := journalDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, e.Id+".json"), append(data, '\n'), 0o600)
+}
+
+// saveJournalEntry saves an entry, warning rather than failing the command
+// if it cannot be written.
+func saveJournalEntry(entry *journalEntry) {
+	if err := entry.save(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: unable to write journal entry: %s\n", err)
+	}
+}
+
+// removeJournalEntry removes a saved entry for changes that were not made,
+// warning if it cannot be removed.
+func removeJournalEntry(entry *journalEntry) {
+	dir, err := journalDir()
+	if err == nil {
+		err = os.Remove(filepath.Join(dir, entry.Id+".json"))
+	}
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "Warning: unable to remove journal entry: %s\n", err)
+	}
+}
+
+// journalIds returns the ids of the saved journal entries, oldest first.
+func journalIds() ([]string, error) {
+	dir, err := journalDir()
+	if err != nil {
+		return nil, err
+	}
+	files, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for _, file := range files {
+		if strings.HasSuffix(file.Name(), ".json") {
+			ids = append(ids, strings.TrimSuffix(file.Name(), ".json"))
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// loadJournalEntry loads the entry with the given id, or the most recent
+// entry if id is empty.
+func loadJournalEntry(id string) (*journalEntry, error) {
+	if id == "" {
+		ids, err := journalIds()
+		if err != nil {
+			return nil, err
+		}
+		if len(ids) == 0 {
+			return nil, fmt.Errorf("No journal entries found")
+		}
+		id = ids[len(ids)-1]
+	}
+	dir, err := journalDir()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, id+".json"))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("Journal entry '%s' not found", id)
+	} else if err != nil {
+		return nil, err
+	}
+	entry := &journalEntry{}
+	if err := json.Unmarshal(data, entry); err != nil {
+		return nil, fmt.Errorf("Journal entry '%s': %s", id, err)
+	}
+	return entry, nil
+}
+
+func sameRRSet(a, b *route53types.ResourceRecordSet) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return canonicalRRSet(a) == canonicalRRSet(b)
+}
+
+// undoChanges returns the changes that restore the record sets of an entry
+// to their state before it was applied. It is an error if any of them have
+// been changed since.
+func (e *journalEntry) undoChanges(live map[rrsetIdentity]*route53types.ResourceRecordSet) (additions, deletions []route53types.Change, err error) {
+	before := map[rrsetIdentity]*route53types.ResourceRecordSet{}
+	for _, rrset := range e.Before {
+		before[identityOf(rrset)] = rrset
+	}
+	after := map[rrsetIdentity]*route53types.ResourceRecordSet{}
+	for _, rrset := range e.After {
+		after[identityOf(rrset)] = rrset
+	}
+	ids := []rrsetIdentity{}
+	seen := map[rrsetIdentity]bool{}
+	for _, change := range e.Changes {
+		id := identityOf(change.ResourceRecordSet)
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	additions = []route53types.Change{}
+	deletions = []route53types.Change{}
+	for _, id := range ids {
+		if !sameRRSet(after[id], live[id]) {
+			return nil, nil, fmt.Errorf("Record '%s' has changed since journal entry '%s' - not undoing", id, e.Id)
+		}
+		b, a := before[id], after[id]
+		if sameRRSet(a, b) {
+			continue
+		}
+		if a != nil {
+			deletions = append(deletions, route53types.Change{
+				Action:            route53types.ChangeActionDelete,
+				ResourceRecordSet: a,
+			})
+		}
+		if b != nil {
+			additions = append(additions, route53types.Change{
+				Action:            route53types.ChangeActionCreate,
+				ResourceRecordSet: b,
+			})
+		}
+	}
+	return
+}
+
+type undoArgs struct {
+	id     string
+	wait   bool
+	dryrun bool
+	verify verifyOptions
+}
+
+func undo(ctx context.Context, args undoArgs) {
+	entry, err := loadJournalEntry(args.id)
+	fatalIfErr(err)
+
+	zone := lookupZone(ctx, entry.ZoneId)
+	rrsets, err := ListAllRecordSets(ctx, r53, *zone.Id)
+	fatalIfErr(err)
+	live := map[rrsetIdentity]*route53types.ResourceRecordSet{}
+	for _, rrset := range rrsets {
+		live[identityOf(rrset)] = rrset
+	}
+
+	additions, deletions, err := entry.undoChanges(live)
+	fatalIfErr(err)
+	fmt.Printf("Undoing '%s' on %s at %s (%s)\n", entry.Command, aws.ToString(zone.Name), entry.Time.Local().Format(time.RFC1123), entry.Id)
+	if len(additions)+len(deletions) == 0 {
+		fmt.Println("Nothing to undo.")
+		return
+	}
+	if args.dryrun {
+		fmt.Println("Dry-run, changes that would be made:")
+		printChanges(additions, deletions)
+		return
+	}
+	changes := batchChanges(ctx, additions, deletions, zone, false)
+	fmt.Printf("%d changes undone (%d additions / %d deletions)\n", len(additions)+len(deletions), len(additions), len(deletions))
+	if args.wait {
+		waitForChanges(ctx, changes)
+	}
+	if args.verify.enabled {
+		verifyChanges(ctx, zone, additions, deletions, args.verify)
+	}
+}
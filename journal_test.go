@@ -0,0 +1,89 @@
+package cli53
+
+import (
+	"testing"
+
+	route53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func liveRRSets(rrsets ...*route53types.ResourceRecordSet) map[rrsetIdentity]*route53types.ResourceRecordSet {
+	live := map[rrsetIdentity]*route53types.ResourceRecordSet{}
+	for _, rrset := range rrsets {
+		live[identityOf(rrset)] = rrset
+	}
+	return live
+}
+
+func TestJournalEntryUndo(t *testing.T) {
+	old := testRRSet("a.example.com.", route53types.RRTypeA, "127.0.0.1")
+	updated := testRRSet("a.example.com.", route53types.RRTypeA, "127.0.0.2")
+	previous := testRRSet("b.example.com.", route53types.RRTypeA, "127.0.0.3")
+	upserted := testRRSet("b.example.com.", route53types.RRTypeA, "127.0.0.4")
+	created := testRRSet("c.example.com.", route53types.RRTypeA, "127.0.0.5")
+	deleted := testRRSet("d.example.com.", route53types.RRTypeA, "127.0.0.6")
+	additions := []route53types.Change{
+		change(route53types.ChangeActionCreate, updated),
+		change(route53types.ChangeActionUpsert, upserted),
+		change(route53types.ChangeActionCreate, created),
+	}
+	deletions := []route53types.Change{
+		change(route53types.ChangeActionDelete, old),
+		change(route53types.ChangeActionDelete, deleted),
+	}
+	entry := newJournalEntry(testZone, additions, deletions, liveRRSets(old, previous, deleted))
+	assert.Equal(t, []*route53types.ResourceRecordSet{old, previous, deleted}, entry.Before)
+	assert.Equal(t, []*route53types.ResourceRecordSet{updated, upserted, created}, entry.After)
+
+	a, d, err := entry.undoChanges(liveRRSets(updated, upserted, created))
+	require.NoError(t, err)
+	assert.Equal(t, []route53types.Change{
+		change(route53types.ChangeActionDelete, updated),
+		change(route53types.ChangeActionDelete, upserted),
+		change(route53types.ChangeActionDelete, created),
+	}, d)
+	assert.Equal(t, []route53types.Change{
+		change(route53types.ChangeActionCreate, old),
+		change(route53types.ChangeActionCreate, deleted),
+		change(route53types.ChangeActionCreate, previous),
+	}, a)
+
+	// refuse to undo if a record has been changed since
+	_, _, err = entry.undoChanges(liveRRSets(updated, upserted, created, deleted))
+	assert.EqualError(t, err, "Record 'd.example.com. A' has changed since journal entry '"+entry.Id+"' - not undoing")
+}
+
+func TestJournalSaveLoad(t *testing.T) {
+	t.Setenv("CLI53_JOURNAL_DIR", t.TempDir())
+	_, err := loadJournalEntry("")
+	assert.EqualError(t, err, "No journal entries found")
+
+	additions := []route53types.Change{
+		change(route53types.ChangeActionCreate, testRRSet("a.example.com.", route53types.RRTypeA, "127.0.0.1")),
+	}
+	first := newJournalEntry(testZone, additions, nil, nil)
+	first.Id = "20260101T000000Z-aaaaaa"
+	require.NoError(t, first.save())
+	second := newJournalEntry(testZone, additions, nil, nil)
+	second.Id = "20260102T000000Z-bbbbbb"
+	second.ChangeIds = []string{"/change/C1"}
+	require.NoError(t, second.save())
+
+	ids, err := journalIds()
+	require.NoError(t, err)
+	assert.Equal(t, []string{first.Id, second.Id}, ids)
+
+	latest, err := loadJournalEntry("")
+	require.NoError(t, err)
+	assert.Equal(t, second.Id, latest.Id)
+	assert.Equal(t, []string{"/change/C1"}, latest.ChangeIds)
+	assert.Equal(t, additions, latest.Changes)
+
+	named, err := loadJournalEntry(first.Id)
+	require.NoError(t, err)
+	assert.Equal(t, first.Id, named.Id)
+
+	_, err = loadJournalEntry("missing")
+	assert.EqualError(t, err, "Journal entry 'missing' not found")
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -48,6 +50,59 @@ func Main(args []string) int {
 		},
 	}
 
+	// routingFlags describe the simulated client routing policies are
+	// evaluated for
+	routingFlags := []cli.Flag{
+		&cli.StringFlag{
+			Name:  "client-country",
+			Usage: "client location for geolocation routing, as country[-subdivision][@region], e.g. US-CA",
+		},
+		&cli.StringFlag{
+			Name:  "client-region",
+			Usage: "AWS region with the lowest latency to the client, for latency routing",
+		},
+		&cli.StringSliceFlag{
+			Name:  "unhealthy",
+			Usage: "health check ID or set identifier to treat as unhealthy (repeatable)",
+		},
+		&cli.Int64Flag{
+			Name:  "seed",
+			Usage: "random seed for weighted and multivalue answers (default random)",
+		},
+	}
+	routingArgs := func(c *cli.Context) clientArgs {
+		return clientArgs{
+			country:   c.String("client-country"),
+			region:    c.String("client-region"),
+			unhealthy: c.StringSlice("unhealthy"),
+			seed:      c.Int64("seed"),
+		}
+	}
+
+	// verifyFlags verify changes on the zone's name servers once made
+	verifyFlags := []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "verify",
+			Usage: "verify the changed record sets are answered by each of the zone's name servers",
+		},
+		&cli.StringSliceFlag{
+			Name:  "nameserver",
+			Usage: "name server[:port] to verify on, instead of the zone's delegation set (repeatable)",
+		},
+		&cli.IntFlag{
+			Name:  "verify-timeout",
+			Value: 300,
+			Usage: "seconds to wait for the name servers to give the expected answers",
+		},
+	}
+	verifyOpts := func(c *cli.Context) verifyOptions {
+		return verifyOptions{
+			enabled:     c.Bool("verify"),
+			nameservers: c.StringSlice("nameserver"),
+			timeout:     time.Duration(c.Int("verify-timeout")) * time.Second,
+		}
+	}
+
 	app := cli.NewApp()
 	app.Name = "cli53"
 	app.Usage = "manage route53 DNS"
@@ -180,15 +235,45 @@ func Main(args []string) int {
 				return nil
 			},
 		},
+		{
+			Name:      "diff",
+			Usage:     "compare two bind zone files (offline)",
+			ArgsUsage: "from-file to-file",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "origin",
+					Value: "",
+					Usage: "origin for relative names in the zone files",
+				},
+			},
+			Action: func(c *cli.Context) (err error) {
+				if c.Args().Len() != 2 {
+					cli.ShowCommandHelp(c, "diff")
+					return cli.NewExitError("Expected exactly 2 parameters", 1)
+				}
+				args := diffArgs{
+					origin: c.String("origin"),
+					from:   c.Args().Get(0),
+					to:     c.Args().Get(1),
+				}
+				diffZoneFiles(args, os.Stdout)
+				return nil
+			},
+		},
 		{
 			Name:      "import",
 			Usage:     "import a bind zone file",
 			ArgsUsage: "name|ID",
-			Flags: append(commonFlags,
+			Flags: append(append(commonFlags, verifyFlags...),
 				&cli.StringFlag{
 					Name:  "file",
 					Value: "",
-					Usage: "bind zone filename, or - for stdin (required)",
+					Usage: "bind zone filename, or - for stdin (required unless --axfr)",
+				},
+				&cli.StringFlag{
+					Name:  "axfr",
+					Value: "",
+					Usage: "transfer the zone by AXFR from server[:port], instead of reading a file",
 				},
 				&cli.BoolFlag{
 					Name:  "wait",
@@ -211,6 +296,25 @@ func Main(args []string) int {
 					Aliases: []string{"n"},
 					Usage:   "perform a trial run with no changes made",
 				},
+				&cli.StringFlag{
+					Name:  "plan-out",
+					Value: "",
+					Usage: "write the changes to a plan file for apply, instead of making them",
+				},
+				&cli.BoolFlag{
+					Name:  "rollback",
+					Usage: "if a batch of changes fails, undo the batches already applied",
+				},
+				&cli.StringFlag{
+					Name:  "format",
+					Value: FormatBind,
+					Usage: "input format: bind, json, yaml, changebatch (AWS CLI --change-batch JSON), octodns, csv, tinydns, hosts or dnsmasq",
+				},
+				&cli.StringFlag{
+					Name:  "plan-format",
+					Value: "cli53",
+					Usage: "format of --plan-out and --dry-run changes: cli53 or changebatch (AWS CLI --change-batch JSON)",
+				},
 			),
 			Action: func(c *cli.Context) (err error) {
 				r53, err = getService(c)
@@ -221,18 +325,182 @@ func Main(args []string) int {
 					cli.ShowCommandHelp(c, "import")
 					return cli.NewExitError("Expected exactly 1 parameter", 1)
 				}
+				if !validFormat(c.String("format")) {
+					return cli.NewExitError("format must be bind, json, yaml, changebatch, octodns, csv, tinydns, hosts or dnsmasq", 1)
+				}
+				if c.String("format") == FormatChangeBatch && (c.Bool("replace") || c.Bool("upsert")) {
+					return cli.NewExitError("--replace and --upsert cannot be used with a change batch", 1)
+				}
+				if c.String("plan-format") != "cli53" && c.String("plan-format") != FormatChangeBatch {
+					return cli.NewExitError("plan-format must be cli53 or changebatch", 1)
+				}
+				if c.String("axfr") != "" && (c.String("file") != "" || c.String("format") != FormatBind) {
+					return cli.NewExitError("--axfr cannot be used with --file or --format", 1)
+				}
 				args := importArgs{
-					name:     c.Args().First(),
+					name:       c.Args().First(),
+					file:       c.String("file"),
+					wait:       c.Bool("wait"),
+					verify:     verifyOpts(c),
+					editauth:   c.Bool("editauth"),
+					replace:    c.Bool("replace"),
+					upsert:     c.Bool("upsert"),
+					dryrun:     c.Bool("dry-run"),
+					planOut:    c.String("plan-out"),
+					rollback:   c.Bool("rollback"),
+					format:     c.String("format"),
+					planFormat: c.String("plan-format"),
+					axfr:       c.String("axfr"),
+				}
+				ctx, cancel := theContext(c)
+				defer cancel()
+				importBind(ctx, args)
+				return nil
+			},
+		},
+		{
+			Name:  "apply",
+			Usage: "apply a plan file created by import --plan-out",
+			Flags: append(append(commonFlags, verifyFlags...),
+				&cli.StringFlag{
+					Name:  "file",
+					Value: "",
+					Usage: "plan filename (required)",
+				},
+				&cli.BoolFlag{
+					Name:  "wait",
+					Usage: "wait for changes to become live",
+				},
+				&cli.BoolFlag{
+					Name:  "rollback",
+					Usage: "if a batch of changes fails, undo the batches already applied",
+				},
+			),
+			Action: func(c *cli.Context) (err error) {
+				r53, err = getService(c)
+				if err != nil {
+					return err
+				}
+				if c.Args().Len() != 0 {
+					cli.ShowCommandHelp(c, "apply")
+					return cli.NewExitError("No parameters expected", 1)
+				}
+				if c.String("file") == "" {
+					return cli.NewExitError("--file is required", 1)
+				}
+				args := applyArgs{
 					file:     c.String("file"),
 					wait:     c.Bool("wait"),
+					verify:   verifyOpts(c),
+					rollback: c.Bool("rollback"),
+				}
+				ctx, cancel := theContext(c)
+				defer cancel()
+				applyPlan(ctx, args)
+				return nil
+			},
+		},
+		{
+			Name:      "sync",
+			Usage:     "sync zones with a directory of bind zone files named <zone>.zone",
+			ArgsUsage: "directory",
+			Flags: append(commonFlags,
+				&cli.BoolFlag{
+					Name:  "wait",
+					Usage: "wait for changes to become live",
+				},
+				&cli.BoolFlag{
+					Name:  "editauth",
+					Usage: "include SOA and NS records from zone files",
+				},
+				&cli.BoolFlag{
+					Name:  "upsert",
+					Usage: "update or replace records, do not delete existing",
+				},
+				&cli.BoolFlag{
+					Name:  "create",
+					Usage: "create zones that do not exist",
+				},
+				&cli.BoolFlag{
+					Name:    "dry-run",
+					Aliases: []string{"n"},
+					Usage:   "perform a trial run with no changes made",
+				},
+				&cli.BoolFlag{
+					Name:  "rollback",
+					Usage: "if a batch of changes fails, undo the batches already applied",
+				},
+			),
+			Action: func(c *cli.Context) (err error) {
+				r53, err = getService(c)
+				if err != nil {
+					return err
+				}
+				if c.Args().Len() != 1 {
+					cli.ShowCommandHelp(c, "sync")
+					return cli.NewExitError("Expected exactly 1 parameter", 1)
+				}
+				args := syncArgs{
+					dir:      c.Args().First(),
+					wait:     c.Bool("wait"),
 					editauth: c.Bool("editauth"),
-					replace:  c.Bool("replace"),
 					upsert:   c.Bool("upsert"),
+					create:   c.Bool("create"),
 					dryrun:   c.Bool("dry-run"),
+					rollback: c.Bool("rollback"),
 				}
 				ctx, cancel := theContext(c)
 				defer cancel()
-				importBind(ctx, args)
+				if failed := syncZones(ctx, args); failed > 0 {
+					return cli.NewExitError(fmt.Sprintf("%d zones failed to sync", failed), 1)
+				}
+				return nil
+			},
+		},
+		{
+			Name:      "drift",
+			Usage:     "check a zone for differences from a bind zone file (exit code 2 on drift)",
+			ArgsUsage: "name|ID",
+			Flags: append(commonFlags,
+				&cli.StringFlag{
+					Name:  "file",
+					Value: "",
+					Usage: "bind zone filename, or - for stdin (required)",
+				},
+				&cli.BoolFlag{
+					Name:  "editauth",
+					Usage: "include SOA and NS records from zone file",
+				},
+				&cli.StringFlag{
+					Name:    "output",
+					Aliases: []string{"o"},
+					Value:   "text",
+					Usage:   "output format: text, json",
+				},
+			),
+			Action: func(c *cli.Context) (err error) {
+				r53, err = getService(c)
+				if err != nil {
+					return err
+				}
+				if c.Args().Len() != 1 {
+					cli.ShowCommandHelp(c, "drift")
+					return cli.NewExitError("Expected exactly 1 parameter", 1)
+				}
+				if c.String("output") != "text" && c.String("output") != "json" {
+					return cli.NewExitError("output must be text or json", 1)
+				}
+				args := driftArgs{
+					name:     c.Args().First(),
+					file:     c.String("file"),
+					editauth: c.Bool("editauth"),
+					output:   c.String("output"),
+				}
+				ctx, cancel := theContext(c)
+				defer cancel()
+				if !checkDrift(ctx, args, os.Stdout) {
+					return cli.NewExitError("", DriftExitCode)
+				}
 				return nil
 			},
 		},
@@ -312,10 +580,195 @@ func Main(args []string) int {
 				return nil
 			},
 		},
+		{
+			Name:      "secondary-master",
+			Usage:     "serve zones to secondary DNS servers by AXFR/IXFR, and NOTIFY them of changes",
+			ArgsUsage: "name|ID...",
+			Flags: append(commonFlags,
+				&cli.StringFlag{
+					Name:  "listen",
+					Value: ":53",
+					Usage: "address to listen on, over UDP and TCP",
+				},
+				&cli.IntFlag{
+					Name:  "interval",
+					Value: 60,
+					Usage: "seconds between refreshing the zones from route53",
+				},
+				&cli.StringSliceFlag{
+					Name:  "allow",
+					Usage: "address or network allowed to transfer the zones (repeatable)",
+				},
+				&cli.StringSliceFlag{
+					Name:  "tsig-key",
+					Usage: "TSIG key transfers must be signed with, as [algorithm:]name:secret (repeatable)",
+				},
+				&cli.StringSliceFlag{
+					Name:  "notify",
+					Usage: "secondary server[:port] to NOTIFY when a zone changes (repeatable)",
+				},
+				&cli.IntFlag{
+					Name:  "versions",
+					Value: 10,
+					Usage: "number of zone versions to retain for IXFR",
+				},
+			),
+			Action: func(c *cli.Context) (err error) {
+				r53, err = getService(c)
+				if err != nil {
+					return err
+				}
+				if c.Args().Len() == 0 {
+					cli.ShowCommandHelp(c, "secondary-master")
+					return cli.NewExitError("Expected at least 1 parameter", 1)
+				}
+				if c.Int("interval") < 1 || c.Int("versions") < 1 {
+					return cli.NewExitError("--interval and --versions must be at least 1", 1)
+				}
+				args := secondaryArgs{
+					zones:    c.Args().Slice(),
+					listen:   c.String("listen"),
+					interval: time.Duration(c.Int("interval")) * time.Second,
+					timeout:  time.Duration(c.Float64("timeout") * float64(time.Second)),
+					allow:    c.StringSlice("allow"),
+					keys:     c.StringSlice("tsig-key"),
+					notify:   c.StringSlice("notify"),
+					versions: c.Int("versions"),
+				}
+				ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+				defer cancel()
+				if err := runSecondaryMaster(ctx, args); err != nil {
+					return cli.NewExitError(err.Error(), 1)
+				}
+				return nil
+			},
+		},
+		{
+			Name:      "ddns-gateway",
+			Usage:     "apply RFC 2136 dynamic DNS updates, signed with TSIG keys, to zones",
+			ArgsUsage: "name|ID...",
+			Flags: append(commonFlags,
+				&cli.StringFlag{
+					Name:  "listen",
+					Value: ":53",
+					Usage: "address to listen on, over UDP and TCP",
+				},
+				&cli.StringFlag{
+					Name:  "config",
+					Usage: "YAML file of the TSIG keys updates may be signed with, and the zones each may update",
+				},
+			),
+			Action: func(c *cli.Context) (err error) {
+				r53, err = getService(c)
+				if err != nil {
+					return err
+				}
+				if c.Args().Len() == 0 {
+					cli.ShowCommandHelp(c, "ddns-gateway")
+					return cli.NewExitError("Expected at least 1 parameter", 1)
+				}
+				if c.String("config") == "" {
+					return cli.NewExitError("--config is required", 1)
+				}
+				args := ddnsArgs{
+					zones:   c.Args().Slice(),
+					listen:  c.String("listen"),
+					config:  c.String("config"),
+					timeout: time.Duration(c.Float64("timeout") * float64(time.Second)),
+				}
+				ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+				defer cancel()
+				if err := runDDNSGateway(ctx, args); err != nil {
+					return cli.NewExitError(err.Error(), 1)
+				}
+				return nil
+			},
+		},
+		{
+			Name:      "serve",
+			Usage:     "answer DNS queries for a zone locally, simulating its routing policies",
+			ArgsUsage: "name|ID, or the zone's name with --file",
+			Flags: append(append(commonFlags, routingFlags...),
+				&cli.StringFlag{
+					Name:  "file",
+					Usage: "bind zone file to serve, or - for stdin, instead of the live zone",
+				},
+				&cli.StringFlag{
+					Name:  "listen",
+					Value: "127.0.0.1:5353",
+					Usage: "address to listen on, over UDP and TCP",
+				},
+				&cli.StringSliceFlag{
+					Name:  "subnet",
+					Usage: "location of clients in a network, as CIDR=country[-subdivision][@region], matched against the EDNS client subnet or client address (repeatable)",
+				},
+			),
+			Action: func(c *cli.Context) (err error) {
+				r53, err = getService(c)
+				if err != nil {
+					return err
+				}
+				if c.Args().Len() != 1 {
+					cli.ShowCommandHelp(c, "serve")
+					return cli.NewExitError("Expected exactly 1 parameter", 1)
+				}
+				args := serveArgs{
+					name:    c.Args().First(),
+					file:    c.String("file"),
+					listen:  c.String("listen"),
+					timeout: time.Duration(c.Float64("timeout") * float64(time.Second)),
+					client:  routingArgs(c),
+					subnets: c.StringSlice("subnet"),
+				}
+				ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+				defer cancel()
+				if err := runServe(ctx, args); err != nil {
+					return cli.NewExitError(err.Error(), 1)
+				}
+				return nil
+			},
+		},
+		{
+			Name:      "resolve",
+			Usage:     "explain which records route53 would answer with for a simulated client (offline)",
+			ArgsUsage: "zone name [type]",
+			Flags: append(append(commonFlags, routingFlags...),
+				&cli.StringFlag{
+					Name:  "file",
+					Usage: "bind zone file to resolve in, or - for stdin, instead of the live zone",
+				},
+			),
+			Action: func(c *cli.Context) (err error) {
+				r53, err = getService(c)
+				if err != nil {
+					return err
+				}
+				if c.Args().Len() != 2 && c.Args().Len() != 3 {
+					cli.ShowCommandHelp(c, "resolve")
+					return cli.NewExitError("Expected 2 or 3 parameters", 1)
+				}
+				args := resolveArgs{
+					zone:   c.Args().Get(0),
+					file:   c.String("file"),
+					name:   c.Args().Get(1),
+					rtype:  "A",
+					client: routingArgs(c),
+				}
+				if c.Args().Len() == 3 {
+					args.rtype = c.Args().Get(2)
+				}
+				ctx, cancel := theContext(c)
+				defer cancel()
+				if err := resolveRecord(ctx, args, os.Stdout); err != nil {
+					return cli.NewExitError(err.Error(), 1)
+				}
+				return nil
+			},
+		},
 		{
 			Name:      "export",
-			Usage:     "export a bind zone file (to stdout)",
-			ArgsUsage: "name|ID",
+			Usage:     "export a bind zone file (to stdout), or all zones to a directory",
+			ArgsUsage: "name|ID, or directory with --all",
 			Flags: append(commonFlags,
 				&cli.BoolFlag{
 					Name:    "full",
@@ -326,6 +779,20 @@ func Main(args []string) int {
 					Name:  "output",
 					Usage: "Write to an output file instead of STDOUT",
 				},
+				&cli.BoolFlag{
+					Name:  "all",
+					Usage: "export every zone to <directory>/<zone>.zone, with an index.json",
+				},
+				&cli.IntFlag{
+					Name:  "concurrency",
+					Value: 4,
+					Usage: "number of zones to export at once with --all",
+				},
+				&cli.StringFlag{
+					Name:  "format",
+					Value: FormatBind,
+					Usage: "output format: bind, json, yaml, changebatch (AWS CLI --change-batch JSON), octodns, csv, hosts, dnsmasq, terraform, cloudformation or cloudformation-json",
+				},
 			),
 			Action: func(c *cli.Context) (err error) {
 				r53, err = getService(c)
@@ -336,6 +803,29 @@ func Main(args []string) int {
 					cli.ShowCommandHelp(c, "export")
 					return cli.NewExitError("Expected exactly 1 parameter", 1)
 				}
+				if !validExportFormat(c.String("format")) {
+					return cli.NewExitError("format must be bind, json, yaml, changebatch, octodns, csv, hosts, dnsmasq, terraform, cloudformation or cloudformation-json", 1)
+				}
+				if c.Bool("all") {
+					if c.String("format") != FormatBind {
+						return cli.NewExitError("--all only exports bind zone files", 1)
+					}
+					if c.String("output") != "" {
+						return cli.NewExitError("--output cannot be used with --all", 1)
+					}
+					if c.Int("concurrency") < 1 {
+						return cli.NewExitError("--concurrency must be at least 1", 1)
+					}
+					args := exportAllArgs{
+						dir:         c.Args().First(),
+						full:        c.Bool("full"),
+						concurrency: c.Int("concurrency"),
+					}
+					ctx, cancel := theContext(c)
+					defer cancel()
+					exportAll(ctx, args)
+					return nil
+				}
 
 				outputFileName := c.String("output")
 				writer := os.Stdout
@@ -348,7 +838,58 @@ func Main(args []string) int {
 				}
 				ctx, cancel := theContext(c)
 				defer cancel()
-				exportBind(ctx, c.Args().First(), c.Bool("full"), writer)
+				switch c.String("format") {
+				case FormatBind:
+					exportBind(ctx, c.Args().First(), c.Bool("full"), writer)
+				case FormatChangeBatch:
+					exportChangeBatch(ctx, c.Args().First(), writer)
+				case FormatOctoDNS:
+					exportOctoDNS(ctx, c.Args().First(), writer)
+				case FormatCSV:
+					exportCSV(ctx, c.Args().First(), writer)
+				case FormatHosts, FormatDnsmasq:
+					exportHosts(ctx, c.Args().First(), c.String("format"), writer)
+				case FormatTerraform:
+					exportTerraform(ctx, c.Args().First(), writer)
+				case FormatCloudFormation, FormatCloudFormationJSON:
+					exportCloudFormation(ctx, c.Args().First(), c.String("format"), writer)
+				default:
+					exportRecordSets(ctx, c.Args().First(), c.String("format"), writer)
+				}
+				return nil
+			},
+		},
+		{
+			Name:      "edit",
+			Usage:     "edit a domain's records in $EDITOR and apply the changes",
+			ArgsUsage: "name|ID",
+			Flags: append(commonFlags,
+				&cli.BoolFlag{
+					Name:  "wait",
+					Usage: "wait for changes to become live",
+				},
+				&cli.BoolFlag{
+					Name:  "editauth",
+					Usage: "include SOA and NS records from zone file",
+				},
+			),
+			Action: func(c *cli.Context) (err error) {
+				r53, err = getService(c)
+				if err != nil {
+					return err
+				}
+				if c.Args().Len() != 1 {
+					cli.ShowCommandHelp(c, "edit")
+					return cli.NewExitError("Expected exactly 1 parameter", 1)
+				}
+				args := editArgs{
+					name:     c.Args().First(),
+					wait:     c.Bool("wait"),
+					editauth: c.Bool("editauth"),
+				}
+				ctx, cancel := theContext(c)
+				defer cancel()
+				editZone(ctx, args)
 				return nil
 			},
 		},
@@ -357,7 +898,7 @@ func Main(args []string) int {
 			Aliases:   []string{"rc"},
 			Usage:     "create one or more records",
 			ArgsUsage: "zone record [record...]",
-			Flags: append(commonFlags,
+			Flags: append(append(commonFlags, verifyFlags...),
 				&cli.BoolFlag{
 					Name:  "wait",
 					Usage: "wait for changes to become live",
@@ -425,6 +966,7 @@ func Main(args []string) int {
 					name:            c.Args().Get(0),
 					records:         c.Args().Slice()[1:],
 					wait:            c.Bool("wait"),
+					verify:          verifyOpts(c),
 					append:          c.Bool("append"),
 					replace:         c.Bool("replace"),
 					identifier:      c.String("identifier"),
@@ -451,7 +993,7 @@ func Main(args []string) int {
 			Aliases:   []string{"rd"},
 			Usage:     "delete a record",
 			ArgsUsage: "zone prefix type",
-			Flags: append(commonFlags,
+			Flags: append(append(commonFlags, verifyFlags...),
 				&cli.BoolFlag{
 					Name:  "wait",
 					Usage: "wait for changes to become live",
@@ -473,7 +1015,7 @@ func Main(args []string) int {
 				}
 				ctx, cancel := theContext(c)
 				defer cancel()
-				deleteRecord(ctx, c.Args().Get(0), c.Args().Get(1), c.Args().Get(2), c.Bool("wait"), c.String("identifier"))
+				deleteRecord(ctx, c.Args().Get(0), c.Args().Get(1), c.Args().Get(2), c.Bool("wait"), c.String("identifier"), verifyOpts(c))
 				return nil
 			},
 		},
@@ -509,6 +1051,138 @@ func Main(args []string) int {
 				return nil
 			},
 		},
+		{
+			Name:      "undo",
+			Usage:     "undo the changes from the journal, by default the most recent",
+			ArgsUsage: "[journal-id]",
+			Flags: append(append(commonFlags, verifyFlags...),
+				&cli.BoolFlag{
+					Name:  "wait",
+					Usage: "wait for changes to become live",
+				},
+				&cli.BoolFlag{
+					Name:    "dry-run",
+					Aliases: []string{"n"},
+					Usage:   "perform a trial run with no changes made",
+				},
+			),
+			Action: func(c *cli.Context) (err error) {
+				r53, err = getService(c)
+				if err != nil {
+					return err
+				}
+				if c.Args().Len() > 1 {
+					cli.ShowCommandHelp(c, "undo")
+					return cli.NewExitError("Expected at most 1 parameter", 1)
+				}
+				args := undoArgs{
+					id:     c.Args().First(),
+					wait:   c.Bool("wait"),
+					verify: verifyOpts(c),
+					dryrun: c.Bool("dry-run"),
+				}
+				ctx, cancel := theContext(c)
+				defer cancel()
+				undo(ctx, args)
+				return nil
+			},
+		},
+		{
+			Name:      "verify",
+			Usage:     "verify the changes from the journal, by default the most recent, are answered by the zone's name servers",
+			ArgsUsage: "[journal-id]",
+			// --verify is implied
+			Flags: append(append(commonFlags, verifyFlags[1:]...),
+				&cli.StringFlag{
+					Name:  "zone",
+					Usage: "verify every record set of the zone (name or ID) instead",
+				},
+			),
+			Action: func(c *cli.Context) (err error) {
+				r53, err = getService(c)
+				if err != nil {
+					return err
+				}
+				if c.Args().Len() > 1 || (c.Args().Len() == 1 && c.String("zone") != "") {
+					cli.ShowCommandHelp(c, "verify")
+					return cli.NewExitError("Expected a journal id or --zone", 1)
+				}
+				opts := verifyOpts(c)
+				opts.enabled = true
+				args := verifyArgs{
+					id:   c.Args().First(),
+					zone: c.String("zone"),
+					opts: opts,
+				}
+				ctx, cancel := theContext(c)
+				defer cancel()
+				verify(ctx, args)
+				return nil
+			},
+		},
+		{
+			Name:  "history",
+			Usage: "list the changes made, from the local history",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "zone",
+					Usage: "only changes to this zone (name or ID)",
+				},
+				&cli.StringFlag{
+					Name:  "name",
+					Usage: "only changes to this record name",
+				},
+				&cli.StringFlag{
+					Name:  "since",
+					Usage: "only changes made at or after this date (YYYY-MM-DD or RFC3339)",
+				},
+				&cli.StringFlag{
+					Name:  "until",
+					Usage: "only changes made before this date (YYYY-MM-DD or RFC3339)",
+				},
+			},
+			Action: func(c *cli.Context) (err error) {
+				if c.Args().Len() != 0 {
+					cli.ShowCommandHelp(c, "history")
+					return cli.NewExitError("No parameters expected", 1)
+				}
+				args := historyArgs{
+					zone: c.String("zone"),
+					name: c.String("name"),
+				}
+				if c.String("since") != "" {
+					if args.since, err = parseHistoryTime(c.String("since")); err != nil {
+						return cli.NewExitError(err.Error(), 1)
+					}
+				}
+				if c.String("until") != "" {
+					if args.until, err = parseHistoryTime(c.String("until")); err != nil {
+						return cli.NewExitError(err.Error(), 1)
+					}
+				}
+				records, err := loadHistory()
+				fatalIfErr(err)
+				listHistory(records, args, os.Stdout)
+				return nil
+			},
+			Subcommands: []*cli.Command{
+				{
+					Name:      "show",
+					Usage:     "show the changes made by a history entry, as BIND records",
+					ArgsUsage: "id",
+					Action: func(c *cli.Context) (err error) {
+						if c.Args().Len() != 1 {
+							cli.ShowCommandHelp(c, "show")
+							return cli.NewExitError("Expected exactly 1 parameter", 1)
+						}
+						records, err := loadHistory()
+						fatalIfErr(err)
+						fatalIfErr(showHistory(records, c.Args().First(), os.Stdout))
+						return nil
+					},
+				},
+			},
+		},
 		{
 			Name:  "dslist",
 			Usage: "list reusable delegation sets",
@@ -566,6 +1240,9 @@ func Main(args []string) int {
 			},
 		},
 	}
+	for _, command := range app.Commands {
+		command.Before = recordInvocation
+	}
 	err := app.Run(args)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
@@ -0,0 +1,627 @@
+package cli53
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	route53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/miekg/dns"
+	"gopkg.in/yaml.v2"
+)
+
+// FormatOctoDNS is an octoDNS zone YAML file.
+const FormatOctoDNS = "octodns"
+
+// octoDNS's record type for route53 aliases.
+const octoAliasType = "Route53Provider/ALIAS"
+
+// octoDNS's default TTL, for records without one.
+const octoDefaultTTL = 3600
+
+// octoRecord is a record in an octoDNS zone file. Values are strings, or
+// maps for structured types such as MX.
+type octoRecord struct {
+	Type    string              `yaml:"type"`
+	TTL     *int64              `yaml:"ttl,omitempty"`
+	Value   interface{}         `yaml:"value,omitempty"`
+	Values  []interface{}       `yaml:"values,omitempty"`
+	Geo     map[string][]string `yaml:"geo,omitempty"`
+	Dynamic *octoDynamic        `yaml:"dynamic,omitempty"`
+}
+
+// octoRecords are the records for a name, which octoDNS allows to be a
+// single record or a list.
+type octoRecords []*octoRecord
+
+func (r *octoRecords) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var list []*octoRecord
+	if err := unmarshal(&list); err == nil {
+		*r = list
+		return nil
+	}
+	record := &octoRecord{}
+	if err := unmarshal(record); err != nil {
+		return err
+	}
+	*r = octoRecords{record}
+	return nil
+}
+
+func (r octoRecords) MarshalYAML() (interface{}, error) {
+	if len(r) == 1 {
+		return r[0], nil
+	}
+	return []*octoRecord(r), nil
+}
+
+type octoDynamic struct {
+	Pools map[string]*octoPool `yaml:"pools"`
+	Rules []*octoRule          `yaml:"rules"`
+}
+
+type octoPool struct {
+	Values []*octoPoolValue `yaml:"values"`
+}
+
+type octoPoolValue struct {
+	Value  string `yaml:"value"`
+	Weight int64  `yaml:"weight,omitempty"`
+}
+
+type octoRule struct {
+	Geos []string `yaml:"geos,omitempty"`
+	Pool string   `yaml:"pool"`
+}
+
+func (r *octoRecord) values() []interface{} {
+	if r.Value != nil {
+		return []interface{}{r.Value}
+	}
+	return r.Values
+}
+
+func (r *octoRecord) ttl() uint32 {
+	if r.TTL == nil {
+		return octoDefaultTTL
+	}
+	return uint32(*r.TTL)
+}
+
+func octoField(value interface{}, keys ...string) (interface{}, error) {
+	m, ok := value.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a map value, not '%v'", value)
+	}
+	for _, key := range keys {
+		if v, ok := m[key]; ok {
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("value is missing '%s'", keys[0])
+}
+
+// octoRdata converts an octoDNS value to the rdata of a BIND record.
+func octoRdata(rtype string, value interface{}) (string, error) {
+	fields := func(format string, keys ...[]string) (string, error) {
+		args := []interface{}{}
+		for _, k := range keys {
+			v, err := octoField(value, k...)
+			if err != nil {
+				return "", err
+			}
+			args = append(args, v)
+		}
+		return fmt.Sprintf(format, args...), nil
+	}
+	switch rtype {
+	case "MX":
+		return fields("%v %v", []string{"preference", "priority"}, []string{"exchange", "value"})
+	case "SRV":
+		return fields("%v %v %v %v", []string{"priority"}, []string{"weight"}, []string{"port"}, []string{"target"})
+	case "CAA":
+		return fields(`%v %v "%v"`, []string{"flags"}, []string{"tag"}, []string{"value"})
+	case "NAPTR":
+		return fields(`%v %v "%v" "%v" "%v" %v`, []string{"order"}, []string{"preference"}, []string{"flags"}, []string{"service"}, []string{"regexp"}, []string{"replacement"})
+	case "TXT", "SPF":
+		s, ok := value.(string)
+		if !ok {
+			return "", fmt.Errorf("expected a string value, not '%v'", value)
+		}
+		return quoteValues(chunkTXT(strings.ReplaceAll(s, `\;`, ";"))), nil
+	case "A", "AAAA", "CNAME", "NS", "PTR":
+		return fmt.Sprint(value), nil
+	}
+	return "", fmt.Errorf("unsupported type '%s'", rtype)
+}
+
+// chunkTXT splits a TXT value into strings of at most 255 characters,
+// without splitting an escape sequence.
+func chunkTXT(s string) []string {
+	chunks := []string{}
+	for len(s) > 255 {
+		n := 255
+		for n > 1 && s[n-1] == '\\' {
+			n--
+		}
+		chunks = append(chunks, s[:n])
+		s = s[n:]
+	}
+	return append(chunks, s)
+}
+
+// octoGeoLocation converts an octoDNS geo code, continent[-country[-subdivision]].
+func octoGeoLocation(code string) (*GeoLocationRoute, error) {
+	parts := strings.Split(code, "-")
+	switch len(parts) {
+	case 1:
+		return &GeoLocationRoute{ContinentCode: aws.String(parts[0])}, nil
+	case 2:
+		return &GeoLocationRoute{CountryCode: aws.String(parts[1])}, nil
+	case 3:
+		return &GeoLocationRoute{CountryCode: aws.String(parts[1]), SubdivisionCode: aws.String(parts[2])}, nil
+	}
+	return nil, fmt.Errorf("invalid geo code '%s'", code)
+}
+
+type octoConverter struct {
+	name   string
+	record *octoRecord
+}
+
+func (c *octoConverter) rr(value interface{}) (dns.RR, error) {
+	rdata, err := octoRdata(c.record.Type, value)
+	if err != nil {
+		return nil, err
+	}
+	return dns.NewRR(fmt.Sprintf("%s %d IN %s %s", c.name, c.record.ttl(), c.record.Type, rdata))
+}
+
+func (c *octoConverter) rrs(values []interface{}, route AWSRoute, identifier string) ([]dns.RR, error) {
+	records := []dns.RR{}
+	for _, value := range values {
+		rr, err := c.rr(value)
+		if err != nil {
+			return nil, err
+		}
+		if route != nil {
+			rr = &AWSRR{rr, route, nil, identifier}
+		}
+		records = append(records, rr)
+	}
+	return records, nil
+}
+
+func (c *octoConverter) aliases() ([]dns.RR, error) {
+	records := []dns.RR{}
+	for _, value := range c.record.values() {
+		target, err := octoField(value, "name")
+		if err != nil {
+			return nil, err
+		}
+		rtype, err := octoField(value, "type")
+		if err != nil {
+			return nil, err
+		}
+		zoneId := "$self"
+		if id, err := octoField(value, "hosted-zone-id"); err == nil && id != nil {
+			zoneId = fmt.Sprint(id)
+		}
+		evaluate, _ := octoField(value, "evaluate-target-health")
+		records = append(records, &dns.PrivateRR{
+			Hdr: dns.RR_Header{Name: c.name, Rrtype: TypeALIAS, Class: ClassAWS, Ttl: 86400},
+			Data: &ALIASRdata{
+				Type:                 fmt.Sprint(rtype),
+				Target:               fmt.Sprint(target),
+				ZoneId:               zoneId,
+				EvaluateTargetHealth: evaluate == true,
+			},
+		})
+	}
+	return records, nil
+}
+
+// geo converts legacy geo records: a record set for each geo code, and the
+// values as the default for everywhere else.
+func (c *octoConverter) geo() ([]dns.RR, error) {
+	codes := []string{}
+	for code := range c.record.Geo {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	records, err := c.rrs(c.record.values(), &GeoLocationRoute{CountryCode: aws.String("*")}, "default")
+	if err != nil {
+		return nil, err
+	}
+	for _, code := range codes {
+		route, err := octoGeoLocation(code)
+		if err != nil {
+			return nil, err
+		}
+		values := []interface{}{}
+		for _, value := range c.record.Geo[code] {
+			values = append(values, value)
+		}
+		rrs, err := c.rrs(values, route, code)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, rrs...)
+	}
+	return records, nil
+}
+
+func poolValues(pool *octoPool) []interface{} {
+	values := []interface{}{}
+	for _, v := range pool.Values {
+		values = append(values, v.Value)
+	}
+	return values
+}
+
+// dynamic converts dynamic records. A single rule with weighted values
+// becomes a weighted record set for each value. Otherwise rules become
+// geolocation record sets, with a rule without geos as the default. Record
+// sets are identified by their pool, and the geo code when a pool is used for
+// several.
+func (c *octoConverter) dynamic() ([]dns.RR, error) {
+	d := c.record.Dynamic
+	if len(d.Rules) == 0 {
+		return nil, errors.New("dynamic record has no rules")
+	}
+	for _, rule := range d.Rules {
+		if d.Pools[rule.Pool] == nil {
+			return nil, fmt.Errorf("rule refers to unknown pool '%s'", rule.Pool)
+		}
+	}
+
+	if len(d.Rules) == 1 && len(d.Rules[0].Geos) == 0 {
+		records := []dns.RR{}
+		for _, value := range d.Pools[d.Rules[0].Pool].Values {
+			weight := value.Weight
+			if weight == 0 {
+				weight = 1
+			}
+			rrs, err := c.rrs([]interface{}{value.Value}, &WeightedRoute{weight}, value.Value)
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, rrs...)
+		}
+		return records, nil
+	}
+
+	uses := map[string]int{}
+	for _, rule := range d.Rules {
+		uses[rule.Pool] += len(rule.Geos)
+	}
+	records := []dns.RR{}
+	for i, rule := range d.Rules {
+		pool := d.Pools[rule.Pool]
+		for _, v := range pool.Values {
+			if v.Weight > 1 {
+				return nil, fmt.Errorf("pool '%s': weighted values cannot be combined with geos", rule.Pool)
+			}
+		}
+		if len(rule.Geos) == 0 {
+			if i != len(d.Rules)-1 {
+				return nil, errors.New("only the last rule can have no geos")
+			}
+			rrs, err := c.rrs(poolValues(pool), &GeoLocationRoute{CountryCode: aws.String("*")}, rule.Pool)
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, rrs...)
+		}
+		for _, code := range rule.Geos {
+			route, err := octoGeoLocation(code)
+			if err != nil {
+				return nil, err
+			}
+			identifier := rule.Pool
+			if uses[rule.Pool] > 1 {
+				identifier += "-" + code
+			}
+			rrs, err := c.rrs(poolValues(pool), route, identifier)
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, rrs...)
+		}
+	}
+	return records, nil
+}
+
+func (c *octoConverter) convert() ([]dns.RR, error) {
+	switch {
+	case c.record.Type == octoAliasType:
+		return c.aliases()
+	case c.record.Dynamic != nil:
+		return c.dynamic()
+	case len(c.record.Geo) > 0:
+		return c.geo()
+	}
+	return c.rrs(c.record.values(), nil, "")
+}
+
+// readOctoDNS reads an octoDNS zone file as records, to be grouped into
+// record sets in the same way as a BIND zone file.
+func readOctoDNS(r io.Reader, origin string) ([]dns.RR, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	zone := map[string]octoRecords{}
+	if err := yaml.Unmarshal(data, &zone); err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for name := range zone {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	records := []dns.RR{}
+	for _, name := range names {
+		fqdn := qualifyName(name, origin)
+		for _, record := range zone[name] {
+			c := &octoConverter{fqdn, record}
+			rrs, err := c.convert()
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %s", fqdn, record.Type, err)
+			}
+			records = append(records, rrs...)
+		}
+	}
+	return records, nil
+}
+
+// octoValue converts a record to an octoDNS value.
+func octoValue(rr dns.RR) (interface{}, error) {
+	if awsrr, ok := rr.(*AWSRR); ok {
+		rr = awsrr.RR
+	}
+	switch rr := rr.(type) {
+	case *dns.A:
+		return rr.A.String(), nil
+	case *dns.AAAA:
+		return rr.AAAA.String(), nil
+	case *dns.CNAME:
+		return rr.Target, nil
+	case *dns.NS:
+		return rr.Ns, nil
+	case *dns.PTR:
+		return rr.Ptr, nil
+	case *dns.MX:
+		return map[string]interface{}{"preference": rr.Preference, "exchange": rr.Mx}, nil
+	case *dns.SRV:
+		return map[string]interface{}{"priority": rr.Priority, "weight": rr.Weight, "port": rr.Port, "target": rr.Target}, nil
+	case *dns.CAA:
+		return map[string]interface{}{"flags": rr.Flag, "tag": rr.Tag, "value": rr.Value}, nil
+	case *dns.NAPTR:
+		return map[string]interface{}{"order": rr.Order, "preference": rr.Preference, "flags": rr.Flags, "service": rr.Service, "regexp": rr.Regexp, "replacement": rr.Replacement}, nil
+	case *dns.TXT:
+		return strings.ReplaceAll(strings.Join(rr.Txt, ""), ";", `\;`), nil
+	case *dns.SPF:
+		return strings.ReplaceAll(strings.Join(rr.Txt, ""), ";", `\;`), nil
+	}
+	return nil, fmt.Errorf("unsupported type '%s'", dns.TypeToString[rr.Header().Rrtype])
+}
+
+func octoValues(rrset *route53types.ResourceRecordSet) ([]interface{}, error) {
+	values := []interface{}{}
+	for _, rr := range ConvertRRSetToBind(rrset) {
+		value, err := octoValue(rr)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// octoGeoCode converts a route53 geolocation to an octoDNS geo code, or ""
+// for the default location.
+func octoGeoCode(geo *route53types.GeoLocation) (string, error) {
+	if geo.ContinentCode != nil {
+		return *geo.ContinentCode, nil
+	}
+	country := aws.ToString(geo.CountryCode)
+	if country == "*" {
+		return "", nil
+	}
+	continent, ok := countryContinents[country]
+	if !ok {
+		return "", fmt.Errorf("unknown country '%s'", country)
+	}
+	code := continent + "-" + country
+	if geo.SubdivisionCode != nil {
+		code += "-" + *geo.SubdivisionCode
+	}
+	return code, nil
+}
+
+func newOctoRecord(rrset *route53types.ResourceRecordSet, values []interface{}) *octoRecord {
+	record := &octoRecord{Type: string(rrset.Type), TTL: rrset.TTL}
+	if len(values) == 1 {
+		record.Value = values[0]
+	} else {
+		record.Values = values
+	}
+	return record
+}
+
+// octoDynamicRecord converts a set of weighted or geolocation record sets
+// to a dynamic record.
+func octoDynamicRecord(rrsets []*route53types.ResourceRecordSet) (*octoRecord, error) {
+	dynamic := &octoDynamic{Pools: map[string]*octoPool{}}
+	var defaults []interface{}
+	if rrsets[0].Weight != nil {
+		pool := &octoPool{}
+		for _, rrset := range rrsets {
+			if rrset.Weight == nil || len(rrset.ResourceRecords) != 1 {
+				return nil, errors.New("weighted record sets must each have a single value")
+			}
+			values, err := octoValues(rrset)
+			if err != nil {
+				return nil, err
+			}
+			pool.Values = append(pool.Values, &octoPoolValue{fmt.Sprint(values[0]), *rrset.Weight})
+			defaults = append(defaults, values[0])
+		}
+		dynamic.Pools["weighted"] = pool
+		dynamic.Rules = append(dynamic.Rules, &octoRule{Pool: "weighted"})
+	} else {
+		var fallback *octoRule
+		for _, rrset := range rrsets {
+			if rrset.GeoLocation == nil {
+				return nil, errors.New("cannot mix routing policies")
+			}
+			values, err := octoValues(rrset)
+			if err != nil {
+				return nil, err
+			}
+			if _, isMap := values[0].(map[string]interface{}); isMap {
+				return nil, errors.New("only simple values can be used in dynamic records")
+			}
+			pool := &octoPool{}
+			for _, value := range values {
+				pool.Values = append(pool.Values, &octoPoolValue{Value: fmt.Sprint(value)})
+			}
+			identifier := aws.ToString(rrset.SetIdentifier)
+			dynamic.Pools[identifier] = pool
+			code, err := octoGeoCode(rrset.GeoLocation)
+			if err != nil {
+				return nil, err
+			}
+			if code == "" {
+				fallback = &octoRule{Pool: identifier}
+				defaults = values
+			} else {
+				dynamic.Rules = append(dynamic.Rules, &octoRule{Geos: []string{code}, Pool: identifier})
+			}
+		}
+		if fallback == nil {
+			return nil, errors.New("geolocation record sets have no default location")
+		}
+		dynamic.Rules = append(dynamic.Rules, fallback)
+	}
+	record := newOctoRecord(rrsets[0], defaults)
+	record.Dynamic = dynamic
+	return record, nil
+}
+
+// octoZone converts record sets to an octoDNS zone, keyed by names relative
+// to the zone. Record sets with routing octoDNS cannot represent are skipped
+// with a warning.
+func octoZone(zone *route53types.HostedZone, rrsets []*route53types.ResourceRecordSet) map[string]octoRecords {
+	type key struct {
+		name  string
+		rtype route53types.RRType
+	}
+	keys := []key{}
+	grouped := map[key][]*route53types.ResourceRecordSet{}
+	for _, rrset := range rrsets {
+		if isAuthRecord(zone, rrset) || rrset.TrafficPolicyInstanceId != nil {
+			continue
+		}
+		k := key{strings.ToLower(unescaper.Replace(*rrset.Name)), rrset.Type}
+		if rrset.AliasTarget != nil {
+			k.rtype = octoAliasType
+		}
+		if _, ok := grouped[k]; !ok {
+			keys = append(keys, k)
+		}
+		grouped[k] = append(grouped[k], rrset)
+	}
+
+	zoneId := strings.Replace(*zone.Id, "/hostedzone/", "", 1)
+	result := map[string]octoRecords{}
+	for _, k := range keys {
+		group := grouped[k]
+		var record *octoRecord
+		var err error
+		switch {
+		case k.rtype == octoAliasType:
+			record = &octoRecord{Type: octoAliasType}
+			for _, rrset := range group {
+				if rrset.SetIdentifier != nil {
+					err = errors.New("aliases with routing are not supported")
+					break
+				}
+				value := map[string]interface{}{
+					"name":                   aws.ToString(rrset.AliasTarget.DNSName),
+					"type":                   string(rrset.Type),
+					"evaluate-target-health": rrset.AliasTarget.EvaluateTargetHealth,
+				}
+				if id := aws.ToString(rrset.AliasTarget.HostedZoneId); id != zoneId {
+					value["hosted-zone-id"] = id
+				}
+				record.Values = append(record.Values, value)
+			}
+		case group[0].SetIdentifier == nil:
+			var values []interface{}
+			values, err = octoValues(group[0])
+			record = newOctoRecord(group[0], values)
+		case group[0].Weight != nil || group[0].GeoLocation != nil:
+			record, err = octoDynamicRecord(group)
+		default:
+			err = errors.New("only weighted and geolocation routing are supported")
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Skipping %s %s: %s\n", k.name, k.rtype, err)
+			continue
+		}
+		name := shortenName(k.name, *zone.Name)
+		if name == "@" {
+			name = ""
+		}
+		result[name] = append(result[name], record)
+	}
+	return result
+}
+
+func writeOctoDNS(w io.Writer, zone *route53types.HostedZone, rrsets []*route53types.ResourceRecordSet) error {
+	data, err := yaml.Marshal(octoZone(zone, rrsets))
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, "---\n"); err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func exportOctoDNS(ctx context.Context, name string, writer io.Writer) {
+	zone := lookupZone(ctx, name)
+	rrsets, err := ListAllRecordSets(ctx, r53, *zone.Id)
+	fatalIfErr(err)
+	sort.Sort(exportSorter{rrsets, *zone.Name})
+	fatalIfErr(writeOctoDNS(writer, zone, rrsets))
+}
+
+// countryContinents maps country codes to continents, for the
+// continent-country geo codes octoDNS uses.
+var countryContinents = map[string]string{}
+
+func init() {
+	for continent, countries := range map[string]string{
+		"AF": "DZ AO BJ BW BF BI CM CV CF TD KM CG CD CI DJ EG GQ ER ET GA GM GH GN GW KE LS LR LY MG MW ML MR MU YT MA MZ NA NE NG RE RW SH ST SN SC SL SO ZA SS SD SZ TZ TG TN UG EH ZM ZW",
+		"AN": "AQ BV GS HM TF",
+		"AS": "AF AM AZ BH BD BT BN KH CN CY GE HK IN ID IR IQ IL JP JO KZ KP KR KW KG LA LB MO MY MV MN MM NP OM PK PS PH QA SA SG LK SY TW TJ TH TL TR TM AE UZ VN YE IO CX CC",
+		"EU": "AX AL AD AT BY BE BA BG HR CZ DK EE FO FI FR DE GI GR GG VA HU IS IE IM IT JE XK LV LI LT LU MK MT MD MC ME NL NO PL PT RO RU SM RS SK SI ES SJ SE CH UA GB",
+		"NA": "AI AG AW BS BB BZ BM BQ VG CA KY CR CU CW DM DO SV GL GD GP GT HT HN JM MQ MX MS NI PA PR BL KN LC MF PM VC SX TT TC US VI UM",
+		"OC": "AS AU CK FJ PF GU KI MH FM NR NC NZ NU NF MP PW PG PN WS SB TK TO TV VU WF",
+		"SA": "AR BO BR CL CO EC FK GF GY PY PE SR UY VE",
+	} {
+		for _, country := range strings.Fields(countries) {
+			countryContinents[country] = continent
+		}
+	}
+}
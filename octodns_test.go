@@ -0,0 +1,149 @@
+package cli53
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	route53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testOctoDNS = `---
+'':
+  - type: MX
+    values:
+    - exchange: mx1.example.com.
+      preference: 10
+  - type: TXT
+    value: v=spf1 -all\; comment
+    octodns:
+      ignored: true
+www:
+  type: A
+  ttl: 300
+  values:
+  - 127.0.0.1
+  - 127.0.0.2
+alias:
+  type: Route53Provider/ALIAS
+  value:
+    name: www.example.com.
+    type: A
+geo:
+  type: A
+  value: 127.0.0.3
+  dynamic:
+    pools:
+      eu:
+        values:
+        - value: 127.0.0.4
+      other:
+        values:
+        - value: 127.0.0.3
+    rules:
+    - geos: [EU, NA-US-CA]
+      pool: eu
+    - pool: other
+`
+
+func TestReadOctoDNS(t *testing.T) {
+	records, err := readOctoDNS(strings.NewReader(testOctoDNS), "example.com.")
+	require.NoError(t, err)
+	grouped := groupRecords(records)
+	assert.Len(t, grouped, 7)
+
+	mx := grouped[Key{"example.com.", dns.TypeMX, ""}]
+	require.Len(t, mx, 1)
+	assert.Equal(t, "example.com.\t3600\tIN\tMX\t10 mx1.example.com.", mx[0].String())
+	txt := grouped[Key{"example.com.", dns.TypeTXT, ""}]
+	require.Len(t, txt, 1)
+	assert.Equal(t, []string{"v=spf1 -all; comment"}, txt[0].(*dns.TXT).Txt)
+
+	www := grouped[Key{"www.example.com.", dns.TypeA, ""}]
+	require.Len(t, www, 2)
+	assert.Equal(t, uint32(300), www[0].Header().Ttl)
+
+	alias := grouped[Key{"alias.example.com.", TypeALIAS, "@A"}]
+	require.Len(t, alias, 1)
+	assert.Equal(t, &ALIASRdata{Type: "A", Target: "www.example.com.", ZoneId: "$self"}, alias[0].(*dns.PrivateRR).Data)
+
+	other := grouped[Key{"geo.example.com.", dns.TypeA, "other"}]
+	require.Len(t, other, 1)
+	assert.Equal(t, &GeoLocationRoute{CountryCode: aws.String("*")}, other[0].(*AWSRR).Route)
+	eu := grouped[Key{"geo.example.com.", dns.TypeA, "eu-EU"}]
+	require.Len(t, eu, 1)
+	assert.Equal(t, &GeoLocationRoute{ContinentCode: aws.String("EU")}, eu[0].(*AWSRR).Route)
+	ca := grouped[Key{"geo.example.com.", dns.TypeA, "eu-NA-US-CA"}]
+	require.Len(t, ca, 1)
+	assert.Equal(t, &GeoLocationRoute{CountryCode: aws.String("US"), SubdivisionCode: aws.String("CA")}, ca[0].(*AWSRR).Route)
+}
+
+func TestReadOctoDNSErrors(t *testing.T) {
+	_, err := readOctoDNS(strings.NewReader("www:\n  type: SSHFP\n  value: x\n"), "example.com.")
+	assert.EqualError(t, err, "www.example.com. SSHFP: unsupported type 'SSHFP'")
+	_, err = readOctoDNS(strings.NewReader("www:\n  type: A\n  value: 127.0.0.1\n  dynamic:\n    pools: {}\n    rules:\n    - pool: missing\n"), "example.com.")
+	assert.EqualError(t, err, "www.example.com. A: rule refers to unknown pool 'missing'")
+}
+
+func TestWriteOctoDNS(t *testing.T) {
+	eu := testRRSet("geo.example.com.", route53types.RRTypeA, "127.0.0.4")
+	eu.SetIdentifier = aws.String("eu")
+	eu.GeoLocation = &route53types.GeoLocation{CountryCode: aws.String("FR")}
+	other := testRRSet("geo.example.com.", route53types.RRTypeA, "127.0.0.3")
+	other.SetIdentifier = aws.String("other")
+	other.GeoLocation = &route53types.GeoLocation{CountryCode: aws.String("*")}
+	failover := testRRSet("f.example.com.", route53types.RRTypeA, "127.0.0.2")
+	failover.SetIdentifier = aws.String("primary")
+	failover.Failover = route53types.ResourceRecordSetFailoverPrimary
+	rrsets := []*route53types.ResourceRecordSet{
+		testRRSet("example.com.", route53types.RRTypeNs, "ns-1.awsdns-1.com."),
+		testRRSet("example.com.", route53types.RRTypeTxt, `"v=spf1 -all; comment"`),
+		testRRSet("example.com.", route53types.RRTypeMx, "10 mx1.example.com."),
+		testAlias("alias.example.com.", "www.example.com."),
+		eu, other, failover,
+	}
+	w := &bytes.Buffer{}
+	require.NoError(t, writeOctoDNS(w, testZone, rrsets))
+	assert.Equal(t, `---
+"":
+- type: TXT
+  ttl: 3600
+  value: v=spf1 -all\; comment
+- type: MX
+  ttl: 3600
+  value:
+    exchange: mx1.example.com.
+    preference: 10
+alias:
+  type: Route53Provider/ALIAS
+  values:
+  - evaluate-target-health: false
+    name: www.example.com.
+    type: A
+geo:
+  type: A
+  ttl: 3600
+  value: 127.0.0.3
+  dynamic:
+    pools:
+      eu:
+        values:
+        - value: 127.0.0.4
+      other:
+        values:
+        - value: 127.0.0.3
+    rules:
+    - geos:
+      - EU-FR
+      pool: eu
+    - pool: other
+`, w.String())
+
+	records, err := readOctoDNS(w, "example.com.")
+	require.NoError(t, err)
+	assert.Len(t, groupRecords(records), 5)
+}
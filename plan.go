@@ -0,0 +1,127 @@
+package cli53
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	route53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+const planVersion = 1
+
+// importPlan is a saved set of changes produced by import --plan-out, along
+// with a fingerprint of the zone it was computed against.
+type importPlan struct {
+	Version     int                   `json:"version"`
+	ZoneId      string                `json:"zoneId"`
+	ZoneName    string                `json:"zoneName"`
+	Fingerprint string                `json:"fingerprint"`
+	Changes     []route53types.Change `json:"changes"`
+}
+
+func newImportPlan(zone *route53types.HostedZone, fingerprint string, additions, deletions []route53types.Change) *importPlan {
+	changes := []route53types.Change{}
+	changes = append(changes, deletions...)
+	changes = append(changes, additions...)
+	return &importPlan{
+		Version:     planVersion,
+		ZoneId:      *zone.Id,
+		ZoneName:    *zone.Name,
+		Fingerprint: fingerprint,
+		Changes:     changes,
+	}
+}
+
+// split the plan back into the additions and deletions batchChanges expects
+func (p *importPlan) split() (additions, deletions []route53types.Change) {
+	additions = []route53types.Change{}
+	deletions = []route53types.Change{}
+	for _, change := range p.Changes {
+		if change.Action == route53types.ChangeActionDelete {
+			deletions = append(deletions, change)
+		} else {
+			additions = append(additions, change)
+		}
+	}
+	return
+}
+
+// zoneFingerprint returns a digest of the record sets in a zone, independent
+// of the order they were listed in.
+func zoneFingerprint(rrsets []*route53types.ResourceRecordSet) string {
+	lines := []string{}
+	for _, rrset := range rrsets {
+		data, err := json.Marshal(rrset)
+		fatalIfErr(err)
+		lines = append(lines, string(data))
+	}
+	sort.Strings(lines)
+	hash := sha256.New()
+	for _, line := range lines {
+		hash.Write([]byte(line))
+		hash.Write([]byte("\n"))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func writePlanFile(filename string, plan *importPlan) error {
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append(data, '\n'), 0o644)
+}
+
+func readPlanFile(filename string) (*importPlan, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	plan := &importPlan{}
+	if err := json.Unmarshal(data, plan); err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+	if plan.Version != planVersion {
+		return nil, fmt.Errorf("%s: unsupported plan version %d", filename, plan.Version)
+	}
+	return plan, nil
+}
+
+type applyArgs struct {
+	file     string
+	wait     bool
+	rollback bool
+	verify   verifyOptions
+}
+
+func applyPlan(ctx context.Context, args applyArgs) {
+	plan, err := readPlanFile(args.file)
+	fatalIfErr(err)
+
+	zone := lookupZone(ctx, plan.ZoneId)
+	rrsets, err := ListAllRecordSets(ctx, r53, *zone.Id)
+	fatalIfErr(err)
+	if zoneFingerprint(rrsets) != plan.Fingerprint {
+		errorAndExit(fmt.Sprintf("Zone '%s' has changed since the plan was created - create a new plan", *zone.Name))
+	}
+
+	additions, deletions := plan.split()
+	if len(additions)+len(deletions) == 0 {
+		fmt.Println("Plan has no changes - nothing to apply.")
+		return
+	}
+	changes := batchChanges(ctx, additions, deletions, zone, args.rollback)
+	fmt.Printf("%d changes applied (%d additions / %d deletions)\n", len(additions)+len(deletions), len(additions), len(deletions))
+
+	if args.wait {
+		waitForChanges(ctx, changes)
+	}
+	if args.verify.enabled {
+		verifyChanges(ctx, zone, additions, deletions, args.verify)
+	}
+}
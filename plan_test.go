@@ -0,0 +1,85 @@
+package cli53
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	route53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testZone = &route53types.HostedZone{
+	Id:   aws.String("/hostedzone/Z1RWMUCMCPKCJX"),
+	Name: aws.String("example.com."),
+}
+
+func testRRSet(name string, rtype route53types.RRType, values ...string) *route53types.ResourceRecordSet {
+	rrset := &route53types.ResourceRecordSet{
+		Name: aws.String(name),
+		Type: rtype,
+		TTL:  aws.Int64(3600),
+	}
+	for _, value := range values {
+		rrset.ResourceRecords = append(rrset.ResourceRecords, route53types.ResourceRecord{Value: aws.String(value)})
+	}
+	return rrset
+}
+
+func TestImportChangesReplace(t *testing.T) {
+	records := parseBindFile(strings.NewReader("a 3600 IN A 127.0.0.1\nb 3600 IN A 127.0.0.2\n"), "", "example.com.")
+	existing := []*route53types.ResourceRecordSet{
+		testRRSet("example.com.", route53types.RRTypeNs, "ns1.example.net."),
+		testRRSet("a.example.com.", route53types.RRTypeA, "127.0.0.1"),
+		testRRSet("c.example.com.", route53types.RRTypeA, "127.0.0.3"),
+	}
+	additions, deletions := importChanges(testZone, records, existing, importArgs{replace: true})
+	require.Len(t, additions, 1)
+	assert.Equal(t, route53types.ChangeActionCreate, additions[0].Action)
+	assert.Equal(t, "b.example.com.", *additions[0].ResourceRecordSet.Name)
+	require.Len(t, deletions, 1)
+	assert.Equal(t, route53types.ChangeActionDelete, deletions[0].Action)
+	assert.Equal(t, "c.example.com.", *deletions[0].ResourceRecordSet.Name)
+}
+
+func TestImportChangesUpsert(t *testing.T) {
+	records := parseBindFile(strings.NewReader("a 3600 IN A 127.0.0.9\n"), "", "example.com.")
+	existing := []*route53types.ResourceRecordSet{
+		testRRSet("a.example.com.", route53types.RRTypeA, "127.0.0.1"),
+	}
+	additions, deletions := importChanges(testZone, records, existing, importArgs{upsert: true})
+	require.Len(t, additions, 1)
+	assert.Equal(t, route53types.ChangeActionUpsert, additions[0].Action)
+	assert.Empty(t, deletions)
+}
+
+func TestZoneFingerprint(t *testing.T) {
+	a := testRRSet("a.example.com.", route53types.RRTypeA, "127.0.0.1")
+	b := testRRSet("b.example.com.", route53types.RRTypeA, "127.0.0.2")
+	fingerprint := zoneFingerprint([]*route53types.ResourceRecordSet{a, b})
+	assert.Equal(t, fingerprint, zoneFingerprint([]*route53types.ResourceRecordSet{b, a}))
+
+	changed := testRRSet("b.example.com.", route53types.RRTypeA, "127.0.0.3")
+	assert.NotEqual(t, fingerprint, zoneFingerprint([]*route53types.ResourceRecordSet{a, changed}))
+}
+
+func TestPlanFileRoundTrip(t *testing.T) {
+	additions := []route53types.Change{
+		{Action: route53types.ChangeActionCreate, ResourceRecordSet: testRRSet("a.example.com.", route53types.RRTypeA, "127.0.0.1")},
+	}
+	deletions := []route53types.Change{
+		{Action: route53types.ChangeActionDelete, ResourceRecordSet: testRRSet("b.example.com.", route53types.RRTypeA, "127.0.0.2")},
+	}
+	filename := filepath.Join(t.TempDir(), "plan.json")
+	require.NoError(t, writePlanFile(filename, newImportPlan(testZone, "abc", additions, deletions)))
+
+	plan, err := readPlanFile(filename)
+	require.NoError(t, err)
+	assert.Equal(t, "/hostedzone/Z1RWMUCMCPKCJX", plan.ZoneId)
+	assert.Equal(t, "abc", plan.Fingerprint)
+	a, d := plan.split()
+	assert.Equal(t, additions, a)
+	assert.Equal(t, deletions, d)
+}
@@ -0,0 +1,265 @@
+package cli53
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	route53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/miekg/dns"
+	"gopkg.in/yaml.v2"
+)
+
+// Formats for import and export.
+const (
+	FormatBind = "bind"
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+)
+
+func validFormat(format string) bool {
+	return format == FormatBind || format == FormatJSON || format == FormatYAML || format == FormatChangeBatch || format == FormatOctoDNS || format == FormatCSV || format == FormatTinydns || format == FormatHosts || format == FormatDnsmasq
+}
+
+// validExportFormat reports whether format can be exported: tinydns is
+// import only.
+func validExportFormat(format string) bool {
+	return (validFormat(format) && format != FormatTinydns) || format == FormatTerraform || format == FormatCloudFormation || format == FormatCloudFormationJSON
+}
+
+// recordSetFile is the structured (JSON or YAML) representation of a zone's
+// record sets. Relative names are qualified with the origin, or the zone
+// name if there is no origin.
+type recordSetFile struct {
+	Origin     string            `json:"origin,omitempty" yaml:"origin,omitempty"`
+	RecordSets []*recordSetEntry `json:"recordSets" yaml:"recordSets"`
+}
+
+type recordSetEntry struct {
+	Name          string            `json:"name" yaml:"name"`
+	Type          string            `json:"type" yaml:"type"`
+	TTL           *int64            `json:"ttl,omitempty" yaml:"ttl,omitempty"`
+	Values        []string          `json:"values,omitempty" yaml:"values,omitempty"`
+	Alias         *aliasEntry       `json:"alias,omitempty" yaml:"alias,omitempty"`
+	SetIdentifier string            `json:"setIdentifier,omitempty" yaml:"setIdentifier,omitempty"`
+	Failover      string            `json:"failover,omitempty" yaml:"failover,omitempty"`
+	Weight        *int64            `json:"weight,omitempty" yaml:"weight,omitempty"`
+	Region        string            `json:"region,omitempty" yaml:"region,omitempty"`
+	GeoLocation   *geoLocationEntry `json:"geoLocation,omitempty" yaml:"geoLocation,omitempty"`
+	MultiValue    bool              `json:"multiValue,omitempty" yaml:"multiValue,omitempty"`
+	HealthCheckId string            `json:"healthCheckId,omitempty" yaml:"healthCheckId,omitempty"`
+}
+
+// aliasEntry is an alias target. A zoneId of $self refers to the zone being
+// imported into.
+type aliasEntry struct {
+	Target               string `json:"target" yaml:"target"`
+	ZoneId               string `json:"zoneId" yaml:"zoneId"`
+	EvaluateTargetHealth bool   `json:"evaluateTargetHealth" yaml:"evaluateTargetHealth"`
+}
+
+type geoLocationEntry struct {
+	ContinentCode   string `json:"continentCode,omitempty" yaml:"continentCode,omitempty"`
+	CountryCode     string `json:"countryCode,omitempty" yaml:"countryCode,omitempty"`
+	SubdivisionCode string `json:"subdivisionCode,omitempty" yaml:"subdivisionCode,omitempty"`
+}
+
+func optString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return aws.String(s)
+}
+
+func newRecordSetEntry(rrset *route53types.ResourceRecordSet, zone *route53types.HostedZone) *recordSetEntry {
+	entry := &recordSetEntry{
+		Name:          unescaper.Replace(*rrset.Name),
+		Type:          string(rrset.Type),
+		TTL:           rrset.TTL,
+		SetIdentifier: aws.ToString(rrset.SetIdentifier),
+		Failover:      string(rrset.Failover),
+		Weight:        rrset.Weight,
+		Region:        string(rrset.Region),
+		MultiValue:    aws.ToBool(rrset.MultiValueAnswer),
+		HealthCheckId: aws.ToString(rrset.HealthCheckId),
+	}
+	for _, rr := range rrset.ResourceRecords {
+		entry.Values = append(entry.Values, aws.ToString(rr.Value))
+	}
+	if alias := rrset.AliasTarget; alias != nil {
+		entry.Alias = &aliasEntry{
+			Target:               aws.ToString(alias.DNSName),
+			ZoneId:               aws.ToString(alias.HostedZoneId),
+			EvaluateTargetHealth: alias.EvaluateTargetHealth,
+		}
+		if entry.Alias.ZoneId == strings.Replace(*zone.Id, "/hostedzone/", "", 1) {
+			entry.Alias.ZoneId = "$self"
+		}
+	}
+	if geo := rrset.GeoLocation; geo != nil {
+		entry.GeoLocation = &geoLocationEntry{
+			ContinentCode:   aws.ToString(geo.ContinentCode),
+			CountryCode:     aws.ToString(geo.CountryCode),
+			SubdivisionCode: aws.ToString(geo.SubdivisionCode),
+		}
+	}
+	return entry
+}
+
+// routed reports whether the entry has a routing policy, which requires a
+// set identifier.
+func (e *recordSetEntry) routed() bool {
+	return e.Failover != "" || e.Weight != nil || e.Region != "" || e.GeoLocation != nil || e.MultiValue
+}
+
+func (e *recordSetEntry) rrset(origin string) (*route53types.ResourceRecordSet, error) {
+	if e.Name == "" {
+		return nil, errors.New("name is required")
+	}
+	name := qualifyName(e.Name, origin)
+	if e.Type == "" {
+		return nil, fmt.Errorf("%s: type is required", name)
+	}
+	if _, ok := dns.StringToType[e.Type]; !ok {
+		return nil, fmt.Errorf("%s: unknown type '%s'", name, e.Type)
+	}
+	if (len(e.Values) == 0) == (e.Alias == nil) {
+		return nil, fmt.Errorf("%s %s: exactly one of values or alias is required", name, e.Type)
+	}
+	if e.Alias == nil && e.TTL == nil {
+		return nil, fmt.Errorf("%s %s: ttl is required", name, e.Type)
+	}
+	if e.routed() && e.SetIdentifier == "" {
+		return nil, fmt.Errorf("%s %s: setIdentifier is required with a routing policy", name, e.Type)
+	}
+
+	rrset := &route53types.ResourceRecordSet{
+		Name:          aws.String(name),
+		Type:          route53types.RRType(e.Type),
+		SetIdentifier: optString(e.SetIdentifier),
+		Failover:      route53types.ResourceRecordSetFailover(e.Failover),
+		Weight:        e.Weight,
+		Region:        route53types.ResourceRecordSetRegion(e.Region),
+		HealthCheckId: optString(e.HealthCheckId),
+	}
+	if e.Alias == nil {
+		rrset.TTL = e.TTL
+		for _, value := range e.Values {
+			rrset.ResourceRecords = append(rrset.ResourceRecords, route53types.ResourceRecord{Value: aws.String(value)})
+		}
+	} else {
+		rrset.AliasTarget = &route53types.AliasTarget{
+			DNSName:              aws.String(e.Alias.Target),
+			HostedZoneId:         aws.String(e.Alias.ZoneId),
+			EvaluateTargetHealth: e.Alias.EvaluateTargetHealth,
+		}
+	}
+	if e.GeoLocation != nil {
+		rrset.GeoLocation = &route53types.GeoLocation{
+			ContinentCode:   optString(e.GeoLocation.ContinentCode),
+			CountryCode:     optString(e.GeoLocation.CountryCode),
+			SubdivisionCode: optString(e.GeoLocation.SubdivisionCode),
+		}
+	}
+	if e.MultiValue {
+		rrset.MultiValueAnswer = aws.Bool(true)
+	}
+	return rrset, nil
+}
+
+// writeRecordSets writes record sets in the JSON or YAML format.
+func writeRecordSets(w io.Writer, format string, zone *route53types.HostedZone, rrsets []*route53types.ResourceRecordSet) error {
+	file := recordSetFile{
+		Origin:     *zone.Name,
+		RecordSets: []*recordSetEntry{},
+	}
+	for _, rrset := range rrsets {
+		if rrset.TrafficPolicyInstanceId != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Skipping traffic policy record %s\n", *rrset.Name)
+			continue
+		}
+		file.RecordSets = append(file.RecordSets, newRecordSetEntry(rrset, zone))
+	}
+	switch format {
+	case FormatJSON:
+		data, err := json.MarshalIndent(file, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(data, '\n'))
+		return err
+	case FormatYAML:
+		data, err := yaml.Marshal(file)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+	return fmt.Errorf("Unsupported format '%s'", format)
+}
+
+// readRecordSets reads record sets in the JSON or YAML format, rejecting
+// unknown fields. Relative names are qualified with origin, unless the file
+// has its own origin.
+func readRecordSets(r io.Reader, format, origin string) ([]*route53types.ResourceRecordSet, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	file := recordSetFile{}
+	switch format {
+	case FormatJSON:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&file)
+	case FormatYAML:
+		err = yaml.UnmarshalStrict(data, &file)
+	default:
+		err = fmt.Errorf("Unsupported format '%s'", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if file.Origin != "" {
+		origin = absolute(file.Origin)
+	}
+	rrsets := []*route53types.ResourceRecordSet{}
+	for i, entry := range file.RecordSets {
+		rrset, err := entry.rrset(origin)
+		if err != nil {
+			return nil, fmt.Errorf("record set %d: %s", i+1, err)
+		}
+		rrsets = append(rrsets, rrset)
+	}
+	return rrsets, nil
+}
+
+// rrsetsToRecords converts record sets to records, as parsed from a BIND
+// file, so they can be imported in the same way.
+func rrsetsToRecords(rrsets []*route53types.ResourceRecordSet) ([]dns.RR, error) {
+	records := []dns.RR{}
+	for _, rrset := range rrsets {
+		rrs := ConvertRRSetToBind(rrset)
+		if len(rrs) == 0 {
+			return nil, fmt.Errorf("%s: unsupported type '%s'", *rrset.Name, rrset.Type)
+		}
+		records = append(records, rrs...)
+	}
+	return records, nil
+}
+
+func exportRecordSets(ctx context.Context, name, format string, writer io.Writer) {
+	zone := lookupZone(ctx, name)
+	rrsets, err := ListAllRecordSets(ctx, r53, *zone.Id)
+	fatalIfErr(err)
+	sort.Sort(exportSorter{rrsets, *zone.Name})
+	fatalIfErr(writeRecordSets(writer, format, zone, rrsets))
+}
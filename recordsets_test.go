@@ -0,0 +1,104 @@
+package cli53
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	route53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func routedRRSets() []*route53types.ResourceRecordSet {
+	plain := testRRSet("example.com.", route53types.RRTypeTxt, `"v=spf1 -all"`, `"hello world"`)
+	weighted := testRRSet("w.example.com.", route53types.RRTypeA, "127.0.0.1")
+	weighted.SetIdentifier = aws.String("one")
+	weighted.Weight = aws.Int64(10)
+	failover := testRRSet("f.example.com.", route53types.RRTypeA, "127.0.0.2")
+	failover.SetIdentifier = aws.String("primary")
+	failover.Failover = route53types.ResourceRecordSetFailoverPrimary
+	failover.HealthCheckId = aws.String("9a3e0c2f-1234-4c1d-8f00-000000000000")
+	latency := testRRSet("l.example.com.", route53types.RRTypeAaaa, "::1")
+	latency.SetIdentifier = aws.String("eu")
+	latency.Region = route53types.ResourceRecordSetRegionEuWest1
+	geo := testRRSet("g.example.com.", route53types.RRTypeA, "127.0.0.3")
+	geo.SetIdentifier = aws.String("us-ca")
+	geo.GeoLocation = &route53types.GeoLocation{CountryCode: aws.String("US"), SubdivisionCode: aws.String("CA")}
+	multi := testRRSet("m.example.com.", route53types.RRTypeA, "127.0.0.4")
+	multi.SetIdentifier = aws.String("m1")
+	multi.MultiValueAnswer = aws.Bool(true)
+	alias := testAlias("a.example.com.", "w.example.com.")
+	return []*route53types.ResourceRecordSet{plain, weighted, failover, latency, geo, multi, alias}
+}
+
+func TestRecordSetsRoundTrip(t *testing.T) {
+	for _, format := range []string{FormatJSON, FormatYAML} {
+		t.Run(format, func(t *testing.T) {
+			rrsets := routedRRSets()
+			w := &bytes.Buffer{}
+			require.NoError(t, writeRecordSets(w, format, testZone, rrsets))
+
+			read, err := readRecordSets(w, format, "example.org.")
+			require.NoError(t, err)
+			// the alias to this zone is written as $self
+			assert.Equal(t, "$self", *read[6].AliasTarget.HostedZoneId)
+			read[6].AliasTarget.HostedZoneId = rrsets[6].AliasTarget.HostedZoneId
+			assert.Equal(t, rrsets, read)
+
+			// and survives conversion to records for import
+			records, err := rrsetsToRecords(read)
+			require.NoError(t, err)
+			for i, rrset := range read {
+				n := len(rrset.ResourceRecords)
+				if n == 0 {
+					n = 1
+				}
+				converted := ConvertBindToRRSet(records[:n])
+				records = records[n:]
+				assert.Equal(t, canonicalRRSet(rrset), canonicalRRSet(converted), "record set %d", i)
+			}
+		})
+	}
+}
+
+func TestReadRecordSetsYAML(t *testing.T) {
+	input := `recordSets:
+- name: www
+  type: A
+  ttl: 300
+  values: [192.0.2.1, 192.0.2.2]
+- name: "@"
+  type: A
+  alias:
+    target: www
+    zoneId: $self
+    evaluateTargetHealth: false
+`
+	rrsets, err := readRecordSets(strings.NewReader(input), FormatYAML, "example.com.")
+	require.NoError(t, err)
+	require.Len(t, rrsets, 2)
+	assert.Equal(t, "www.example.com.", *rrsets[0].Name)
+	assert.Equal(t, int64(300), *rrsets[0].TTL)
+	assert.Len(t, rrsets[0].ResourceRecords, 2)
+	assert.Equal(t, "example.com.", *rrsets[1].Name)
+	assert.Equal(t, "www", *rrsets[1].AliasTarget.DNSName)
+}
+
+func TestReadRecordSetsErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{`{"recordSets": [{"name": "www", "type": "A", "values": ["192.0.2.1"]}]}`, "record set 1: www.example.com. A: ttl is required"},
+		{`{"recordSets": [{"name": "www", "type": "A", "ttl": 300}]}`, "record set 1: www.example.com. A: exactly one of values or alias is required"},
+		{`{"recordSets": [{"name": "www", "type": "BOGUS", "ttl": 300, "values": ["x"]}]}`, "record set 1: www.example.com.: unknown type 'BOGUS'"},
+		{`{"recordSets": [{"name": "www", "type": "A", "ttl": 300, "values": ["192.0.2.1"], "weight": 1}]}`, "record set 1: www.example.com. A: setIdentifier is required with a routing policy"},
+		{`{"recordSets": [{"name": "www", "type": "A", "tll": 300}]}`, `json: unknown field "tll"`},
+	}
+	for _, test := range tests {
+		_, err := readRecordSets(strings.NewReader(test.input), FormatJSON, "example.com.")
+		assert.EqualError(t, err, test.err)
+	}
+}
@@ -0,0 +1,77 @@
+package cli53
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+type resolveArgs struct {
+	zone   string
+	file   string
+	name   string
+	rtype  string
+	client clientArgs
+}
+
+// resolveName qualifies a name given relative to a zone's origin.
+func resolveName(name, origin string) string {
+	name = strings.ToLower(name)
+	if dns.IsSubDomain(origin, dns.Fqdn(name)) {
+		return dns.Fqdn(name)
+	}
+	return qualifyName(name, origin)
+}
+
+// resolveRecord explains the answer route53 would give a simulated client
+// for a name and type, writing each step of the routing decisions and the
+// answer. Aliases outside the zone are not looked up.
+func resolveRecord(ctx context.Context, args resolveArgs, w io.Writer) error {
+	client, err := newRoutingClient(args.client)
+	if err != nil {
+		return err
+	}
+	qtype, ok := dns.StringToType[strings.ToUpper(args.rtype)]
+	if !ok {
+		return fmt.Errorf("Unknown record type '%s'", args.rtype)
+	}
+	zone, rrsets, err := loadRoutingZone(ctx, args.zone, args.file)
+	if err != nil {
+		return err
+	}
+	s := newZoneServer(zone, rrsets, client, nil)
+	s.router.resolve = nil
+	name := resolveName(args.name, s.origin)
+	if !dns.IsSubDomain(s.origin, name) {
+		return fmt.Errorf("%s is not in the zone %s", name, s.origin)
+	}
+
+	fmt.Fprintf(w, "Query: %s %s\n", name, dns.TypeToString[qtype])
+	fmt.Fprintf(w, "Client: %s", client.location())
+	if len(args.client.unhealthy) > 0 {
+		unhealthy := append([]string{}, args.client.unhealthy...)
+		sort.Strings(unhealthy)
+		fmt.Fprintf(w, ", unhealthy: %s", strings.Join(unhealthy, ", "))
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Decision path:")
+	client.trace = func(step string) { fmt.Fprintf(w, "  %s\n", step) }
+	m := &dns.Msg{}
+	if err := s.answer(ctx, client, m, name, qtype); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Answer: %s\n", dns.RcodeToString[m.Rcode])
+	for _, rr := range m.Answer {
+		fmt.Fprintln(w, rr)
+	}
+	if !m.Authoritative {
+		for _, rr := range m.Ns {
+			fmt.Fprintln(w, rr)
+		}
+	}
+	return nil
+}
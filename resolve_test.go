@@ -0,0 +1,58 @@
+package cli53
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testResolve(t *testing.T, args resolveArgs) string {
+	file := filepath.Join(t.TempDir(), "zone.txt")
+	require.NoError(t, os.WriteFile(file, []byte(testRoutingZone), 0644))
+	args.zone, args.file = "example.com", file
+	w := &bytes.Buffer{}
+	require.NoError(t, resolveRecord(context.Background(), args, w))
+	return w.String()
+}
+
+func TestResolveName(t *testing.T) {
+	assert.Equal(t, "www.example.com.", resolveName("www", "example.com."))
+	assert.Equal(t, "www.example.com.", resolveName("WWW.example.com", "example.com."))
+	assert.Equal(t, "example.com.", resolveName("@", "example.com."))
+}
+
+func TestResolveRecord(t *testing.T) {
+	out := testResolve(t, resolveArgs{name: "www", rtype: "a", client: clientArgs{country: "FR"}})
+	assert.Equal(t, `Query: www.example.com. A
+Client: FR
+Decision path:
+  www.example.com. A: the record set is an alias to geo.example.com. in the zone
+  geo.example.com. A: geolocation routing between 4 record sets, for a client in FR
+  geo.example.com. A: "Europe" matches the client's continent EU
+Answer: NOERROR
+www.example.com.	300	IN	A	192.0.2.10
+`, out)
+
+	out = testResolve(t, resolveArgs{name: "failover", rtype: "A", client: clientArgs{unhealthy: []string{"hc-primary"}}})
+	assert.Contains(t, out, `failover.example.com. A: primary "primary" is unhealthy, failing over to secondary "secondary"`)
+	assert.Contains(t, out, "failover.example.com.\t300\tIN\tA\t192.0.2.21\n")
+
+	out = testResolve(t, resolveArgs{name: "latency", rtype: "A", client: clientArgs{region: "us-west-1"}})
+	assert.Contains(t, out, `latency.example.com. A: "west" is in the client's region us-west-1`)
+
+	out = testResolve(t, resolveArgs{name: "mail", rtype: "A"})
+	assert.Contains(t, out, "mail.example.com. is a CNAME to a.example.com.")
+
+	out = testResolve(t, resolveArgs{name: "nope", rtype: "A"})
+	assert.Contains(t, out, "Answer: NXDOMAIN\n")
+}
+
+func TestResolveRecordErrors(t *testing.T) {
+	err := resolveRecord(context.Background(), resolveArgs{zone: "example.com", file: "-", name: "www", rtype: "BOGUS"}, &bytes.Buffer{})
+	assert.EqualError(t, err, "Unknown record type 'BOGUS'")
+}
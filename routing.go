@@ -0,0 +1,448 @@
+package cli53
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	route53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/miekg/dns"
+)
+
+// The maximum number of records a multivalue answer returns.
+const maxMultiValueAnswers = 8
+
+// groupRRSets groups record sets by name and type, skipping traffic policy
+// records.
+func groupRRSets(rrsets []*route53types.ResourceRecordSet) map[rrsetIdentity][]*route53types.ResourceRecordSet {
+	groups := map[rrsetIdentity][]*route53types.ResourceRecordSet{}
+	for _, rrset := range rrsets {
+		if rrset.TrafficPolicyInstanceId != nil {
+			log.Printf("Warning: Skipping traffic policy record %s", *rrset.Name)
+			continue
+		}
+		id := rrsetIdentity{Name: strings.ToLower(unescaper.Replace(*rrset.Name)), Type: rrset.Type}
+		groups[id] = append(groups[id], rrset)
+	}
+	return groups
+}
+
+// routingClient is the simulated client a query is routed for.
+type routingClient struct {
+	country     string
+	subdivision string
+	region      string
+	// health check IDs and set identifiers to treat as unhealthy
+	unhealthy map[string]bool
+	rand      *rand.Rand
+	// trace, if set, is given each step of the routing decisions
+	trace func(step string)
+}
+
+// tracef traces a step of a routing decision.
+func (c *routingClient) tracef(format string, args ...interface{}) {
+	if c.trace != nil {
+		c.trace(fmt.Sprintf(format, args...))
+	}
+}
+
+// explain traces a step of the routing decision for a record set.
+func (c *routingClient) explain(rrset *route53types.ResourceRecordSet, format string, args ...interface{}) {
+	if c.trace != nil {
+		name := strings.ToLower(unescaper.Replace(*rrset.Name))
+		c.tracef("%s %s: %s", name, rrset.Type, fmt.Sprintf(format, args...))
+	}
+}
+
+// describe names a record set in a routing decision.
+func describe(rrset *route53types.ResourceRecordSet) string {
+	if rrset.SetIdentifier == nil {
+		return "the record set"
+	}
+	return fmt.Sprintf("%q", *rrset.SetIdentifier)
+}
+
+// parseClientLocation parses a client location given as
+// country[-subdivision][@region], such as US-CA@us-west-1. Each part is
+// optional.
+func parseClientLocation(s string) (country, subdivision, region string, err error) {
+	location := s
+	if i := strings.Index(s, "@"); i >= 0 {
+		location, region = s[:i], s[i+1:]
+	}
+	country, subdivision, _ = strings.Cut(strings.ToUpper(location), "-")
+	if country != "" {
+		if _, ok := countryContinents[country]; !ok {
+			return "", "", "", fmt.Errorf("Unknown country '%s' in client location '%s'", country, s)
+		}
+	}
+	return country, subdivision, region, nil
+}
+
+// clientArgs are the options describing a simulated client.
+type clientArgs struct {
+	country   string
+	region    string
+	unhealthy []string
+	seed      int64
+}
+
+// newRoutingClient returns the client described by the options. A seed of
+// 0 picks a random one.
+func newRoutingClient(args clientArgs) (*routingClient, error) {
+	country, subdivision, region, err := parseClientLocation(args.country)
+	if err != nil {
+		return nil, err
+	}
+	if args.region != "" {
+		region = args.region
+	}
+	seed := args.seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	client := &routingClient{
+		country:     country,
+		subdivision: subdivision,
+		region:      region,
+		unhealthy:   map[string]bool{},
+		rand:        rand.New(rand.NewSource(seed)),
+	}
+	for _, id := range args.unhealthy {
+		client.unhealthy[id] = true
+	}
+	return client, nil
+}
+
+// location describes where the client is, for logging.
+func (c *routingClient) location() string {
+	location := c.country
+	if c.subdivision != "" {
+		location += "-" + c.subdivision
+	}
+	if c.region != "" {
+		location += "@" + c.region
+	}
+	if location == "" {
+		return "unknown location"
+	}
+	return location
+}
+
+func (c *routingClient) continent() string {
+	return countryContinents[c.country]
+}
+
+func (c *routingClient) healthy(rrset *route53types.ResourceRecordSet) bool {
+	if rrset.HealthCheckId != nil && c.unhealthy[*rrset.HealthCheckId] {
+		return false
+	}
+	return rrset.SetIdentifier == nil || !c.unhealthy[*rrset.SetIdentifier]
+}
+
+// healthyOnly returns the healthy record sets of a group, or all of them if
+// none are healthy, as route53 does.
+func (c *routingClient) healthyOnly(group []*route53types.ResourceRecordSet) []*route53types.ResourceRecordSet {
+	healthy := []*route53types.ResourceRecordSet{}
+	for _, rrset := range group {
+		if c.healthy(rrset) {
+			healthy = append(healthy, rrset)
+		} else {
+			c.explain(rrset, "%s is unhealthy", describe(rrset))
+		}
+	}
+	if len(healthy) == 0 {
+		c.explain(group[0], "all record sets are unhealthy, so all are considered")
+		return group
+	}
+	return healthy
+}
+
+// route selects the record sets route53 answers with for the client, from
+// a group sharing a name and type:
+//
+//   - failover: the PRIMARY record set if healthy, else the SECONDARY
+//   - geolocation: the most specific match of subdivision, country,
+//     continent and the default location (country *), or none
+//   - latency: the record set for the client's region, or the first region
+//     by name if it has none
+//   - weighted: a record set chosen at random in proportion to its weight
+//   - multivalue answer: up to 8 record sets, shuffled
+//
+// Unhealthy record sets are skipped unless all are unhealthy.
+func (c *routingClient) route(group []*route53types.ResourceRecordSet) []*route53types.ResourceRecordSet {
+	first := group[0]
+	if first.SetIdentifier == nil {
+		if first.AliasTarget == nil {
+			c.explain(first, "simple routing")
+		}
+		return group
+	}
+	sorted := append([]*route53types.ResourceRecordSet{}, group...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return aws.ToString(sorted[i].SetIdentifier) < aws.ToString(sorted[j].SetIdentifier)
+	})
+	switch {
+	case aws.ToBool(first.MultiValueAnswer):
+		c.explain(first, "multivalue answer routing between %d record sets", len(sorted))
+		healthy := c.healthyOnly(sorted)
+		c.rand.Shuffle(len(healthy), func(i, j int) { healthy[i], healthy[j] = healthy[j], healthy[i] })
+		if len(healthy) > maxMultiValueAnswers {
+			c.explain(first, "answering with %d of the %d record sets, at random", maxMultiValueAnswers, len(healthy))
+			healthy = healthy[:maxMultiValueAnswers]
+		}
+		return healthy
+	case first.Failover != "":
+		var primary, secondary *route53types.ResourceRecordSet
+		for _, rrset := range sorted {
+			if rrset.Failover == route53types.ResourceRecordSetFailoverPrimary {
+				primary = rrset
+			} else {
+				secondary = rrset
+			}
+		}
+		c.explain(first, "failover routing")
+		switch {
+		case primary != nil && c.healthy(primary):
+			c.explain(primary, "primary %s is healthy", describe(primary))
+			return []*route53types.ResourceRecordSet{primary}
+		case secondary != nil && (primary == nil || c.healthy(secondary)):
+			if primary != nil {
+				c.explain(primary, "primary %s is unhealthy, failing over to secondary %s", describe(primary), describe(secondary))
+			} else {
+				c.explain(secondary, "there is no primary, answering with secondary %s", describe(secondary))
+			}
+			return []*route53types.ResourceRecordSet{secondary}
+		case primary != nil:
+			c.explain(primary, "primary %s is unhealthy, and so is the secondary, so answering with the primary", describe(primary))
+			return []*route53types.ResourceRecordSet{primary}
+		}
+	case first.GeoLocation != nil:
+		c.explain(first, "geolocation routing between %d record sets, for a client in %s", len(sorted), c.location())
+		if rrset, match := c.geoMatch(c.healthyOnly(sorted)); rrset != nil {
+			c.explain(rrset, "%s matches the client's %s", describe(rrset), match)
+			return []*route53types.ResourceRecordSet{rrset}
+		}
+		c.explain(first, "no location matches the client, and there is no default location, so there is no answer")
+	case first.Weight != nil:
+		c.explain(first, "weighted routing between %d record sets", len(sorted))
+		healthy := c.healthyOnly(sorted)
+		var total int64
+		for _, rrset := range healthy {
+			total += aws.ToInt64(rrset.Weight)
+		}
+		if total == 0 {
+			rrset := healthy[c.rand.Intn(len(healthy))]
+			c.explain(rrset, "all weights are 0, so %s was chosen at random", describe(rrset))
+			return []*route53types.ResourceRecordSet{rrset}
+		}
+		n := c.rand.Int63n(total)
+		for _, rrset := range healthy {
+			if n < aws.ToInt64(rrset.Weight) {
+				c.explain(rrset, "%s was chosen at random, with weight %d of %d", describe(rrset), aws.ToInt64(rrset.Weight), total)
+				return []*route53types.ResourceRecordSet{rrset}
+			}
+			n -= aws.ToInt64(rrset.Weight)
+		}
+	case first.Region != "":
+		c.explain(first, "latency routing between %d record sets", len(sorted))
+		healthy := c.healthyOnly(sorted)
+		sort.SliceStable(healthy, func(i, j int) bool { return healthy[i].Region < healthy[j].Region })
+		for _, rrset := range healthy {
+			if string(rrset.Region) == c.region {
+				c.explain(rrset, "%s is in the client's region %s", describe(rrset), c.region)
+				return []*route53types.ResourceRecordSet{rrset}
+			}
+		}
+		if c.region == "" {
+			c.explain(healthy[0], "the client's region is not known, so answering with %s in the first region, %s", describe(healthy[0]), healthy[0].Region)
+		} else {
+			c.explain(healthy[0], "no record set is in the client's region %s, so answering with %s in the first region, %s", c.region, describe(healthy[0]), healthy[0].Region)
+		}
+		return healthy[:1]
+	}
+	return nil
+}
+
+// geoMatch returns the record set for the client's most specific location,
+// and which location it matched.
+func (c *routingClient) geoMatch(group []*route53types.ResourceRecordSet) (*route53types.ResourceRecordSet, string) {
+	matches := func(match func(geo *route53types.GeoLocation) bool) *route53types.ResourceRecordSet {
+		for _, rrset := range group {
+			if rrset.GeoLocation != nil && match(rrset.GeoLocation) {
+				return rrset
+			}
+		}
+		return nil
+	}
+	if c.country != "" && c.subdivision != "" {
+		if rrset := matches(func(geo *route53types.GeoLocation) bool {
+			return aws.ToString(geo.CountryCode) == c.country && aws.ToString(geo.SubdivisionCode) == c.subdivision
+		}); rrset != nil {
+			return rrset, "subdivision " + c.country + "-" + c.subdivision
+		}
+	}
+	if c.country != "" {
+		if rrset := matches(func(geo *route53types.GeoLocation) bool {
+			return aws.ToString(geo.CountryCode) == c.country && geo.SubdivisionCode == nil
+		}); rrset != nil {
+			return rrset, "country " + c.country
+		}
+	}
+	if c.continent() != "" {
+		if rrset := matches(func(geo *route53types.GeoLocation) bool {
+			return aws.ToString(geo.ContinentCode) == c.continent()
+		}); rrset != nil {
+			return rrset, "continent " + c.continent()
+		}
+	}
+	return matches(func(geo *route53types.GeoLocation) bool {
+		return aws.ToString(geo.CountryCode) == "*"
+	}), "default location"
+}
+
+// router answers queries for a zone's names as route53 would for a
+// simulated client. Aliases to records in the zone, including $self
+// aliases, are resolved within the zone; A and AAAA aliases to other
+// targets are looked up, unless there is no resolver.
+type router struct {
+	zone    *route53types.HostedZone
+	groups  map[rrsetIdentity][]*route53types.ResourceRecordSet
+	resolve ipResolver
+}
+
+func newRouter(zone *route53types.HostedZone, rrsets []*route53types.ResourceRecordSet, resolve ipResolver) *router {
+	return &router{zone, groupRRSets(rrsets), resolve}
+}
+
+// nameExists reports whether a name has records, or names below it do.
+func (r *router) nameExists(name string) bool {
+	for id := range r.groups {
+		if id.Name == name || strings.HasSuffix(id.Name, "."+name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *router) selfAlias(alias *route53types.AliasTarget) bool {
+	zoneId := aws.ToString(alias.HostedZoneId)
+	return zoneId == "$self" || zoneId == strings.Replace(*r.zone.Id, "/hostedzone/", "", 1)
+}
+
+// records returns the client's answer for a name and type, as records
+// named owner. The answer is empty if there are no such records, or no
+// routing branch matches the client.
+func (r *router) records(ctx context.Context, client *routingClient, name string, rtype route53types.RRType, owner string, depth int) ([]dns.RR, error) {
+	group := r.groups[rrsetIdentity{Name: name, Type: rtype}]
+	if len(group) == 0 {
+		return nil, nil
+	}
+	records := []dns.RR{}
+	for _, rrset := range client.route(group) {
+		var rrs []dns.RR
+		if rrset.AliasTarget != nil {
+			var err error
+			rrs, err = r.alias(ctx, client, rrset, owner, depth)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			plain := &route53types.ResourceRecordSet{Name: aws.String(owner), Type: rrset.Type, TTL: rrset.TTL, ResourceRecords: rrset.ResourceRecords}
+			rrs = ConvertRRSetToBind(plain)
+		}
+		for _, rr := range rrs {
+			duplicate := false
+			for _, record := range records {
+				duplicate = duplicate || dns.IsDuplicate(record, rr)
+			}
+			if !duplicate {
+				records = append(records, rr)
+			}
+		}
+	}
+	return records, nil
+}
+
+func (r *router) alias(ctx context.Context, client *routingClient, rrset *route53types.ResourceRecordSet, owner string, depth int) ([]dns.RR, error) {
+	target := strings.ToLower(unescaper.Replace(dns.Fqdn(aws.ToString(rrset.AliasTarget.DNSName))))
+	if r.selfAlias(rrset.AliasTarget) {
+		if depth >= maxAliasDepth {
+			return nil, fmt.Errorf("alias chain to %s is too long", target)
+		}
+		client.explain(rrset, "%s is an alias to %s in the zone", describe(rrset), target)
+		return r.records(ctx, client, target, rrset.Type, owner, depth+1)
+	}
+	network := map[route53types.RRType]string{route53types.RRTypeA: "ip4", route53types.RRTypeAaaa: "ip6"}[rrset.Type]
+	if network == "" {
+		return nil, fmt.Errorf("cannot resolve %s alias to %s outside the zone", rrset.Type, target)
+	}
+	if r.resolve == nil {
+		client.explain(rrset, "%s is an alias to %s outside the zone, which is not looked up", describe(rrset), target)
+		return nil, nil
+	}
+	ips, err := r.resolve(ctx, network, target)
+	if err != nil {
+		return nil, err
+	}
+	client.explain(rrset, "%s is an alias to %s outside the zone, which has %d addresses", describe(rrset), target, len(ips))
+	records := []dns.RR{}
+	for _, ip := range ips {
+		hdr := dns.RR_Header{Name: owner, Rrtype: dns.StringToType[string(rrset.Type)], Class: dns.ClassINET, Ttl: flattenedAliasTTL}
+		if network == "ip4" {
+			records = append(records, &dns.A{Hdr: hdr, A: ip})
+		} else {
+			records = append(records, &dns.AAAA{Hdr: hdr, AAAA: ip})
+		}
+	}
+	return records, nil
+}
+
+// loadRoutingZone returns the record sets of a zone: read from a BIND file
+// if one is given, with name as its origin, otherwise listed from route53.
+// Record sets read from a file belong to a zone with the ID $self, so that
+// $self aliases resolve within it.
+func loadRoutingZone(ctx context.Context, name, file string) (*route53types.HostedZone, []*route53types.ResourceRecordSet, error) {
+	if file == "" {
+		zone, err := findZone(ctx, name)
+		if err != nil {
+			return nil, nil, err
+		}
+		rrsets, err := ListAllRecordSets(ctx, r53, *zone.Id)
+		if err != nil {
+			return nil, nil, err
+		}
+		return zone, rrsets, nil
+	}
+	zone := &route53types.HostedZone{Name: aws.String(dns.Fqdn(strings.ToLower(name))), Id: aws.String("$self")}
+	var f *os.File
+	if file == "-" {
+		f = os.Stdin
+	} else {
+		var err error
+		if f, err = os.Open(file); err != nil {
+			return nil, nil, err
+		}
+		defer f.Close()
+	}
+	records, err := parseBindFileErr(f, file, *zone.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+	expandSelfAliases(records, zone)
+	rrsets := []*route53types.ResourceRecordSet{}
+	for _, group := range groupRecords(records) {
+		if !supportedRecord(group[0]) {
+			fmt.Fprintf(os.Stderr, "Warning: Skipping unsupported record %s\n", group[0])
+			continue
+		}
+		rrsets = append(rrsets, ConvertBindToRRSet(group))
+	}
+	return zone, rrsets, nil
+}
@@ -0,0 +1,119 @@
+package cli53
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	route53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRoutingZone = `$TTL 300
+@	3600	IN	SOA	ns-1.awsdns-1.com. awsdns-hostmaster.amazon.com. 1 7200 900 1209600 86400
+@	3600	IN	NS	ns-1.awsdns-1.com.
+a	IN	A	192.0.2.1
+geo	IN	A	192.0.2.10 ; AWS routing="GEOLOCATION" continentCode="EU" identifier="Europe"
+geo	IN	A	192.0.2.11 ; AWS routing="GEOLOCATION" countryCode="DE" identifier="Germany"
+geo	IN	A	192.0.2.12 ; AWS routing="GEOLOCATION" countryCode="US" subdivisionCode="CA" identifier="California"
+geo	IN	A	192.0.2.13 ; AWS routing="GEOLOCATION" countryCode="*" identifier="Default"
+geo	86400	AWS	ALIAS	AAAA v6 $self false ; AWS routing="GEOLOCATION" countryCode="*" identifier="Default"
+v6	IN	AAAA	2001:db8::1
+failover	IN	A	192.0.2.20 ; AWS routing="FAILOVER" failover="PRIMARY" healthCheckId="hc-primary" identifier="primary"
+failover	IN	A	192.0.2.21 ; AWS routing="FAILOVER" failover="SECONDARY" identifier="secondary"
+latency	IN	A	192.0.2.30 ; AWS routing="LATENCY" region="us-west-1" identifier="west"
+latency	IN	A	192.0.2.31 ; AWS routing="LATENCY" region="eu-west-1" identifier="europe"
+w	IN	A	192.0.2.40 ; AWS routing="WEIGHTED" weight=0 identifier="never"
+w	IN	A	192.0.2.41 ; AWS routing="WEIGHTED" weight=10 identifier="always"
+www	86400	AWS	ALIAS	A geo $self false
+*.wild	IN	TXT	"wildcard"
+mail	IN	CNAME	a
+sub	IN	NS	ns1.example.net.
+`
+
+func testRouter(t *testing.T) (*route53types.HostedZone, []*route53types.ResourceRecordSet) {
+	file := filepath.Join(t.TempDir(), "zone.txt")
+	require.NoError(t, os.WriteFile(file, []byte(testRoutingZone), 0644))
+	zone, rrsets, err := loadRoutingZone(context.Background(), "example.com", file)
+	require.NoError(t, err)
+	return zone, rrsets
+}
+
+func testClient(location string, unhealthy ...string) *routingClient {
+	client, err := newRoutingClient(clientArgs{country: location, unhealthy: unhealthy, seed: 1})
+	if err != nil {
+		panic(err)
+	}
+	return client
+}
+
+func TestParseClientLocation(t *testing.T) {
+	country, subdivision, region, err := parseClientLocation("us-ca@us-west-1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"US", "CA", "us-west-1"}, []string{country, subdivision, region})
+	country, subdivision, region, err = parseClientLocation("DE")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"DE", "", ""}, []string{country, subdivision, region})
+	_, _, _, err = parseClientLocation("XX")
+	assert.EqualError(t, err, "Unknown country 'XX' in client location 'XX'")
+}
+
+func TestRouterRecords(t *testing.T) {
+	zone, rrsets := testRouter(t)
+	r := newRouter(zone, rrsets, fakeResolver)
+	answer := func(client *routingClient, name string, rtype route53types.RRType) []string {
+		records, err := r.records(context.Background(), client, name, rtype, name, 0)
+		require.NoError(t, err)
+		return recordStrings(records)
+	}
+
+	// geolocation: subdivision, then country, continent and default
+	assert.Equal(t, []string{"geo.example.com. 300 IN A 192.0.2.12"}, answer(testClient("US-CA"), "geo.example.com.", "A"))
+	assert.Equal(t, []string{"geo.example.com. 300 IN A 192.0.2.11"}, answer(testClient("DE"), "geo.example.com.", "A"))
+	assert.Equal(t, []string{"geo.example.com. 300 IN A 192.0.2.10"}, answer(testClient("FR"), "geo.example.com.", "A"))
+	assert.Equal(t, []string{"geo.example.com. 300 IN A 192.0.2.13"}, answer(testClient("JP"), "geo.example.com.", "A"))
+	assert.Equal(t, []string{"geo.example.com. 300 IN A 192.0.2.13"}, answer(testClient(""), "geo.example.com.", "A"))
+
+	// aliases to the zone take the answer of their target
+	assert.Equal(t, []string{"www.example.com. 300 IN A 192.0.2.11"}, answer(testClient("DE"), "www.example.com.", "A"))
+	assert.Equal(t, []string{"geo.example.com. 300 IN AAAA 2001:db8::1"}, answer(testClient("DE"), "geo.example.com.", "AAAA"))
+
+	// failover honours the simulated health
+	assert.Equal(t, []string{"failover.example.com. 300 IN A 192.0.2.20"}, answer(testClient(""), "failover.example.com.", "A"))
+	assert.Equal(t, []string{"failover.example.com. 300 IN A 192.0.2.21"}, answer(testClient("", "hc-primary"), "failover.example.com.", "A"))
+
+	// weighted never picks a zero weight
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, []string{"w.example.com. 300 IN A 192.0.2.41"}, answer(testClient(""), "w.example.com.", "A"))
+	}
+	assert.Equal(t, []string{"w.example.com. 300 IN A 192.0.2.40"}, answer(testClient("", "always"), "w.example.com.", "A"))
+	assert.Empty(t, answer(testClient(""), "nope.example.com.", "A"))
+}
+
+func TestRoutingClientLatency(t *testing.T) {
+	west := &route53types.ResourceRecordSet{SetIdentifier: aws.String("west"), Region: "us-west-1"}
+	europe := &route53types.ResourceRecordSet{SetIdentifier: aws.String("europe"), Region: "eu-west-1"}
+	client := &routingClient{region: "us-west-1", rand: rand.New(rand.NewSource(1))}
+	assert.Equal(t, []*route53types.ResourceRecordSet{west}, client.route([]*route53types.ResourceRecordSet{west, europe}))
+	client.region = ""
+	assert.Equal(t, []*route53types.ResourceRecordSet{europe}, client.route([]*route53types.ResourceRecordSet{west, europe}))
+	client.unhealthy = map[string]bool{"europe": true}
+	assert.Equal(t, []*route53types.ResourceRecordSet{west}, client.route([]*route53types.ResourceRecordSet{west, europe}))
+}
+
+func TestRoutingClientMultiValue(t *testing.T) {
+	group := []*route53types.ResourceRecordSet{}
+	for _, id := range []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10"} {
+		group = append(group, &route53types.ResourceRecordSet{SetIdentifier: aws.String(id), MultiValueAnswer: aws.Bool(true)})
+	}
+	client := &routingClient{unhealthy: map[string]bool{"3": true}, rand: rand.New(rand.NewSource(1))}
+	selected := client.route(group)
+	assert.Len(t, selected, maxMultiValueAnswers)
+	for _, rrset := range selected {
+		assert.NotEqual(t, "3", *rrset.SetIdentifier)
+	}
+}
@@ -0,0 +1,608 @@
+package cli53
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	route53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/miekg/dns"
+)
+
+// The TTL of alias records flattened to the addresses of a target outside
+// the zone, such as a load balancer, whose own TTL is not known.
+const flattenedAliasTTL = 60
+
+// The maximum length of an alias chain within a zone.
+const maxAliasDepth = 8
+
+// The approximate size of each message of a zone transfer.
+const transferMessageSize = 16384
+
+type secondaryArgs struct {
+	zones    []string
+	listen   string
+	interval time.Duration
+	timeout  time.Duration
+	allow    []string
+	keys     []string
+	notify   []string
+	versions int
+}
+
+// ipResolver looks up the addresses of a host, as net.Resolver.LookupIP.
+type ipResolver func(ctx context.Context, network, host string) ([]net.IP, error)
+
+// flattener converts a zone's record sets into the plain records a
+// secondary server can serve. Record sets with routing policies are
+// flattened to a single default branch:
+//
+//   - failover: the PRIMARY record set
+//   - geolocation: the default location (country *), or none if there is none
+//   - weighted: the record set with the highest weight
+//   - latency: the record set for the first region, by name
+//   - multivalue answer: all values, combined
+//
+// Aliases are replaced by the values of their target: the flattened record
+// set for targets in the zone, otherwise the target's current A or AAAA
+// addresses, looked up with a TTL of 60 seconds.
+type flattener struct {
+	zone    *route53types.HostedZone
+	groups  map[rrsetIdentity][]*route53types.ResourceRecordSet
+	resolve ipResolver
+}
+
+func newFlattener(zone *route53types.HostedZone, rrsets []*route53types.ResourceRecordSet, resolve ipResolver) *flattener {
+	return &flattener{zone, groupRRSets(rrsets), resolve}
+}
+
+// branch selects the record sets to serve from a group sharing a name and
+// type.
+func branch(group []*route53types.ResourceRecordSet) []*route53types.ResourceRecordSet {
+	first := group[0]
+	if first.SetIdentifier == nil {
+		return group
+	}
+	sorted := append([]*route53types.ResourceRecordSet{}, group...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return aws.ToString(sorted[i].SetIdentifier) < aws.ToString(sorted[j].SetIdentifier)
+	})
+	switch {
+	case aws.ToBool(first.MultiValueAnswer):
+		return sorted
+	case first.Failover != "":
+		for _, rrset := range sorted {
+			if rrset.Failover == route53types.ResourceRecordSetFailoverPrimary {
+				return []*route53types.ResourceRecordSet{rrset}
+			}
+		}
+	case first.GeoLocation != nil:
+		for _, rrset := range sorted {
+			if rrset.GeoLocation != nil && aws.ToString(rrset.GeoLocation.CountryCode) == "*" {
+				return []*route53types.ResourceRecordSet{rrset}
+			}
+		}
+	case first.Weight != nil:
+		best := sorted[0]
+		for _, rrset := range sorted {
+			if aws.ToInt64(rrset.Weight) > aws.ToInt64(best.Weight) {
+				best = rrset
+			}
+		}
+		return []*route53types.ResourceRecordSet{best}
+	case first.Region != "":
+		sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Region < sorted[j].Region })
+		return sorted[:1]
+	}
+	return nil
+}
+
+// values returns the flattened values and TTL of a name and type.
+func (f *flattener) values(ctx context.Context, id rrsetIdentity, depth int) ([]string, int64, error) {
+	group := f.groups[id]
+	if len(group) == 0 {
+		return nil, 0, fmt.Errorf("%s not found", id)
+	}
+	selected := branch(group)
+	if len(selected) == 0 {
+		return nil, 0, errors.New("no default routing branch")
+	}
+	values := []string{}
+	seen := map[string]bool{}
+	var ttl int64
+	for _, rrset := range selected {
+		var vs []string
+		var t int64
+		if rrset.AliasTarget != nil {
+			var err error
+			vs, t, err = f.alias(ctx, rrset, depth)
+			if err != nil {
+				return nil, 0, err
+			}
+		} else {
+			t = aws.ToInt64(rrset.TTL)
+			for _, rr := range rrset.ResourceRecords {
+				vs = append(vs, aws.ToString(rr.Value))
+			}
+		}
+		if ttl == 0 || t < ttl {
+			ttl = t
+		}
+		for _, v := range vs {
+			if !seen[v] {
+				seen[v] = true
+				values = append(values, v)
+			}
+		}
+	}
+	return values, ttl, nil
+}
+
+func (f *flattener) alias(ctx context.Context, rrset *route53types.ResourceRecordSet, depth int) ([]string, int64, error) {
+	target := strings.ToLower(unescaper.Replace(dns.Fqdn(aws.ToString(rrset.AliasTarget.DNSName))))
+	zoneId := strings.Replace(*f.zone.Id, "/hostedzone/", "", 1)
+	if aws.ToString(rrset.AliasTarget.HostedZoneId) == zoneId {
+		if depth >= maxAliasDepth {
+			return nil, 0, fmt.Errorf("alias chain to %s is too long", target)
+		}
+		return f.values(ctx, rrsetIdentity{Name: target, Type: rrset.Type}, depth+1)
+	}
+	network := map[route53types.RRType]string{route53types.RRTypeA: "ip4", route53types.RRTypeAaaa: "ip6"}[rrset.Type]
+	if network == "" {
+		return nil, 0, fmt.Errorf("cannot resolve %s alias to %s outside the zone", rrset.Type, target)
+	}
+	ips, err := f.resolve(ctx, network, target)
+	if err != nil {
+		return nil, 0, err
+	}
+	values := []string{}
+	for _, ip := range ips {
+		values = append(values, ip.String())
+	}
+	sort.Strings(values)
+	return values, flattenedAliasTTL, nil
+}
+
+// flatten returns the zone's SOA record and its other records, flattened.
+// Record sets that cannot be flattened are skipped with a warning.
+func (f *flattener) flatten(ctx context.Context) (*dns.SOA, []dns.RR, error) {
+	ids := []rrsetIdentity{}
+	for id := range f.groups {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if ids[i].Name != ids[j].Name {
+			return ids[i].Name < ids[j].Name
+		}
+		return ids[i].Type < ids[j].Type
+	})
+
+	var soa *dns.SOA
+	records := []dns.RR{}
+	for _, id := range ids {
+		values, ttl, err := f.values(ctx, id, 0)
+		if err != nil {
+			log.Printf("Warning: Skipping %s %s: %s", id.Name, id.Type, err)
+			continue
+		}
+		rrset := &route53types.ResourceRecordSet{Name: aws.String(id.Name), Type: id.Type, TTL: aws.Int64(ttl)}
+		for _, value := range values {
+			rrset.ResourceRecords = append(rrset.ResourceRecords, route53types.ResourceRecord{Value: aws.String(value)})
+		}
+		for _, rr := range ConvertRRSetToBind(rrset) {
+			if s, ok := rr.(*dns.SOA); ok {
+				soa = s
+			} else {
+				records = append(records, rr)
+			}
+		}
+	}
+	if soa == nil {
+		return nil, nil, fmt.Errorf("zone %s has no SOA record", *f.zone.Name)
+	}
+	return soa, records, nil
+}
+
+// zoneVersion is the content of a zone at a serial number.
+type zoneVersion struct {
+	serial      uint32
+	records     []dns.RR
+	fingerprint string
+}
+
+// servedZone is a zone served to secondaries, retaining recent versions for
+// incremental transfers.
+type servedZone struct {
+	mu       sync.RWMutex
+	name     string
+	zone     *route53types.HostedZone
+	soa      *dns.SOA
+	versions []*zoneVersion
+	retain   int
+}
+
+func recordsFingerprint(soa *dns.SOA, records []dns.RR) string {
+	s := *soa
+	s.Serial = 0
+	lines := []string{s.String()}
+	for _, rr := range records {
+		lines = append(lines, rr.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// update sets the zone's content, synthesizing a new serial if it has
+// changed: the current time, or one more than the last serial if that is
+// later. It reports whether the zone changed.
+func (z *servedZone) update(soa *dns.SOA, records []dns.RR, now time.Time) bool {
+	sort.Slice(records, func(i, j int) bool { return records[i].String() < records[j].String() })
+	fingerprint := recordsFingerprint(soa, records)
+
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	current := z.current()
+	if current != nil && current.fingerprint == fingerprint {
+		return false
+	}
+	serial := uint32(now.Unix())
+	if current != nil && int32(serial-current.serial) <= 0 {
+		serial = current.serial + 1
+	}
+	z.soa = soa
+	z.versions = append(z.versions, &zoneVersion{serial, records, fingerprint})
+	if len(z.versions) > z.retain {
+		z.versions = z.versions[len(z.versions)-z.retain:]
+	}
+	return true
+}
+
+func (z *servedZone) current() *zoneVersion {
+	if len(z.versions) == 0 {
+		return nil
+	}
+	return z.versions[len(z.versions)-1]
+}
+
+func (z *servedZone) soaRecord(serial uint32) *dns.SOA {
+	soa := dns.Copy(z.soa).(*dns.SOA)
+	soa.Serial = serial
+	return soa
+}
+
+// currentSOA returns the SOA record of the current version, or nil if the
+// zone has not been loaded.
+func (z *servedZone) currentSOA() *dns.SOA {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+	current := z.current()
+	if current == nil {
+		return nil
+	}
+	return z.soaRecord(current.serial)
+}
+
+// axfr returns the records of a full zone transfer.
+func (z *servedZone) axfr() []dns.RR {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+	return z.full()
+}
+
+func (z *servedZone) full() []dns.RR {
+	current := z.current()
+	if current == nil {
+		return nil
+	}
+	soa := z.soaRecord(current.serial)
+	records := append([]dns.RR{soa}, current.records...)
+	return append(records, soa)
+}
+
+// ixfr returns the records of an incremental transfer from serial: only the
+// SOA if it is current, the differences if the version is retained,
+// otherwise a full transfer.
+func (z *servedZone) ixfr(serial uint32) []dns.RR {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+	current := z.current()
+	if current == nil {
+		return nil
+	}
+	if current.serial == serial {
+		return []dns.RR{z.soaRecord(serial)}
+	}
+	var old *zoneVersion
+	for _, version := range z.versions {
+		if version.serial == serial {
+			old = version
+		}
+	}
+	if old == nil {
+		return z.full()
+	}
+
+	in := func(records []dns.RR) map[string]bool {
+		m := map[string]bool{}
+		for _, rr := range records {
+			m[rr.String()] = true
+		}
+		return m
+	}
+	oldSet, newSet := in(old.records), in(current.records)
+	soa := z.soaRecord(current.serial)
+	records := []dns.RR{soa, z.soaRecord(old.serial)}
+	for _, rr := range old.records {
+		if !newSet[rr.String()] {
+			records = append(records, rr)
+		}
+	}
+	records = append(records, soa)
+	for _, rr := range current.records {
+		if !oldSet[rr.String()] {
+			records = append(records, rr)
+		}
+	}
+	return append(records, soa)
+}
+
+func parseAllowList(entries []string) ([]*net.IPNet, error) {
+	nets := []*net.IPNet{}
+	for _, entry := range entries {
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, ipnet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid address or network '%s'", entry)
+		}
+		nets = append(nets, ipnet)
+	}
+	return nets, nil
+}
+
+// secondaryMaster serves hosted zones to secondary servers by zone
+// transfer.
+type secondaryMaster struct {
+	zones   map[string]*servedZone
+	order   []*servedZone
+	allow   []*net.IPNet
+	keys    []*tsigKey
+	notify  []string
+	resolve ipResolver
+}
+
+// authorized reports whether a transfer is allowed: the client must be in
+// the allow list, if there is one, and sign its request with a known key,
+// if there are keys.
+func (s *secondaryMaster) authorized(w dns.ResponseWriter, req *dns.Msg) bool {
+	if len(s.allow) > 0 {
+		ip := remoteIP(w.RemoteAddr())
+		allowed := false
+		for _, ipnet := range s.allow {
+			if ip != nil && ipnet.Contains(ip) {
+				allowed = true
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	if len(s.keys) > 0 {
+		return req.IsTsig() != nil && w.TsigStatus() == nil
+	}
+	return true
+}
+
+// transfer sends records over TCP, split into messages. It stops early if
+// sending fails, e.g. when the client disconnects part-way.
+func (s *secondaryMaster) transfer(w dns.ResponseWriter, req *dns.Msg, records []dns.RR) {
+	chunks := [][]dns.RR{}
+	chunk := []dns.RR{}
+	size := 0
+	for _, rr := range records {
+		if size+dns.Len(rr) > transferMessageSize && len(chunk) > 0 {
+			chunks = append(chunks, chunk)
+			chunk, size = []dns.RR{}, 0
+		}
+		chunk = append(chunk, rr)
+		size += dns.Len(rr)
+	}
+	chunks = append(chunks, chunk)
+
+	ch := make(chan *dns.Envelope)
+	t := &dns.Transfer{}
+	done := make(chan error, 1)
+	go func() { done <- t.Out(w, req, ch) }()
+	var err error
+	finished := false
+	for _, chunk := range chunks {
+		select {
+		case ch <- &dns.Envelope{RR: chunk}:
+			continue
+		case err = <-done:
+			finished = true
+		}
+		break
+	}
+	close(ch)
+	if !finished {
+		err = <-done
+	}
+	if err != nil {
+		log.Printf("Transfer to %s failed: %s", w.RemoteAddr(), err)
+	}
+}
+
+func (s *secondaryMaster) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	if len(req.Question) != 1 || req.Opcode != dns.OpcodeQuery {
+		writeReply(w, req, dns.RcodeNotImplemented)
+		return
+	}
+	q := req.Question[0]
+	z := s.zones[strings.ToLower(q.Name)]
+	if z == nil {
+		writeReply(w, req, dns.RcodeRefused)
+		return
+	}
+	soa := z.currentSOA()
+	if soa == nil {
+		writeReply(w, req, dns.RcodeServerFailure)
+		return
+	}
+	_, udp := w.RemoteAddr().(*net.UDPAddr)
+	switch q.Qtype {
+	case dns.TypeSOA:
+		writeReply(w, req, dns.RcodeSuccess, soa)
+	case dns.TypeAXFR, dns.TypeIXFR:
+		if !s.authorized(w, req) {
+			log.Printf("Refused %s of %s to %s", dns.TypeToString[q.Qtype], z.name, w.RemoteAddr())
+			writeReply(w, req, dns.RcodeRefused)
+			return
+		}
+		var records []dns.RR
+		if q.Qtype == dns.TypeIXFR {
+			var serial uint32
+			for _, rr := range req.Ns {
+				if clientSOA, ok := rr.(*dns.SOA); ok {
+					serial = clientSOA.Serial
+				}
+			}
+			records = z.ixfr(serial)
+		} else if udp {
+			writeReply(w, req, dns.RcodeRefused)
+			return
+		} else {
+			records = z.axfr()
+		}
+		if udp {
+			// a single SOA tells the client to retry over TCP if it is
+			// out of date
+			writeReply(w, req, dns.RcodeSuccess, soa)
+			return
+		}
+		log.Printf("%s of %s serial %d to %s", dns.TypeToString[q.Qtype], z.name, soa.Serial, w.RemoteAddr())
+		s.transfer(w, req, records)
+	default:
+		writeReply(w, req, dns.RcodeRefused)
+	}
+}
+
+// sendNotify tells the secondaries the zone has changed, signed with the
+// first key if there are keys.
+func (s *secondaryMaster) sendNotify(z *servedZone) {
+	soa := z.currentSOA()
+	c := &dns.Client{Net: "udp", Timeout: 5 * time.Second, TsigSecret: tsigSecrets(s.keys)}
+	for _, target := range s.notify {
+		m := &dns.Msg{}
+		m.SetNotify(z.name)
+		m.Answer = []dns.RR{soa}
+		if len(s.keys) > 0 {
+			m.SetTsig(s.keys[0].name, s.keys[0].algorithm, 300, time.Now().Unix())
+		}
+		resp, _, err := c.Exchange(m, axfrAddress(target))
+		if err == nil && resp.Rcode != dns.RcodeSuccess {
+			err = errors.New(dns.RcodeToString[resp.Rcode])
+		}
+		if err != nil {
+			log.Printf("NOTIFY of %s to %s failed: %s", z.name, target, err)
+		} else {
+			log.Printf("NOTIFY of %s serial %d sent to %s", z.name, soa.Serial, target)
+		}
+	}
+}
+
+// refresh reloads each zone from route53, notifying secondaries of zones
+// that have changed.
+func (s *secondaryMaster) refresh(ctx context.Context, timeout time.Duration) {
+	for _, z := range s.order {
+		rctx, cancel := ctx, func() {}
+		if timeout > 0 {
+			rctx, cancel = context.WithTimeout(ctx, timeout)
+		}
+		rrsets, err := ListAllRecordSets(rctx, r53, *z.zone.Id)
+		if err != nil {
+			cancel()
+			log.Printf("Refreshing %s failed: %s", z.name, err)
+			continue
+		}
+		soa, records, err := newFlattener(z.zone, rrsets, s.resolve).flatten(rctx)
+		cancel()
+		if err != nil {
+			log.Printf("Refreshing %s failed: %s", z.name, err)
+			continue
+		}
+		if z.update(soa, records, time.Now()) {
+			log.Printf("Zone %s is now serial %d, %d records", z.name, z.currentSOA().Serial, len(records))
+			s.sendNotify(z)
+		}
+	}
+}
+
+func newSecondaryMaster(ctx context.Context, args secondaryArgs) (*secondaryMaster, error) {
+	s := &secondaryMaster{zones: map[string]*servedZone{}, notify: args.notify, resolve: net.DefaultResolver.LookupIP}
+	var err error
+	if s.allow, err = parseAllowList(args.allow); err != nil {
+		return nil, err
+	}
+	for _, k := range args.keys {
+		key, err := parseTSIGKey(k)
+		if err != nil {
+			return nil, err
+		}
+		s.keys = append(s.keys, key)
+	}
+	if len(s.allow) == 0 && len(s.keys) == 0 {
+		return nil, errors.New("Transfers must be restricted with --allow or --tsig-key")
+	}
+	for _, name := range args.zones {
+		zone, err := findZone(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		z := &servedZone{name: strings.ToLower(unescaper.Replace(*zone.Name)), zone: zone, retain: args.versions}
+		s.zones[z.name] = z
+		s.order = append(s.order, z)
+	}
+	return s, nil
+}
+
+// runSecondaryMaster serves zones over UDP and TCP until the context is
+// done, refreshing them from route53 at each interval.
+func runSecondaryMaster(ctx context.Context, args secondaryArgs) error {
+	s, err := newSecondaryMaster(ctx, args)
+	if err != nil {
+		return err
+	}
+	s.refresh(ctx, args.timeout)
+
+	servers, err := startDNSServers(args.listen, s, tsigSecrets(s.keys))
+	if err != nil {
+		return err
+	}
+	defer servers.shutdown()
+	log.Printf("Serving %d zones on %s", len(s.order), args.listen)
+
+	ticker := time.NewTicker(args.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-servers.errs:
+			return err
+		case <-ticker.C:
+			s.refresh(ctx, args.timeout)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package cli53
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	route53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSOA = "ns-1.awsdns-1.com. awsdns-hostmaster.amazon.com. 1 7200 900 1209600 86400"
+
+func fakeResolver(ctx context.Context, network, host string) ([]net.IP, error) {
+	if host == "lb.elb.amazonaws.com." && network == "ip4" {
+		return []net.IP{net.ParseIP("192.0.2.20"), net.ParseIP("192.0.2.10")}, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func routed(rrset *route53types.ResourceRecordSet, id string) *route53types.ResourceRecordSet {
+	rrset.SetIdentifier = aws.String(id)
+	return rrset
+}
+
+func TestFlatten(t *testing.T) {
+	primary := routed(testRRSet("f.example.com.", route53types.RRTypeA, "192.0.2.1"), "primary")
+	primary.Failover = route53types.ResourceRecordSetFailoverPrimary
+	secondary := routed(testRRSet("f.example.com.", route53types.RRTypeA, "192.0.2.2"), "secondary")
+	secondary.Failover = route53types.ResourceRecordSetFailoverSecondary
+	light := routed(testRRSet("w.example.com.", route53types.RRTypeA, "192.0.2.3"), "light")
+	light.Weight = aws.Int64(1)
+	heavy := routed(testRRSet("w.example.com.", route53types.RRTypeA, "192.0.2.4"), "heavy")
+	heavy.Weight = aws.Int64(10)
+	fr := routed(testRRSet("g.example.com.", route53types.RRTypeA, "192.0.2.5"), "fr")
+	fr.GeoLocation = &route53types.GeoLocation{CountryCode: aws.String("FR")}
+	def := routed(testRRSet("g.example.com.", route53types.RRTypeA, "192.0.2.6"), "default")
+	def.GeoLocation = &route53types.GeoLocation{CountryCode: aws.String("*")}
+	nodefault := routed(testRRSet("n.example.com.", route53types.RRTypeA, "192.0.2.7"), "fr")
+	nodefault.GeoLocation = &route53types.GeoLocation{CountryCode: aws.String("FR")}
+	m1 := routed(testRRSet("m.example.com.", route53types.RRTypeA, "192.0.2.8"), "m1")
+	m1.MultiValueAnswer = aws.Bool(true)
+	m2 := routed(testRRSet("m.example.com.", route53types.RRTypeA, "192.0.2.9"), "m2")
+	m2.MultiValueAnswer = aws.Bool(true)
+	external := testAlias("lb.example.com.", "lb.elb.amazonaws.com.")
+	external.AliasTarget.HostedZoneId = aws.String("Z35SXDOTRQ7X7K")
+
+	rrsets := []*route53types.ResourceRecordSet{
+		testRRSet("example.com.", route53types.RRTypeSoa, testSOA),
+		testRRSet("example.com.", route53types.RRTypeNs, "ns-1.awsdns-1.com."),
+		testAlias("example.com.", "f.example.com."),
+		primary, secondary, light, heavy, fr, def, nodefault, m1, m2, external,
+	}
+	soa, records, err := newFlattener(testZone, rrsets, fakeResolver).flatten(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1), soa.Serial)
+	assert.Equal(t, []string{
+		"example.com. 3600 IN A 192.0.2.1",
+		"example.com. 3600 IN NS ns-1.awsdns-1.com.",
+		"f.example.com. 3600 IN A 192.0.2.1",
+		"g.example.com. 3600 IN A 192.0.2.6",
+		"lb.example.com. 60 IN A 192.0.2.10",
+		"lb.example.com. 60 IN A 192.0.2.20",
+		"m.example.com. 3600 IN A 192.0.2.8",
+		"m.example.com. 3600 IN A 192.0.2.9",
+		"w.example.com. 3600 IN A 192.0.2.4",
+	}, recordStrings(records))
+}
+
+func testVersion(t *testing.T, records ...string) []dns.RR {
+	rrs := []dns.RR{}
+	for _, s := range records {
+		rr, err := dns.NewRR(s)
+		require.NoError(t, err)
+		rrs = append(rrs, rr)
+	}
+	return rrs
+}
+
+func testServedZone(t *testing.T) (*servedZone, *dns.SOA) {
+	soa, err := dns.NewRR("example.com. 900 IN SOA " + testSOA)
+	require.NoError(t, err)
+	return &servedZone{name: "example.com.", zone: testZone, retain: 2}, soa.(*dns.SOA)
+}
+
+func TestServedZoneUpdate(t *testing.T) {
+	z, soa := testServedZone(t)
+	now := time.Unix(1700000000, 0)
+	assert.True(t, z.update(soa, testVersion(t, "www.example.com. 300 IN A 192.0.2.1"), now))
+	assert.Equal(t, uint32(1700000000), z.currentSOA().Serial)
+	assert.False(t, z.update(soa, testVersion(t, "www.example.com. 300 IN A 192.0.2.1"), now))
+
+	// changes in the same second still get a new serial
+	assert.True(t, z.update(soa, testVersion(t, "www.example.com. 300 IN A 192.0.2.2"), now))
+	assert.Equal(t, uint32(1700000001), z.currentSOA().Serial)
+	assert.True(t, z.update(soa, testVersion(t, "www.example.com. 300 IN A 192.0.2.3"), now.Add(time.Hour)))
+	assert.Equal(t, uint32(1700003600), z.currentSOA().Serial)
+	assert.Len(t, z.versions, 2)
+}
+
+func testSOAWithSerial(serial string) string {
+	return "example.com. 900 IN SOA ns-1.awsdns-1.com. awsdns-hostmaster.amazon.com. " + serial + " 7200 900 1209600 86400"
+}
+
+func TestServedZoneIXFR(t *testing.T) {
+	z, soa := testServedZone(t)
+	now := time.Unix(1700000000, 0)
+	z.update(soa, testVersion(t, "a.example.com. 300 IN A 192.0.2.1", "b.example.com. 300 IN A 192.0.2.2"), now)
+	z.update(soa, testVersion(t, "a.example.com. 300 IN A 192.0.2.1", "c.example.com. 300 IN A 192.0.2.3"), now.Add(time.Second))
+
+	assert.Equal(t, []string{
+		testSOAWithSerial("1700000001"),
+	}, recordStrings(z.ixfr(1700000001)))
+	assert.Equal(t, []string{
+		testSOAWithSerial("1700000001"),
+		testSOAWithSerial("1700000000"),
+		"b.example.com. 300 IN A 192.0.2.2",
+		testSOAWithSerial("1700000001"),
+		"c.example.com. 300 IN A 192.0.2.3",
+		testSOAWithSerial("1700000001"),
+	}, recordStrings(z.ixfr(1700000000)))
+	// unknown serials get a full transfer
+	assert.Len(t, z.ixfr(42), 4)
+}
+
+func TestParseTSIGKey(t *testing.T) {
+	key, err := parseTSIGKey("xfr-key:c2VjcmV0")
+	require.NoError(t, err)
+	assert.Equal(t, &tsigKey{"xfr-key.", dns.HmacSHA256, "c2VjcmV0"}, key)
+	key, err = parseTSIGKey("hmac-sha512:xfr-key.:c2VjcmV0")
+	require.NoError(t, err)
+	assert.Equal(t, dns.HmacSHA512, key.algorithm)
+	_, err = parseTSIGKey("hmac-md4:xfr-key:c2VjcmV0")
+	assert.EqualError(t, err, "Unsupported TSIG algorithm 'hmac-md4'")
+	_, err = parseTSIGKey("xfr-key")
+	assert.Error(t, err)
+}
+
+func TestParseAllowList(t *testing.T) {
+	nets, err := parseAllowList([]string{"192.0.2.1", "198.51.100.0/24", "2001:db8::1"})
+	require.NoError(t, err)
+	assert.Equal(t, "192.0.2.1/32", nets[0].String())
+	assert.Equal(t, "198.51.100.0/24", nets[1].String())
+	assert.Equal(t, "2001:db8::1/128", nets[2].String())
+	_, err = parseAllowList([]string{"nope"})
+	assert.Error(t, err)
+}
+
+func TestSecondaryMasterTransfer(t *testing.T) {
+	z, soa := testServedZone(t)
+	z.update(soa, testVersion(t, "www.example.com. 300 IN A 192.0.2.1"), time.Unix(1700000000, 0))
+	key := &tsigKey{"xfr-key.", dns.HmacSHA256, "c2VjcmV0"}
+	s := &secondaryMaster{zones: map[string]*servedZone{"example.com.": z}, keys: []*tsigKey{key}}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := &dns.Server{Listener: l, Handler: s, TsigSecret: tsigSecrets(s.keys)}
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+
+	axfr := func(signed bool) ([]dns.RR, error) {
+		m := &dns.Msg{}
+		m.SetAxfr("example.com.")
+		tr := &dns.Transfer{}
+		if signed {
+			m.SetTsig(key.name, key.algorithm, 300, time.Now().Unix())
+			tr.TsigSecret = tsigSecrets(s.keys)
+		}
+		envelopes, err := tr.In(m, l.Addr().String())
+		if err != nil {
+			return nil, err
+		}
+		records := []dns.RR{}
+		for envelope := range envelopes {
+			if envelope.Error != nil {
+				return nil, envelope.Error
+			}
+			records = append(records, envelope.RR...)
+		}
+		return records, nil
+	}
+
+	records, err := axfr(true)
+	require.NoError(t, err)
+	assert.Len(t, records, 3)
+	assert.Equal(t, "www.example.com.\t300\tIN\tA\t192.0.2.1", records[1].String())
+
+	_, err = axfr(false)
+	assert.Error(t, err)
+}
+
+func TestSecondaryMasterTransferAborted(t *testing.T) {
+	z, soa := testServedZone(t)
+	records := []string{}
+	for i := 0; i < 20000; i++ {
+		records = append(records, fmt.Sprintf("host%d.example.com. 300 IN TXT \"%0200d\"", i, i))
+	}
+	z.update(soa, testVersion(t, records...), time.Unix(1700000000, 0))
+	s := &secondaryMaster{zones: map[string]*servedZone{"example.com.": z}}
+
+	served := make(chan struct{})
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		s.ServeDNS(w, req)
+		close(served)
+	})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := &dns.Server{Listener: l, Handler: handler}
+	go server.ActivateAndServe()
+
+	// read the first message of the transfer, then drop the connection
+	conn, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	conn.(*net.TCPConn).SetReadBuffer(4096)
+	c := &dns.Conn{Conn: conn}
+	m := &dns.Msg{}
+	m.SetAxfr("example.com.")
+	require.NoError(t, c.WriteMsg(m))
+	first, err := c.ReadMsg()
+	require.NoError(t, err)
+	assert.NotEmpty(t, first.Answer)
+	conn.(*net.TCPConn).SetLinger(0)
+	conn.Close()
+
+	select {
+	case <-served:
+		server.Shutdown()
+	case <-time.After(5 * time.Second):
+		// shutting down would wait for the stuck handler
+		t.Fatal("transfer did not stop after the client disconnected")
+	}
+}
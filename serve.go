@@ -0,0 +1,312 @@
+package cli53
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	route53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/miekg/dns"
+)
+
+// Time allowed to answer a query, including looking up alias targets
+// outside the zone.
+var serveQueryTimeout = 5 * time.Second
+
+type serveArgs struct {
+	name    string
+	file    string
+	listen  string
+	timeout time.Duration
+	client  clientArgs
+	subnets []string
+}
+
+// subnetLocation is the simulated location of the clients in a network.
+type subnetLocation struct {
+	network     *net.IPNet
+	country     string
+	subdivision string
+	region      string
+}
+
+// parseSubnetLocations parses networks and their locations, given as
+// CIDR=country[-subdivision][@region].
+func parseSubnetLocations(entries []string) ([]*subnetLocation, error) {
+	locations := []*subnetLocation{}
+	for _, entry := range entries {
+		cidr, location, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("Invalid subnet '%s', expected CIDR=country[-subdivision][@region]", entry)
+		}
+		nets, err := parseAllowList([]string{cidr})
+		if err != nil {
+			return nil, err
+		}
+		l := &subnetLocation{network: nets[0]}
+		if l.country, l.subdivision, l.region, err = parseClientLocation(location); err != nil {
+			return nil, err
+		}
+		locations = append(locations, l)
+	}
+	return locations, nil
+}
+
+// zoneServer answers DNS queries for a zone as route53 would, for clients
+// located by their EDNS client subnet or address, unless the location is
+// overridden.
+type zoneServer struct {
+	// mu guards the shared client's random source
+	mu      sync.Mutex
+	origin  string
+	soa     *dns.SOA
+	router  *router
+	client  *routingClient
+	subnets []*subnetLocation
+}
+
+func newZoneServer(zone *route53types.HostedZone, rrsets []*route53types.ResourceRecordSet, client *routingClient, subnets []*subnetLocation) *zoneServer {
+	origin := strings.ToLower(unescaper.Replace(*zone.Name))
+	s := &zoneServer{origin: origin, router: newRouter(zone, rrsets, net.DefaultResolver.LookupIP), client: client, subnets: subnets}
+	for _, rrset := range s.router.groups[rrsetIdentity{Name: origin, Type: route53types.RRTypeSoa}] {
+		for _, rr := range ConvertRRSetToBind(rrset) {
+			if soa, ok := rr.(*dns.SOA); ok {
+				s.soa = soa
+			}
+		}
+	}
+	if s.soa == nil {
+		s.soa = &dns.SOA{
+			Hdr:     dns.RR_Header{Name: origin, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 900},
+			Ns:      "localhost.",
+			Mbox:    "hostmaster." + origin,
+			Serial:  1,
+			Refresh: 7200,
+			Retry:   900,
+			Expire:  1209600,
+			Minttl:  86400,
+		}
+	}
+	return s
+}
+
+// clientFor returns the client a query is answered for: located by the
+// first subnet containing its client subnet or address, with any location
+// given for all clients taking precedence. The client has its own random
+// source, seeded from the shared one, so queries can be answered
+// concurrently.
+func (s *zoneServer) clientFor(ip net.IP) *routingClient {
+	s.mu.Lock()
+	client := *s.client
+	client.rand = rand.New(rand.NewSource(s.client.rand.Int63()))
+	s.mu.Unlock()
+	for _, l := range s.subnets {
+		if ip != nil && l.network.Contains(ip) {
+			if client.country == "" {
+				client.country, client.subdivision = l.country, l.subdivision
+			}
+			if client.region == "" {
+				client.region = l.region
+			}
+			break
+		}
+	}
+	return &client
+}
+
+// negativeSOA is the SOA record for negative answers, with the TTL
+// negative answers are cached for.
+func (s *zoneServer) negativeSOA() dns.RR {
+	soa := dns.Copy(s.soa)
+	if s.soa.Minttl < soa.Header().Ttl {
+		soa.Header().Ttl = s.soa.Minttl
+	}
+	return soa
+}
+
+// source returns the name whose records answer for a name: the name
+// itself, or the wildcard at its closest encloser. It returns false if the
+// name does not exist.
+func (s *zoneServer) source(name string) (string, bool) {
+	if s.router.nameExists(name) {
+		return name, true
+	}
+	for encloser := name; encloser != s.origin; {
+		i := strings.Index(encloser, ".")
+		encloser = encloser[i+1:]
+		if s.router.nameExists(encloser) {
+			wildcard := "*." + encloser
+			return wildcard, s.router.nameExists(wildcard)
+		}
+	}
+	return "", false
+}
+
+// delegation returns the name of the delegation covering a name, if any.
+func (s *zoneServer) delegation(name string) string {
+	labels := dns.SplitDomainName(name)
+	for i := len(labels) - dns.CountLabel(s.origin) - 1; i >= 0; i-- {
+		cut := dns.Fqdn(strings.Join(labels[i:], "."))
+		if len(s.router.groups[rrsetIdentity{Name: cut, Type: route53types.RRTypeNs}]) > 0 {
+			return cut
+		}
+	}
+	return ""
+}
+
+// answer fills in the reply to a query for a name in the zone, following
+// CNAMEs within the zone.
+func (s *zoneServer) answer(ctx context.Context, client *routingClient, m *dns.Msg, qname string, qtype uint16) error {
+	m.Authoritative = true
+	rtype := route53types.RRType(dns.TypeToString[qtype])
+	name := qname
+	for depth := 0; depth <= maxAliasDepth; depth++ {
+		if cut := s.delegation(name); cut != "" {
+			if depth > 0 {
+				return nil
+			}
+			client.tracef("%s is delegated to other name servers at %s", name, cut)
+			m.Authoritative = false
+			ns, err := s.router.records(ctx, client, cut, route53types.RRTypeNs, cut, 0)
+			m.Ns = ns
+			return err
+		}
+		source, ok := s.source(name)
+		if !ok {
+			client.tracef("%s does not exist", name)
+			if depth == 0 {
+				m.Rcode = dns.RcodeNameError
+				m.Ns = []dns.RR{s.negativeSOA()}
+			}
+			return nil
+		}
+		if source != name {
+			client.tracef("%s matches the wildcard %s", name, source)
+		}
+		if name == s.origin && qtype == dns.TypeSOA {
+			m.Answer = []dns.RR{s.soa}
+			return nil
+		}
+		if qtype != dns.TypeCNAME {
+			cname, err := s.router.records(ctx, client, source, route53types.RRTypeCname, name, 0)
+			if err != nil {
+				return err
+			}
+			if len(cname) > 0 {
+				m.Answer = append(m.Answer, cname...)
+				target := strings.ToLower(cname[0].(*dns.CNAME).Target)
+				if !dns.IsSubDomain(s.origin, target) {
+					client.tracef("%s is a CNAME to %s outside the zone", name, target)
+					return nil
+				}
+				client.tracef("%s is a CNAME to %s", name, target)
+				name = target
+				continue
+			}
+		}
+		records, err := s.router.records(ctx, client, source, rtype, name, 0)
+		if err != nil {
+			return err
+		}
+		m.Answer = append(m.Answer, records...)
+		if len(records) == 0 {
+			client.tracef("%s has no %s records for the client", name, rtype)
+		}
+		if len(m.Answer) == 0 {
+			m.Ns = []dns.RR{s.negativeSOA()}
+		}
+		return nil
+	}
+	return fmt.Errorf("CNAME chain from %s is too long", qname)
+}
+
+func (s *zoneServer) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	m := &dns.Msg{}
+	m.SetReply(req)
+	if len(req.Question) != 1 || req.Opcode != dns.OpcodeQuery {
+		m.Rcode = dns.RcodeNotImplemented
+		w.WriteMsg(m)
+		return
+	}
+	q := req.Question[0]
+	qname := strings.ToLower(q.Name)
+
+	ip := remoteIP(w.RemoteAddr())
+	var subnet *dns.EDNS0_SUBNET
+	if opt := req.IsEdns0(); opt != nil {
+		m.SetEdns0(opt.UDPSize(), false)
+		for _, option := range opt.Option {
+			if ecs, ok := option.(*dns.EDNS0_SUBNET); ok {
+				subnet = ecs
+				ip = ecs.Address
+				echo := *ecs
+				echo.SourceScope = ecs.SourceNetmask
+				m.IsEdns0().Option = append(m.IsEdns0().Option, &echo)
+			}
+		}
+	}
+
+	switch {
+	case !dns.IsSubDomain(s.origin, qname):
+		m.Rcode = dns.RcodeRefused
+	case q.Qtype == dns.TypeANY || q.Qtype == dns.TypeAXFR || q.Qtype == dns.TypeIXFR:
+		m.Rcode = dns.RcodeNotImplemented
+	default:
+		client := s.clientFor(ip)
+		ctx, cancel := context.WithTimeout(context.Background(), serveQueryTimeout)
+		err := s.answer(ctx, client, m, qname, q.Qtype)
+		cancel()
+		if err != nil {
+			log.Printf("Answering %s %s failed: %s", qname, dns.TypeToString[q.Qtype], err)
+			m.Answer, m.Ns = nil, nil
+			m.Rcode = dns.RcodeServerFailure
+		}
+		from := w.RemoteAddr().String()
+		if subnet != nil {
+			from += fmt.Sprintf(" for %s/%d", subnet.Address, subnet.SourceNetmask)
+		}
+		log.Printf("%s %s from %s (%s): %s, %d answers", qname, dns.TypeToString[q.Qtype], from, client.location(), dns.RcodeToString[m.Rcode], len(m.Answer))
+	}
+	w.WriteMsg(m)
+}
+
+// runServe answers queries for a zone until the context is done.
+func runServe(ctx context.Context, args serveArgs) error {
+	client, err := newRoutingClient(args.client)
+	if err != nil {
+		return err
+	}
+	subnets, err := parseSubnetLocations(args.subnets)
+	if err != nil {
+		return err
+	}
+	lctx, cancel := ctx, func() {}
+	if args.timeout > 0 {
+		lctx, cancel = context.WithTimeout(ctx, args.timeout)
+	}
+	zone, rrsets, err := loadRoutingZone(lctx, args.name, args.file)
+	cancel()
+	if err != nil {
+		return err
+	}
+	s := newZoneServer(zone, rrsets, client, subnets)
+
+	servers, err := startDNSServers(args.listen, s, nil)
+	if err != nil {
+		return err
+	}
+	defer servers.shutdown()
+	log.Printf("Serving %s (%d record sets) on %s", s.origin, len(rrsets), args.listen)
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-servers.errs:
+		return err
+	}
+}
@@ -0,0 +1,131 @@
+package cli53
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	route53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSubnetLocations(t *testing.T) {
+	locations, err := parseSubnetLocations([]string{"198.51.100.0/24=DE", "2001:db8::/32=US-CA@us-west-1"})
+	require.NoError(t, err)
+	assert.Equal(t, "198.51.100.0/24", locations[0].network.String())
+	assert.Equal(t, "DE", locations[0].country)
+	assert.Equal(t, "CA", locations[1].subdivision)
+	assert.Equal(t, "us-west-1", locations[1].region)
+	_, err = parseSubnetLocations([]string{"198.51.100.0/24"})
+	assert.Error(t, err)
+}
+
+func TestZoneServer(t *testing.T) {
+	zone, rrsets := testRouter(t)
+	subnets, err := parseSubnetLocations([]string{"198.51.100.0/24=DE"})
+	require.NoError(t, err)
+	s := newZoneServer(zone, rrsets, testClient(""), subnets)
+	s.router.resolve = fakeResolver
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := &dns.Server{PacketConn: pc, Handler: s}
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+
+	query := func(name string, qtype uint16, subnet string) *dns.Msg {
+		m := &dns.Msg{}
+		m.SetQuestion(name, qtype)
+		if subnet != "" {
+			m.SetEdns0(4096, false)
+			m.IsEdns0().Option = append(m.IsEdns0().Option, &dns.EDNS0_SUBNET{
+				Code: dns.EDNS0SUBNET, Family: 1, SourceNetmask: 24, Address: net.ParseIP(subnet),
+			})
+		}
+		resp, err := dns.Exchange(m, pc.LocalAddr().String())
+		require.NoError(t, err)
+		return resp
+	}
+
+	resp := query("geo.example.com.", dns.TypeA, "198.51.100.0")
+	assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+	assert.True(t, resp.Authoritative)
+	assert.Equal(t, []string{"geo.example.com. 300 IN A 192.0.2.11"}, recordStrings(resp.Answer))
+	ecs := resp.IsEdns0().Option[0].(*dns.EDNS0_SUBNET)
+	assert.Equal(t, uint8(24), ecs.SourceScope)
+
+	resp = query("geo.example.com.", dns.TypeA, "")
+	assert.Equal(t, []string{"geo.example.com. 300 IN A 192.0.2.13"}, recordStrings(resp.Answer))
+
+	resp = query("MAIL.example.com.", dns.TypeA, "")
+	assert.Equal(t, []string{
+		"mail.example.com. 300 IN CNAME a.example.com.",
+		"a.example.com. 300 IN A 192.0.2.1",
+	}, recordStrings(resp.Answer))
+
+	resp = query("x.wild.example.com.", dns.TypeTXT, "")
+	assert.Equal(t, []string{`x.wild.example.com. 300 IN TXT "wildcard"`}, recordStrings(resp.Answer))
+
+	resp = query("a.example.com.", dns.TypeAAAA, "")
+	assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+	assert.Empty(t, resp.Answer)
+	require.Len(t, resp.Ns, 1)
+	assert.Equal(t, uint32(3600), resp.Ns[0].Header().Ttl)
+
+	resp = query("nope.example.com.", dns.TypeA, "")
+	assert.Equal(t, dns.RcodeNameError, resp.Rcode)
+
+	resp = query("host.sub.example.com.", dns.TypeA, "")
+	assert.False(t, resp.Authoritative)
+	assert.Equal(t, []string{"sub.example.com. 300 IN NS ns1.example.net."}, recordStrings(resp.Ns))
+
+	resp = query("example.org.", dns.TypeA, "")
+	assert.Equal(t, dns.RcodeRefused, resp.Rcode)
+}
+
+func TestZoneServerSlowAlias(t *testing.T) {
+	defer func(timeout time.Duration) { serveQueryTimeout = timeout }(serveQueryTimeout)
+	serveQueryTimeout = 100 * time.Millisecond
+
+	external := testAlias("lb.example.com.", "lb.elb.amazonaws.com.")
+	external.AliasTarget.HostedZoneId = aws.String("Z35SXDOTRQ7X7K")
+	rrsets := []*route53types.ResourceRecordSet{
+		testRRSet("example.com.", route53types.RRTypeSoa, testSOA),
+		testRRSet("a.example.com.", route53types.RRTypeA, "192.0.2.1"),
+		external,
+	}
+	s := newZoneServer(testZone, rrsets, testClient(""), nil)
+	s.router.resolve = func(ctx context.Context, network, host string) ([]net.IP, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := &dns.Server{PacketConn: pc, Handler: s}
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+
+	query := func(name string) (*dns.Msg, time.Duration) {
+		m := &dns.Msg{}
+		m.SetQuestion(name, dns.TypeA)
+		resp, rtt, err := (&dns.Client{}).Exchange(m, pc.LocalAddr().String())
+		require.NoError(t, err)
+		return resp, rtt
+	}
+
+	slow := make(chan *dns.Msg)
+	go func() {
+		resp, _ := query("lb.example.com.")
+		slow <- resp
+	}()
+	time.Sleep(10 * time.Millisecond)
+	resp, rtt := query("a.example.com.")
+	assert.Equal(t, []string{"a.example.com. 3600 IN A 192.0.2.1"}, recordStrings(resp.Answer))
+	assert.True(t, rtt < serveQueryTimeout/2)
+	assert.Equal(t, dns.RcodeServerFailure, (<-slow).Rcode)
+}
@@ -0,0 +1,322 @@
+package cli53
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	route53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+const syncFileSuffix = ".zone"
+
+type syncArgs struct {
+	dir      string
+	upsert   bool
+	editauth bool
+	create   bool
+	dryrun   bool
+	wait     bool
+	rollback bool
+}
+
+// syncFile is a zone file in the sync directory, and the hosted zone it maps
+// to. zone is nil if the hosted zone does not exist.
+type syncFile struct {
+	path   string
+	name   string
+	zoneId string
+	zone   *route53types.HostedZone
+
+	additions []route53types.Change
+	deletions []route53types.Change
+	changes   []*route53types.ChangeInfo
+	status    string
+	err       error
+}
+
+// A comment in the zone file naming the hosted zone id, which takes
+// precedence over looking the zone up by name:
+//
+//	; zone-id: Z1D633PJN98FT9
+var reZoneIdHeader = regexp.MustCompile(`^;\s*zone-id:\s*(\S+)`)
+
+// readZoneIdHeader returns the zone id in the leading comments of a zone
+// file, if any.
+func readZoneIdHeader(r io.Reader) (string, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, ";") {
+			break
+		}
+		if m := reZoneIdHeader.FindStringSubmatch(line); m != nil {
+			return m[1], nil
+		}
+	}
+	return "", scanner.Err()
+}
+
+// syncFiles lists the zone files in a directory, named <zone>.zone.
+func syncFiles(dir string) ([]*syncFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	files := []*syncFile{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), syncFileSuffix) {
+			continue
+		}
+		file := &syncFile{
+			path: filepath.Join(dir, entry.Name()),
+			name: absolute(strings.TrimSuffix(entry.Name(), syncFileSuffix)),
+		}
+		f, err := os.Open(file.path)
+		if err != nil {
+			return nil, err
+		}
+		file.zoneId, err = readZoneIdHeader(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", file.path, err)
+		}
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].name < files[j].name })
+	return files, nil
+}
+
+func listAllZones(ctx context.Context, r53 *route53.Client) ([]route53types.HostedZone, error) {
+	zones := []route53types.HostedZone{}
+	paginator := route53.NewListHostedZonesPaginator(r53, &route53.ListHostedZonesInput{})
+	for paginator.HasMorePages() {
+		resp, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		zones = append(zones, resp.HostedZones...)
+	}
+	return zones, nil
+}
+
+// unmanagedZones returns the hosted zones that no file maps to.
+func unmanagedZones(zones []route53types.HostedZone, files []*syncFile) []route53types.HostedZone {
+	managed := map[string]bool{}
+	for _, file := range files {
+		if file.zone != nil {
+			managed[*file.zone.Id] = true
+		}
+	}
+	unmanaged := []route53types.HostedZone{}
+	for _, zone := range zones {
+		if !managed[*zone.Id] {
+			unmanaged = append(unmanaged, zone)
+		}
+	}
+	return unmanaged
+}
+
+func (f *syncFile) fail(err error) {
+	f.status = "failed"
+	f.err = err
+}
+
+// plan looks up the hosted zone for the file and computes the changes to
+// bring it in line with the file.
+func (f *syncFile) plan(ctx context.Context, args syncArgs) {
+	nameOrId := f.name
+	if f.zoneId != "" {
+		nameOrId = f.zoneId
+	}
+	zone, err := findZone(ctx, nameOrId)
+	var notFound *zoneNotFoundError
+	if errors.As(err, &notFound) && args.create && f.zoneId == "" {
+		// planned against an empty zone, created when applying
+		zone = nil
+	} else if err != nil {
+		f.fail(err)
+		return
+	}
+	f.zone = zone
+
+	planZone := zone
+	if planZone == nil {
+		planZone = &route53types.HostedZone{Id: aws.String("/hostedzone/new"), Name: aws.String(f.name)}
+	}
+	reader, err := os.Open(f.path)
+	if err != nil {
+		f.fail(err)
+		return
+	}
+	defer reader.Close()
+	records, err := parseBindFileErr(reader, f.path, *planZone.Name)
+	if err != nil {
+		f.fail(err)
+		return
+	}
+	expandSelfAliases(records, planZone)
+
+	var rrsets []*route53types.ResourceRecordSet
+	if zone != nil {
+		rrsets, err = ListAllRecordSets(ctx, r53, *zone.Id)
+		if err != nil {
+			f.fail(err)
+			return
+		}
+	}
+	f.additions, f.deletions = importChanges(planZone, records, rrsets, importArgs{
+		editauth: args.editauth,
+		replace:  !args.upsert,
+		upsert:   args.upsert,
+	})
+	switch {
+	case zone == nil:
+		f.status = "create"
+	case len(f.additions)+len(f.deletions) == 0:
+		f.status = "unchanged"
+	default:
+		f.status = "changed"
+	}
+}
+
+func createSyncZone(ctx context.Context, name string) (*route53types.HostedZone, error) {
+	req := route53.CreateHostedZoneInput{
+		CallerReference: aws.String(uniqueReference()),
+		Name:            aws.String(name),
+		HostedZoneConfig: &route53types.HostedZoneConfig{
+			Comment: aws.String("created by cli53 sync"),
+		},
+	}
+	resp, err := r53.CreateHostedZone(ctx, &req)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("Created zone: '%s' ID: '%s'\n", *resp.HostedZone.Name, *resp.HostedZone.Id)
+	return resp.HostedZone, nil
+}
+
+// apply submits the planned changes, first creating the zone if needed.
+func (f *syncFile) apply(ctx context.Context, args syncArgs) {
+	created := false
+	if f.zone == nil {
+		zone, err := createSyncZone(ctx, f.name)
+		if err != nil {
+			f.fail(err)
+			return
+		}
+		// plan again against the new zone, so $self aliases refer to it
+		f.zoneId = *zone.Id
+		f.plan(ctx, args)
+		if f.err != nil {
+			return
+		}
+		created = true
+	}
+	if len(f.additions)+len(f.deletions) > 0 {
+		changes, err := submitChanges(ctx, f.additions, f.deletions, f.zone, args.rollback)
+		f.changes = changes
+		if err != nil {
+			f.fail(err)
+			return
+		}
+	}
+	if created {
+		f.status = "created"
+	} else {
+		f.status = "applied"
+	}
+}
+
+func printSyncPlan(files []*syncFile) {
+	for _, file := range files {
+		if file.err != nil || file.status == "unchanged" {
+			continue
+		}
+		if file.zone == nil {
+			fmt.Printf("%s (new zone):\n", file.name)
+		} else {
+			fmt.Printf("%s (%s):\n", file.name, *file.zone.Id)
+		}
+		printChanges(file.additions, file.deletions)
+	}
+}
+
+func printSyncSummary(w io.Writer, files []*syncFile) {
+	wr := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+	fmt.Fprintln(wr, "Zone\tID\tAdditions\tDeletions\tStatus")
+	for _, file := range files {
+		id := "-"
+		if file.zone != nil {
+			id = strings.Replace(*file.zone.Id, "/hostedzone/", "", 1)
+		}
+		status := file.status
+		if file.err != nil {
+			status = fmt.Sprintf("%s: %s", file.status, file.err)
+		}
+		fmt.Fprintf(wr, "%s\t%s\t%d\t%d\t%s\n", file.name, id, len(file.additions), len(file.deletions), status)
+	}
+	wr.Flush()
+}
+
+// syncZones brings every hosted zone with a file in the directory in line
+// with it. A failure in one zone does not stop the others being synced. It
+// returns the number of zones that failed.
+func syncZones(ctx context.Context, args syncArgs) int {
+	files, err := syncFiles(args.dir)
+	fatalIfErr(err)
+	if len(files) == 0 {
+		errorAndExit(fmt.Sprintf("No %s files found in %s", syncFileSuffix, args.dir))
+	}
+
+	for _, file := range files {
+		file.plan(ctx, args)
+	}
+
+	zones, err := listAllZones(ctx, r53)
+	fatalIfErr(err)
+	for _, zone := range unmanagedZones(zones, files) {
+		fmt.Fprintf(os.Stderr, "Warning: zone '%s' (%s) has no file in %s\n", *zone.Name, *zone.Id, args.dir)
+	}
+
+	printSyncPlan(files)
+	if !args.dryrun {
+		for _, file := range files {
+			if file.err == nil && file.status != "unchanged" {
+				file.apply(ctx, args)
+			}
+		}
+		if args.wait {
+			for _, file := range files {
+				if len(file.changes) > 0 {
+					fmt.Printf("%s: ", file.name)
+					if ok, _ := pollChanges(ctx, file.changes, getChangeStatus, os.Stdout); !ok {
+						file.fail(errors.New("not all changes are in sync"))
+					}
+				}
+			}
+		}
+	}
+	printSyncSummary(os.Stdout, files)
+
+	failed := 0
+	for _, file := range files {
+		if file.err != nil {
+			failed++
+		}
+	}
+	return failed
+}
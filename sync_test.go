@@ -0,0 +1,71 @@
+package cli53
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	route53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadZoneIdHeader(t *testing.T) {
+	id, err := readZoneIdHeader(strings.NewReader("; managed in git\n;zone-id: Z1D633PJN98FT9\n$ORIGIN example.com.\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "Z1D633PJN98FT9", id)
+
+	// only the leading comments are checked
+	id, err = readZoneIdHeader(strings.NewReader("$ORIGIN example.com.\n; zone-id: Z1D633PJN98FT9\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "", id)
+}
+
+func TestSyncFiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	write("example.org.zone", "@ 3600 IN A 127.0.0.1\n")
+	write("example.com.zone", "; zone-id: Z1RWMUCMCPKCJX\n@ 3600 IN A 127.0.0.1\n")
+	write("README", "not a zone")
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "old.zone"), 0o755))
+
+	files, err := syncFiles(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	assert.Equal(t, "example.com.", files[0].name)
+	assert.Equal(t, "Z1RWMUCMCPKCJX", files[0].zoneId)
+	assert.Equal(t, filepath.Join(dir, "example.com.zone"), files[0].path)
+	assert.Equal(t, "example.org.", files[1].name)
+	assert.Equal(t, "", files[1].zoneId)
+}
+
+func TestUnmanagedZones(t *testing.T) {
+	other := route53types.HostedZone{Id: aws.String("/hostedzone/Z2OTHER0000000"), Name: aws.String("example.net.")}
+	files := []*syncFile{
+		{name: "example.com.", zone: testZone},
+		{name: "example.org."},
+	}
+	unmanaged := unmanagedZones([]route53types.HostedZone{*testZone, other}, files)
+	assert.Equal(t, []route53types.HostedZone{other}, unmanaged)
+}
+
+func TestPrintSyncSummary(t *testing.T) {
+	files := []*syncFile{
+		{name: "example.com.", zone: testZone, status: "applied", additions: []route53types.Change{
+			change(route53types.ChangeActionCreate, testRRSet("a.example.com.", route53types.RRTypeA, "127.0.0.1")),
+		}},
+		{name: "example.org.", status: "failed", err: errors.New("Zone 'example.org.' not found")},
+	}
+	w := &bytes.Buffer{}
+	printSyncSummary(w, files)
+	assert.Equal(t, `Zone         ID             Additions Deletions Status
+example.com. Z1RWMUCMCPKCJX 1         0         applied
+example.org. -              0         0         failed: Zone 'example.org.' not found
+`, w.String())
+}
@@ -0,0 +1,271 @@
+package cli53
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	route53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+// FormatTerraform exports a zone as Terraform aws_route53_zone and
+// aws_route53_record resources, with import blocks to adopt them.
+const FormatTerraform = "terraform"
+
+// hclBlock is a block of Terraform configuration. Attributes are written
+// before nested blocks, aligned as terraform fmt does.
+type hclBlock struct {
+	header string
+	attrs  [][2]string
+	blocks []*hclBlock
+}
+
+func (b *hclBlock) attr(name, value string) {
+	b.attrs = append(b.attrs, [2]string{name, value})
+}
+
+func (b *hclBlock) block(header string) *hclBlock {
+	nested := &hclBlock{header: header}
+	b.blocks = append(b.blocks, nested)
+	return nested
+}
+
+func (b *hclBlock) write(w io.Writer, indent string) {
+	fmt.Fprintf(w, "%s%s {\n", indent, b.header)
+	width := 0
+	for _, attr := range b.attrs {
+		if len(attr[0]) > width {
+			width = len(attr[0])
+		}
+	}
+	for _, attr := range b.attrs {
+		fmt.Fprintf(w, "%s  %-*s = %s\n", indent, width, attr[0], attr[1])
+	}
+	for i, nested := range b.blocks {
+		if i > 0 || len(b.attrs) > 0 {
+			fmt.Fprintln(w)
+		}
+		nested.write(w, indent+"  ")
+	}
+	fmt.Fprintf(w, "%s}\n", indent)
+}
+
+var hclEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "${", "$${", "%{", "%%{")
+
+func hclString(s string) string {
+	return `"` + hclEscaper.Replace(s) + `"`
+}
+
+func hclStrings(values []string) string {
+	quoted := []string{}
+	for _, value := range values {
+		quoted = append(quoted, hclString(value))
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+var reTerraformInvalid = regexp.MustCompile(`[^a-z0-9]+`)
+
+// terraformName converts a name to a Terraform resource name.
+func terraformName(s string) string {
+	s = strings.ToLower(s)
+	s = strings.ReplaceAll(s, "*", "wildcard")
+	s = strings.Trim(reTerraformInvalid.ReplaceAllString(s, "_"), "_")
+	if s == "" || (s[0] >= '0' && s[0] <= '9') {
+		s = "_" + s
+	}
+	return s
+}
+
+// recordResourceNames returns a stable, unique resource name for each record
+// set, from its name relative to the zone, type and set identifier.
+func recordResourceNames(rrsets []*route53types.ResourceRecordSet, zone *route53types.HostedZone) []string {
+	names := []string{}
+	used := map[string]bool{}
+	for _, rrset := range rrsets {
+		relative := shortenName(unescaper.Replace(*rrset.Name), *zone.Name)
+		if relative == "@" {
+			relative = "apex"
+		}
+		base := terraformName(fmt.Sprintf("%s_%s", relative, rrset.Type))
+		if rrset.SetIdentifier != nil {
+			base = terraformName(base + "_" + *rrset.SetIdentifier)
+		}
+		name := base
+		for i := 2; used[name]; i++ {
+			name = fmt.Sprintf("%s_%d", base, i)
+		}
+		used[name] = true
+		names = append(names, name)
+	}
+	return names
+}
+
+// terraformRecordId is the id Terraform imports an aws_route53_record by:
+// ZONEID_NAME_TYPE, with _SETIDENTIFIER for records with routing.
+func terraformRecordId(zoneId string, rrset *route53types.ResourceRecordSet) string {
+	id := fmt.Sprintf("%s_%s_%s", zoneId, strings.TrimSuffix(unescaper.Replace(*rrset.Name), "."), rrset.Type)
+	if rrset.SetIdentifier != nil {
+		id += "_" + *rrset.SetIdentifier
+	}
+	return id
+}
+
+// characterStrings splits a TXT value into its quoted character-strings,
+// without the quotes, returning false if it is not made up of them.
+func characterStrings(value string) ([]string, bool) {
+	strs := []string{}
+	value = strings.TrimSpace(value)
+	for value != "" {
+		if value[0] != '"' {
+			return nil, false
+		}
+		end := 1
+		for ; end < len(value) && value[end] != '"'; end++ {
+			if value[end] == '\\' {
+				end++
+			}
+		}
+		if end >= len(value) {
+			return nil, false
+		}
+		strs = append(strs, value[1:end])
+		value = strings.TrimSpace(value[end+1:])
+	}
+	return strs, len(strs) > 0
+}
+
+// terraformRecordValue converts a route53 value to the form the Terraform
+// provider takes, which adds the quotes around TXT and SPF values itself, so
+// several character-strings are joined by "" within the one value.
+func terraformRecordValue(rtype route53types.RRType, value string) string {
+	if rtype != route53types.RRTypeTxt && rtype != route53types.RRTypeSpf {
+		return value
+	}
+	if strs, ok := characterStrings(value); ok {
+		return strings.Join(strs, `""`)
+	}
+	return value
+}
+
+func importBlock(to, id string) *hclBlock {
+	b := &hclBlock{header: "import"}
+	b.attr("to", to)
+	b.attr("id", hclString(id))
+	return b
+}
+
+// writeTerraform writes the zone and its records, other than the SOA and NS
+// records route53 creates with the zone, as Terraform resources.
+func writeTerraform(w io.Writer, zone *route53types.HostedZone, vpcs []route53types.VPC, delegationSetId string, rrsets []*route53types.ResourceRecordSet) {
+	zoneId := strings.Replace(*zone.Id, "/hostedzone/", "", 1)
+	zoneResource := terraformName(strings.TrimSuffix(zoneName(*zone.Name), "."))
+	zoneRef := fmt.Sprintf("aws_route53_zone.%s", zoneResource)
+
+	blocks := []*hclBlock{}
+	z := &hclBlock{header: fmt.Sprintf(`resource "aws_route53_zone" %s`, hclString(zoneResource))}
+	z.attr("name", hclString(strings.TrimSuffix(unescaper.Replace(*zone.Name), ".")))
+	if zone.Config != nil && aws.ToString(zone.Config.Comment) != "" {
+		z.attr("comment", hclString(*zone.Config.Comment))
+	}
+	if delegationSetId != "" {
+		z.attr("delegation_set_id", hclString(strings.Replace(delegationSetId, "/delegationset/", "", 1)))
+	}
+	for _, vpc := range vpcs {
+		v := z.block("vpc")
+		v.attr("vpc_id", hclString(aws.ToString(vpc.VPCId)))
+		v.attr("vpc_region", hclString(string(vpc.VPCRegion)))
+	}
+	blocks = append(blocks, z, importBlock(zoneRef, zoneId))
+
+	records := []*route53types.ResourceRecordSet{}
+	for _, rrset := range rrsets {
+		if !isAuthRecord(zone, rrset) && rrset.TrafficPolicyInstanceId == nil {
+			records = append(records, rrset)
+		}
+	}
+	for i, name := range recordResourceNames(records, zone) {
+		rrset := records[i]
+		r := &hclBlock{header: fmt.Sprintf(`resource "aws_route53_record" %s`, hclString(name))}
+		r.attr("zone_id", zoneRef+".zone_id")
+		r.attr("name", hclString(strings.TrimSuffix(unescaper.Replace(*rrset.Name), ".")))
+		r.attr("type", hclString(string(rrset.Type)))
+		if rrset.TTL != nil {
+			r.attr("ttl", fmt.Sprint(*rrset.TTL))
+		}
+		if len(rrset.ResourceRecords) > 0 {
+			values := []string{}
+			for _, rr := range rrset.ResourceRecords {
+				values = append(values, terraformRecordValue(rrset.Type, aws.ToString(rr.Value)))
+			}
+			r.attr("records", hclStrings(values))
+		}
+		if rrset.SetIdentifier != nil {
+			r.attr("set_identifier", hclString(*rrset.SetIdentifier))
+		}
+		if rrset.HealthCheckId != nil {
+			r.attr("health_check_id", hclString(*rrset.HealthCheckId))
+		}
+		if aws.ToBool(rrset.MultiValueAnswer) {
+			r.attr("multivalue_answer_routing_policy", "true")
+		}
+		if alias := rrset.AliasTarget; alias != nil {
+			a := r.block("alias")
+			a.attr("name", hclString(aws.ToString(alias.DNSName)))
+			if aws.ToString(alias.HostedZoneId) == zoneId {
+				a.attr("zone_id", zoneRef+".zone_id")
+			} else {
+				a.attr("zone_id", hclString(aws.ToString(alias.HostedZoneId)))
+			}
+			a.attr("evaluate_target_health", fmt.Sprint(alias.EvaluateTargetHealth))
+		}
+		if rrset.Weight != nil {
+			r.block("weighted_routing_policy").attr("weight", fmt.Sprint(*rrset.Weight))
+		}
+		if rrset.Failover != "" {
+			r.block("failover_routing_policy").attr("type", hclString(string(rrset.Failover)))
+		}
+		if rrset.Region != "" {
+			r.block("latency_routing_policy").attr("region", hclString(string(rrset.Region)))
+		}
+		if geo := rrset.GeoLocation; geo != nil {
+			g := r.block("geolocation_routing_policy")
+			if geo.ContinentCode != nil {
+				g.attr("continent", hclString(*geo.ContinentCode))
+			}
+			if geo.CountryCode != nil {
+				g.attr("country", hclString(*geo.CountryCode))
+			}
+			if geo.SubdivisionCode != nil {
+				g.attr("subdivision", hclString(*geo.SubdivisionCode))
+			}
+		}
+		blocks = append(blocks, r, importBlock("aws_route53_record."+name, terraformRecordId(zoneId, rrset)))
+	}
+
+	for i, b := range blocks {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		b.write(w, "")
+	}
+}
+
+func exportTerraform(ctx context.Context, name string, writer io.Writer) {
+	zone := lookupZone(ctx, name)
+	resp, err := r53.GetHostedZone(ctx, &route53.GetHostedZoneInput{Id: zone.Id})
+	fatalIfErr(err)
+	delegationSetId := ""
+	if resp.DelegationSet != nil {
+		delegationSetId = aws.ToString(resp.DelegationSet.Id)
+	}
+	rrsets, err := ListAllRecordSets(ctx, r53, *zone.Id)
+	fatalIfErr(err)
+	sort.Sort(exportSorter{rrsets, *zone.Name})
+	writeTerraform(writer, resp.HostedZone, resp.VPCs, delegationSetId, rrsets)
+}
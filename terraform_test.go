@@ -0,0 +1,112 @@
+package cli53
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	route53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTerraformName(t *testing.T) {
+	assert.Equal(t, "example_com", terraformName("example.com"))
+	assert.Equal(t, "wildcard_a", terraformName("*_A"))
+	assert.Equal(t, "_1_www_cname", terraformName("1-www_CNAME"))
+}
+
+func TestRecordResourceNames(t *testing.T) {
+	one := testRRSet("www.example.com.", route53types.RRTypeA, "127.0.0.1")
+	one.SetIdentifier = aws.String("One")
+	rrsets := []*route53types.ResourceRecordSet{
+		testRRSet("example.com.", route53types.RRTypeMx, "10 mail.example.com."),
+		testRRSet("www.example.com.", route53types.RRTypeA, "127.0.0.1"),
+		testRRSet("www-.example.com.", route53types.RRTypeA, "127.0.0.1"),
+		one,
+	}
+	assert.Equal(t, []string{"apex_mx", "www_a", "www_a_2", "www_a_one"}, recordResourceNames(rrsets, testZone))
+}
+
+func TestWriteTerraform(t *testing.T) {
+	txt := testRRSet("example.com.", route53types.RRTypeTxt, `"v=spf1 -all"`, `"part one" "part \"two\""`)
+	weighted := testRRSet("www.example.com.", route53types.RRTypeA, "127.0.0.1")
+	weighted.SetIdentifier = aws.String("one")
+	weighted.Weight = aws.Int64(10)
+	weighted.HealthCheckId = aws.String("abc")
+	alias := testAlias("alias.example.com.", "www.example.com.")
+	soa := testRRSet("example.com.", route53types.RRTypeSoa, "ns-1.awsdns-1.com. hostmaster.example.com. 1 7200 900 1209600 86400")
+	vpcs := []route53types.VPC{{VPCId: aws.String("vpc-1"), VPCRegion: route53types.VPCRegionEuWest1}}
+
+	w := &bytes.Buffer{}
+	writeTerraform(w, testZone, vpcs, "", []*route53types.ResourceRecordSet{soa, txt, weighted, alias})
+	assert.Equal(t, `resource "aws_route53_zone" "example_com" {
+  name = "example.com"
+
+  vpc {
+    vpc_id     = "vpc-1"
+    vpc_region = "eu-west-1"
+  }
+}
+
+import {
+  to = aws_route53_zone.example_com
+  id = "Z1RWMUCMCPKCJX"
+}
+
+resource "aws_route53_record" "apex_txt" {
+  zone_id = aws_route53_zone.example_com.zone_id
+  name    = "example.com"
+  type    = "TXT"
+  ttl     = 3600
+  records = ["v=spf1 -all", "part one\"\"part \\\"two\\\""]
+}
+
+import {
+  to = aws_route53_record.apex_txt
+  id = "Z1RWMUCMCPKCJX_example.com_TXT"
+}
+
+resource "aws_route53_record" "www_a_one" {
+  zone_id         = aws_route53_zone.example_com.zone_id
+  name            = "www.example.com"
+  type            = "A"
+  ttl             = 3600
+  records         = ["127.0.0.1"]
+  set_identifier  = "one"
+  health_check_id = "abc"
+
+  weighted_routing_policy {
+    weight = 10
+  }
+}
+
+import {
+  to = aws_route53_record.www_a_one
+  id = "Z1RWMUCMCPKCJX_www.example.com_A_one"
+}
+
+resource "aws_route53_record" "alias_a" {
+  zone_id = aws_route53_zone.example_com.zone_id
+  name    = "alias.example.com"
+  type    = "A"
+
+  alias {
+    name                   = "www.example.com."
+    zone_id                = aws_route53_zone.example_com.zone_id
+    evaluate_target_health = false
+  }
+}
+
+import {
+  to = aws_route53_record.alias_a
+  id = "Z1RWMUCMCPKCJX_alias.example.com_A"
+}
+`, w.String())
+}
+
+func TestTerraformRecordValue(t *testing.T) {
+	assert.Equal(t, "v=spf1 -all", terraformRecordValue(route53types.RRTypeTxt, `"v=spf1 -all"`))
+	assert.Equal(t, `a""b""`, terraformRecordValue(route53types.RRTypeTxt, `"a" "b" ""`))
+	assert.Equal(t, `"unterminated`, terraformRecordValue(route53types.RRTypeTxt, `"unterminated`))
+	assert.Equal(t, `"quoted"`, terraformRecordValue(route53types.RRTypeCname, `"quoted"`))
+}
@@ -0,0 +1,357 @@
+package cli53
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// FormatTinydns is a tinydns (djbdns) data file.
+const FormatTinydns = "tinydns"
+
+// tinydns's default TTLs, for lines without one.
+const (
+	tinydnsDefaultTTL = 86400
+	tinydnsNSTTL      = 259200
+	tinydnsSOATTL     = 2560
+)
+
+// tinydnsUnescape decodes the \NNN octal escapes tinydns uses for bytes
+// that cannot appear literally in a data file, such as ':'.
+func tinydnsUnescape(s string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+3 < len(s) && isOctal(s[i+1]) && isOctal(s[i+2]) && isOctal(s[i+3]) {
+			n, _ := strconv.ParseUint(s[i+1:i+4], 8, 8)
+			b.WriteByte(byte(n))
+			i += 3
+		} else if i+1 < len(s) {
+			b.WriteByte(s[i+1])
+			i++
+		} else {
+			return "", fmt.Errorf("invalid escape in '%s'", s)
+		}
+	}
+	return b.String(), nil
+}
+
+func isOctal(c byte) bool {
+	return c >= '0' && c <= '7'
+}
+
+// txtEscape escapes a string for the presentation format of a TXT record.
+func txtEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < ' ' || c > '~':
+			fmt.Fprintf(&b, "\\%03d", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+type tinydnsLine struct {
+	fields []string
+}
+
+// field returns the i'th field, unescaped, or "" if it is missing.
+func (l *tinydnsLine) field(i int) (string, error) {
+	if i >= len(l.fields) {
+		return "", nil
+	}
+	return tinydnsUnescape(l.fields[i])
+}
+
+func (l *tinydnsLine) name(i int) (string, error) {
+	name, err := l.field(i)
+	if err != nil {
+		return "", err
+	}
+	if name == "" {
+		return "", errors.New("name is required")
+	}
+	return dns.Fqdn(strings.ToLower(strings.TrimSuffix(name, "."))), nil
+}
+
+func (l *tinydnsLine) ttl(i int, def uint32) (uint32, error) {
+	s, err := l.field(i)
+	if err != nil || s == "" {
+		return def, err
+	}
+	ttl, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ttl '%s'", s)
+	}
+	return uint32(ttl), nil
+}
+
+func (l *tinydnsLine) number(i int) (uint64, error) {
+	s, err := l.field(i)
+	if err != nil || s == "" {
+		return 0, err
+	}
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number '%s'", s)
+	}
+	return n, nil
+}
+
+func (l *tinydnsLine) ip(i int) (net.IP, error) {
+	s, err := l.field(i)
+	if err != nil || s == "" {
+		return nil, err
+	}
+	ip := net.ParseIP(s).To4()
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address '%s'", s)
+	}
+	return ip, nil
+}
+
+// host returns a server name for & and @ lines: x if it contains a dot,
+// otherwise x.label.fqdn as tinydns-data generates.
+func (l *tinydnsLine) host(i int, label, fqdn string) (string, error) {
+	x, err := l.field(i)
+	if err != nil {
+		return "", err
+	}
+	if x == "" {
+		return "", errors.New("server name is required")
+	}
+	if !strings.Contains(x, ".") {
+		x = x + "." + label + "." + fqdn
+	}
+	return dns.Fqdn(strings.ToLower(strings.TrimSuffix(x, "."))), nil
+}
+
+func tinydnsHeader(name string, rrtype uint16, ttl uint32) dns.RR_Header {
+	return dns.RR_Header{Name: name, Rrtype: rrtype, Class: dns.ClassINET, Ttl: ttl}
+}
+
+// tinydnsServer converts an & or . line: an NS record, and an A record for
+// the server if its address is given. The SOA record a . line also implies
+// is left to route53.
+func tinydnsServer(l *tinydnsLine, fqdn string) ([]dns.RR, error) {
+	ip, err := l.ip(1)
+	if err != nil {
+		return nil, err
+	}
+	ns, err := l.host(2, "ns", fqdn)
+	if err != nil {
+		return nil, err
+	}
+	ttl, err := l.ttl(3, tinydnsNSTTL)
+	if err != nil {
+		return nil, err
+	}
+	records := []dns.RR{&dns.NS{Hdr: tinydnsHeader(fqdn, dns.TypeNS, ttl), Ns: ns}}
+	if ip != nil {
+		records = append(records, &dns.A{Hdr: tinydnsHeader(ns, dns.TypeA, ttl), A: ip})
+	}
+	return records, nil
+}
+
+func tinydnsRecords(l *tinydnsLine, kind byte) ([]dns.RR, error) {
+	fqdn, err := l.name(0)
+	if err != nil {
+		return nil, err
+	}
+	switch kind {
+	case '+', '=':
+		ip, err := l.ip(1)
+		if err != nil {
+			return nil, err
+		}
+		if ip == nil {
+			return nil, errors.New("IP address is required")
+		}
+		ttl, err := l.ttl(2, tinydnsDefaultTTL)
+		if err != nil {
+			return nil, err
+		}
+		records := []dns.RR{&dns.A{Hdr: tinydnsHeader(fqdn, dns.TypeA, ttl), A: ip}}
+		if kind == '=' {
+			arpa, _ := dns.ReverseAddr(ip.String())
+			records = append(records, &dns.PTR{Hdr: tinydnsHeader(arpa, dns.TypePTR, ttl), Ptr: fqdn})
+		}
+		return records, nil
+	case 'C', '^':
+		target, err := l.name(1)
+		if err != nil {
+			return nil, err
+		}
+		ttl, err := l.ttl(2, tinydnsDefaultTTL)
+		if err != nil {
+			return nil, err
+		}
+		if kind == 'C' {
+			return []dns.RR{&dns.CNAME{Hdr: tinydnsHeader(fqdn, dns.TypeCNAME, ttl), Target: target}}, nil
+		}
+		return []dns.RR{&dns.PTR{Hdr: tinydnsHeader(fqdn, dns.TypePTR, ttl), Ptr: target}}, nil
+	case '@':
+		ip, err := l.ip(1)
+		if err != nil {
+			return nil, err
+		}
+		mx, err := l.host(2, "mx", fqdn)
+		if err != nil {
+			return nil, err
+		}
+		dist, err := l.number(3)
+		if err != nil {
+			return nil, err
+		}
+		ttl, err := l.ttl(4, tinydnsDefaultTTL)
+		if err != nil {
+			return nil, err
+		}
+		records := []dns.RR{&dns.MX{Hdr: tinydnsHeader(fqdn, dns.TypeMX, ttl), Preference: uint16(dist), Mx: mx}}
+		if ip != nil {
+			records = append(records, &dns.A{Hdr: tinydnsHeader(mx, dns.TypeA, ttl), A: ip})
+		}
+		return records, nil
+	case '\'':
+		text, err := l.field(1)
+		if err != nil {
+			return nil, err
+		}
+		ttl, err := l.ttl(2, tinydnsDefaultTTL)
+		if err != nil {
+			return nil, err
+		}
+		txt := &dns.TXT{Hdr: tinydnsHeader(fqdn, dns.TypeTXT, ttl)}
+		for len(text) > 255 {
+			txt.Txt = append(txt.Txt, txtEscape(text[:255]))
+			text = text[255:]
+		}
+		txt.Txt = append(txt.Txt, txtEscape(text))
+		return []dns.RR{txt}, nil
+	case '&', '.':
+		return tinydnsServer(l, fqdn)
+	case 'Z':
+		mname, err := l.name(1)
+		if err != nil {
+			return nil, err
+		}
+		rname, err := l.name(2)
+		if err != nil {
+			return nil, err
+		}
+		values := []uint64{}
+		for i, def := range []uint64{0, 16384, 2048, 1048576, 2560} {
+			n, err := l.number(3 + i)
+			if err != nil {
+				return nil, err
+			}
+			if s, _ := l.field(3 + i); s == "" {
+				n = def
+			}
+			values = append(values, n)
+		}
+		ttl, err := l.ttl(8, tinydnsSOATTL)
+		if err != nil {
+			return nil, err
+		}
+		return []dns.RR{&dns.SOA{
+			Hdr:     tinydnsHeader(fqdn, dns.TypeSOA, ttl),
+			Ns:      mname,
+			Mbox:    rname,
+			Serial:  uint32(values[0]),
+			Refresh: uint32(values[1]),
+			Retry:   uint32(values[2]),
+			Expire:  uint32(values[3]),
+			Minttl:  uint32(values[4]),
+		}}, nil
+	case ':':
+		rtype, err := l.number(1)
+		if err != nil {
+			return nil, err
+		}
+		if rtype == 0 || rtype > 65535 {
+			return nil, fmt.Errorf("invalid type '%d'", rtype)
+		}
+		rdata, err := l.field(2)
+		if err != nil {
+			return nil, err
+		}
+		ttl, err := l.ttl(3, tinydnsDefaultTTL)
+		if err != nil {
+			return nil, err
+		}
+		rr, err := dns.NewRR(fmt.Sprintf(`%s %d IN TYPE%d \# %d %s`, fqdn, ttl, rtype, len(rdata), hex.EncodeToString([]byte(rdata))))
+		if err != nil {
+			return nil, fmt.Errorf("invalid rdata for type %d", rtype)
+		}
+		if _, ok := rr.(*dns.PrivateRR); ok || !supportedRecord(rr) {
+			return nil, fmt.Errorf("unsupported type %d", rtype)
+		}
+		return []dns.RR{rr}, nil
+	}
+	return nil, fmt.Errorf("unsupported line type '%c'", kind)
+}
+
+// readTinydns reads the records in a tinydns data file that belong to the
+// zone origin. A data file usually holds many zones, and = lines generate PTR
+// records in the reverse zone, so importing into an in-addr.arpa zone picks
+// those up. The timestamp and location fields are not supported: lines with
+// a location are skipped with a warning.
+func readTinydns(r io.Reader, origin string) ([]dns.RR, error) {
+	origin = strings.ToLower(origin)
+	scanner := bufio.NewScanner(r)
+	records := []dns.RR{}
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || line[0] == '#' || line[0] == '-' {
+			continue
+		}
+		l := &tinydnsLine{strings.Split(line[1:], ":")}
+		var location int
+		switch line[0] {
+		case '+', '=', 'C', '^', '\'':
+			location = 4
+		case '&', '.', ':':
+			location = 5
+		case '@':
+			location = 6
+		case 'Z':
+			location = 10
+		}
+		if lo, _ := l.field(location); location > 0 && lo != "" {
+			fmt.Fprintf(os.Stderr, "Warning: line %d: Skipping record for location '%s'\n", n, lo)
+			continue
+		}
+		rrs, err := tinydnsRecords(l, line[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		for _, rr := range rrs {
+			if dns.IsSubDomain(origin, rr.Header().Name) {
+				records = append(records, rr)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
@@ -0,0 +1,76 @@
+package cli53
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testTinydns = `# example.com
+Zexample.com:ns1.example.com.:hostmaster.example.com.:2024010101
+&example.com:192.0.2.53:ns1.example.com.
+.example.com::a
++www.example.com:192.0.2.1:300
+=host.example.com:192.0.2.2
+Cftp.example.com:www.example.com
+@example.com:192.0.2.25:mail::600
+'example.com:v=spf1 a\072b -all
+^3.2.0.192.in-addr.arpa:other.example.com
+:example.com:99:\005hello
++other.example.net:198.51.100.1
+-disabled.example.com:192.0.2.9
++split.example.com:192.0.2.10:::in
+`
+
+func recordStrings(records []dns.RR) []string {
+	strs := []string{}
+	for _, rr := range records {
+		strs = append(strs, strings.ReplaceAll(rr.String(), "\t", " "))
+	}
+	return strs
+}
+
+func TestReadTinydns(t *testing.T) {
+	records, err := readTinydns(strings.NewReader(testTinydns), "example.com.")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"example.com. 2560 IN SOA ns1.example.com. hostmaster.example.com. 2024010101 16384 2048 1048576 2560",
+		"example.com. 259200 IN NS ns1.example.com.",
+		"ns1.example.com. 259200 IN A 192.0.2.53",
+		"example.com. 259200 IN NS a.ns.example.com.",
+		"www.example.com. 300 IN A 192.0.2.1",
+		"host.example.com. 86400 IN A 192.0.2.2",
+		"ftp.example.com. 86400 IN CNAME www.example.com.",
+		"example.com. 600 IN MX 0 mail.mx.example.com.",
+		"mail.mx.example.com. 600 IN A 192.0.2.25",
+		`example.com. 86400 IN TXT "v=spf1 a:b -all"`,
+		`example.com. 86400 IN SPF "hello"`,
+	}, recordStrings(records))
+}
+
+func TestReadTinydnsReverse(t *testing.T) {
+	records, err := readTinydns(strings.NewReader(testTinydns), "2.0.192.in-addr.arpa.")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"2.2.0.192.in-addr.arpa. 86400 IN PTR host.example.com.",
+		"3.2.0.192.in-addr.arpa. 86400 IN PTR other.example.com.",
+	}, recordStrings(records))
+}
+
+func TestReadTinydnsErrors(t *testing.T) {
+	_, err := readTinydns(strings.NewReader("+www.example.com:192.0.2.1\n+www.example.com:999.0.2.1\n"), "example.com.")
+	assert.EqualError(t, err, "line 2: invalid IP address '999.0.2.1'")
+	_, err = readTinydns(strings.NewReader("Xwww.example.com:192.0.2.1\n"), "example.com.")
+	assert.EqualError(t, err, "line 1: unsupported line type 'X'")
+	_, err = readTinydns(strings.NewReader("+www.example.com:192.0.2.1\n:example.com:65280:\\001\\002\n"), "example.com.")
+	assert.EqualError(t, err, "line 2: unsupported type 65280")
+	_, err = readTinydns(strings.NewReader(":example.com:13:\\001a\\001b\n"), "example.com.")
+	assert.EqualError(t, err, "line 1: unsupported type 13")
+}
+
+func TestTxtEscape(t *testing.T) {
+	assert.Equal(t, `a\"b\\c\010`, txtEscape("a\"b\\c\n"))
+}
@@ -311,6 +311,22 @@ func isZoneId(s string) bool {
 }
 
 func lookupZone(ctx context.Context, nameOrId string) *route53types.HostedZone {
+	zone, err := findZone(ctx, nameOrId)
+	fatalIfErr(err)
+	return zone
+}
+
+// zoneNotFoundError is returned by findZone when there is no such zone.
+type zoneNotFoundError struct {
+	nameOrId string
+}
+
+func (e *zoneNotFoundError) Error() string {
+	return fmt.Sprintf("Zone '%s' not found", e.nameOrId)
+}
+
+// findZone looks up a zone by name or id.
+func findZone(ctx context.Context, nameOrId string) (*route53types.HostedZone, error) {
 	if isZoneId(nameOrId) {
 		// lookup by id
 		id := nameOrId
@@ -323,10 +339,12 @@ func lookupZone(ctx context.Context, nameOrId string) *route53types.HostedZone {
 		resp, err := r53.GetHostedZone(ctx, &req)
 		var notFound *route53types.NoSuchHostedZone
 		if errors.As(err, &notFound) {
-			errorAndExit(fmt.Sprintf("Zone '%s' not found", nameOrId))
+			return nil, &zoneNotFoundError{nameOrId}
+		}
+		if err != nil {
+			return nil, err
 		}
-		fatalIfErr(err)
-		return resp.HostedZone
+		return resp.HostedZone, nil
 	} else {
 		// lookup by name
 		matches := []route53types.HostedZone{}
@@ -334,7 +352,9 @@ func lookupZone(ctx context.Context, nameOrId string) *route53types.HostedZone {
 			DNSName: aws.String(nameOrId),
 		}
 		resp, err := r53.ListHostedZonesByName(ctx, &req)
-		fatalIfErr(err)
+		if err != nil {
+			return nil, err
+		}
 		for _, zone := range resp.HostedZones {
 			if zoneName(*zone.Name) == zoneName(nameOrId) {
 				matches = append(matches, zone)
@@ -342,32 +362,12 @@ func lookupZone(ctx context.Context, nameOrId string) *route53types.HostedZone {
 		}
 		switch len(matches) {
 		case 0:
-			errorAndExit(fmt.Sprintf("Zone '%s' not found", nameOrId))
+			return nil, &zoneNotFoundError{nameOrId}
 		case 1:
-			return &matches[0]
+			return &matches[0], nil
 		default:
-			errorAndExit("Multiple zones match - you will need to use Zone ID to uniquely identify the zone")
-		}
-	}
-	return nil
-}
-
-func waitForChange(ctx context.Context, change *route53types.ChangeInfo) {
-	fmt.Printf("Waiting for sync")
-	for {
-		req := route53.GetChangeInput{Id: change.Id}
-		resp, err := r53.GetChange(ctx, &req)
-		fatalIfErr(err)
-		if resp.ChangeInfo.Status == route53types.ChangeStatusInsync {
-			fmt.Println("\nCompleted")
-			break
-		} else if resp.ChangeInfo.Status == route53types.ChangeStatusPending {
-			fmt.Printf(".")
-		} else {
-			fmt.Printf("\nFailed: %s\n", resp.ChangeInfo.Status)
-			break
+			return nil, errors.New("Multiple zones match - you will need to use Zone ID to uniquely identify the zone")
 		}
-		time.Sleep(1 * time.Second)
 	}
 }
 
@@ -0,0 +1,342 @@
+package cli53
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	route53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/miekg/dns"
+)
+
+// Polling interval when verifying changes on the name servers.
+var verifyInterval = 5 * time.Second
+
+// verifyOptions are the options for verifying changes on the zone's name
+// servers, after they are made.
+type verifyOptions struct {
+	enabled bool
+	// name servers to query instead of the zone's delegation set
+	nameservers []string
+	timeout     time.Duration
+}
+
+// verifyCheck is the answer expected from the name servers for a name and
+// type: the records, or none if expected is empty. Checks with a skip
+// reason cannot be verified.
+type verifyCheck struct {
+	name     string
+	rrtype   uint16
+	expected []dns.RR
+	skip     string
+}
+
+func (c *verifyCheck) String() string {
+	return c.name + " " + dns.TypeToString[c.rrtype]
+}
+
+// verifyChecks returns the checks for record sets after changes are made.
+// Record sets with routing policies and aliases are skipped, as their
+// answers depend on the client and the alias target.
+func verifyChecks(additions, deletions []route53types.Change) []*verifyCheck {
+	after := map[rrsetIdentity][]*route53types.ResourceRecordSet{}
+	deleted := map[rrsetIdentity][]*route53types.ResourceRecordSet{}
+	for _, change := range deletions {
+		rrset := change.ResourceRecordSet
+		id := rrsetIdentity{Name: strings.ToLower(unescaper.Replace(*rrset.Name)), Type: rrset.Type}
+		deleted[id] = append(deleted[id], rrset)
+	}
+	for _, change := range additions {
+		rrset := change.ResourceRecordSet
+		id := rrsetIdentity{Name: strings.ToLower(unescaper.Replace(*rrset.Name)), Type: rrset.Type}
+		after[id] = append(after[id], rrset)
+	}
+	ids := []rrsetIdentity{}
+	for id := range deleted {
+		if _, ok := after[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	for id := range after {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if ids[i].Name != ids[j].Name {
+			return ids[i].Name < ids[j].Name
+		}
+		return ids[i].Type < ids[j].Type
+	})
+
+	checks := []*verifyCheck{}
+	for _, id := range ids {
+		check := &verifyCheck{name: id.Name, rrtype: dns.StringToType[string(id.Type)]}
+		rrsets := after[id]
+		if len(rrsets) == 0 {
+			rrsets = deleted[id]
+		}
+		switch {
+		case rrsets[0].SetIdentifier != nil:
+			check.skip = "routed answers depend on the client"
+		case rrsets[0].AliasTarget != nil:
+			check.skip = "alias answers depend on the target"
+		case len(after[id]) > 0:
+			for _, rr := range ConvertRRSetToBind(rrsets[0]) {
+				rr.Header().Name = id.Name
+				check.expected = append(check.expected, rr)
+			}
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// verifyQueryFunc queries a name server for a name and type, returning the
+// records in the answer for them.
+type verifyQueryFunc func(ctx context.Context, server, name string, rrtype uint16) ([]dns.RR, error)
+
+// queryNameServer queries a name server directly, without recursion, over
+// UDP, retrying over TCP if the answer is truncated.
+func queryNameServer(ctx context.Context, server, name string, rrtype uint16) ([]dns.RR, error) {
+	m := &dns.Msg{}
+	m.SetQuestion(dns.Fqdn(name), rrtype)
+	m.RecursionDesired = false
+	c := &dns.Client{Timeout: 5 * time.Second}
+	resp, _, err := c.ExchangeContext(ctx, m, axfrAddress(server))
+	if err == nil && resp.Truncated {
+		c.Net = "tcp"
+		resp, _, err = c.ExchangeContext(ctx, m, axfrAddress(server))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError {
+		return nil, errors.New(dns.RcodeToString[resp.Rcode])
+	}
+	records := []dns.RR{}
+	for _, rr := range resp.Answer {
+		if strings.EqualFold(rr.Header().Name, name) && rr.Header().Rrtype == rrtype {
+			records = append(records, rr)
+		}
+	}
+	return records, nil
+}
+
+// sameAnswer reports whether records have the same data, ignoring TTLs.
+func sameAnswer(expected, got []dns.RR) bool {
+	if len(expected) != len(got) {
+		return false
+	}
+	contains := func(rrs []dns.RR, rr dns.RR) bool {
+		for _, r := range rrs {
+			if dns.IsDuplicate(r, rr) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, rr := range expected {
+		if !contains(got, rr) {
+			return false
+		}
+	}
+	for _, rr := range got {
+		if !contains(expected, rr) {
+			return false
+		}
+	}
+	return true
+}
+
+func answerString(records []dns.RR) string {
+	if len(records) == 0 {
+		return "no records"
+	}
+	values := []string{}
+	for _, rr := range records {
+		values = append(values, strings.TrimPrefix(rr.String(), rr.Header().String()))
+	}
+	sort.Strings(values)
+	return strings.Join(values, ", ")
+}
+
+type verifyResult struct {
+	server     string
+	verified   int
+	mismatches []string
+	err        error
+}
+
+// verifyServer queries a name server for each check until all of them
+// match, or the context is done, sending the number verified whenever it
+// changes.
+func verifyServer(ctx context.Context, server string, checks []*verifyCheck, query verifyQueryFunc, progress chan<- verifyResult) verifyResult {
+	pending := checks
+	verified := 0
+	for {
+		mismatches := []string{}
+		remaining := []*verifyCheck{}
+		for _, check := range pending {
+			got, err := query(ctx, server, check.name, check.rrtype)
+			if err != nil {
+				mismatches = append(mismatches, fmt.Sprintf("%s: %s", check, err))
+			} else if !sameAnswer(check.expected, got) {
+				mismatches = append(mismatches, fmt.Sprintf("%s: expected %s, got %s", check, answerString(check.expected), answerString(got)))
+			} else {
+				verified++
+				continue
+			}
+			remaining = append(remaining, check)
+		}
+		result := verifyResult{server, verified, mismatches, nil}
+		if len(remaining) == 0 {
+			return result
+		}
+		if len(remaining) < len(pending) {
+			progress <- result
+		}
+		pending = remaining
+		select {
+		case <-ctx.Done():
+			result.err = ctx.Err()
+			return result
+		case <-time.After(verifyInterval):
+		}
+	}
+}
+
+// pollVerify verifies the checks on each name server concurrently, writing
+// progress and any mismatches to w. It returns false if any server did not
+// give the expected answers before the context was done.
+func pollVerify(ctx context.Context, servers []string, checks []*verifyCheck, query verifyQueryFunc, w io.Writer) bool {
+	active := []*verifyCheck{}
+	for _, check := range checks {
+		if check.skip != "" {
+			fmt.Fprintf(w, "Not verifying %s: %s\n", check, check.skip)
+		} else {
+			active = append(active, check)
+		}
+	}
+	if len(active) == 0 {
+		return true
+	}
+	unique := []string{}
+	seen := map[string]bool{}
+	for _, server := range servers {
+		if !seen[server] {
+			seen[server] = true
+			unique = append(unique, server)
+		}
+	}
+	servers = unique
+	fmt.Fprintf(w, "Verifying %d record sets on %d name servers\n", len(active), len(servers))
+	progress := make(chan verifyResult)
+	results := make(chan verifyResult)
+	for _, server := range servers {
+		go func(server string) {
+			results <- verifyServer(ctx, server, active, query, progress)
+		}(server)
+	}
+
+	byServer := map[string]verifyResult{}
+	for len(byServer) < len(servers) {
+		select {
+		case result := <-progress:
+			fmt.Fprintf(w, "%s: %d/%d verified\n", result.server, result.verified, len(active))
+		case result := <-results:
+			byServer[result.server] = result
+			if result.err == nil {
+				fmt.Fprintf(w, "%s: all %d verified\n", result.server, len(active))
+			} else {
+				fmt.Fprintf(w, "%s: %d/%d verified, gave up: %s\n", result.server, result.verified, len(active), result.err)
+			}
+		}
+	}
+
+	ok := true
+	for _, server := range servers {
+		result := byServer[server]
+		if result.err == nil {
+			continue
+		}
+		ok = false
+		for _, mismatch := range result.mismatches {
+			fmt.Fprintf(w, "Mismatch on %s: %s\n", server, mismatch)
+		}
+	}
+	if ok {
+		fmt.Fprintln(w, "Verified")
+	}
+	return ok
+}
+
+// zoneNameServers returns the name servers of a zone's delegation set.
+func zoneNameServers(ctx context.Context, zone *route53types.HostedZone) ([]string, error) {
+	resp, err := r53.GetHostedZone(ctx, &route53.GetHostedZoneInput{Id: zone.Id})
+	if err != nil {
+		return nil, err
+	}
+	if resp.DelegationSet == nil || len(resp.DelegationSet.NameServers) == 0 {
+		return nil, fmt.Errorf("Zone %s has no delegation set - give the name servers with --nameserver", aws.ToString(zone.Name))
+	}
+	return resp.DelegationSet.NameServers, nil
+}
+
+// verifyChanges verifies that the zone's name servers answer with the
+// changed record sets, exiting if they do not within the timeout.
+func verifyChanges(ctx context.Context, zone *route53types.HostedZone, additions, deletions []route53types.Change, opts verifyOptions) {
+	servers := opts.nameservers
+	if len(servers) == 0 {
+		var err error
+		servers, err = zoneNameServers(ctx, zone)
+		fatalIfErr(err)
+	}
+	if opts.timeout > 0 {
+		var cancel func()
+		ctx, cancel = context.WithTimeout(ctx, opts.timeout)
+		defer cancel()
+	}
+	if !pollVerify(ctx, servers, verifyChecks(additions, deletions), queryNameServer, os.Stdout) {
+		errorAndExit("Not all name servers give the expected answers")
+	}
+}
+
+type verifyArgs struct {
+	id   string
+	zone string
+	opts verifyOptions
+}
+
+// verify verifies the record sets changed by a journal entry, by default
+// the most recent, or every record set of a zone.
+func verify(ctx context.Context, args verifyArgs) {
+	var zone *route53types.HostedZone
+	var additions, deletions []route53types.Change
+	if args.zone != "" {
+		zone = lookupZone(ctx, args.zone)
+		rrsets, err := ListAllRecordSets(ctx, r53, *zone.Id)
+		fatalIfErr(err)
+		for _, rrset := range rrsets {
+			additions = append(additions, route53types.Change{Action: route53types.ChangeActionCreate, ResourceRecordSet: rrset})
+		}
+		fmt.Printf("Verifying %s\n", aws.ToString(zone.Name))
+	} else {
+		entry, err := loadJournalEntry(args.id)
+		fatalIfErr(err)
+		zone = lookupZone(ctx, entry.ZoneId)
+		for _, rrset := range entry.Before {
+			deletions = append(deletions, route53types.Change{Action: route53types.ChangeActionDelete, ResourceRecordSet: rrset})
+		}
+		for _, rrset := range entry.After {
+			additions = append(additions, route53types.Change{Action: route53types.ChangeActionCreate, ResourceRecordSet: rrset})
+		}
+		fmt.Printf("Verifying '%s' on %s at %s (%s)\n", entry.Command, aws.ToString(zone.Name), entry.Time.Local().Format(time.RFC1123), entry.Id)
+	}
+	verifyChanges(ctx, zone, additions, deletions, args.opts)
+}
@@ -0,0 +1,153 @@
+package cli53
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	route53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testRR(t *testing.T, s string) dns.RR {
+	rr, err := dns.NewRR(s)
+	require.NoError(t, err)
+	return rr
+}
+
+func TestVerifyChecks(t *testing.T) {
+	weighted := routed(testRRSet("w.example.com.", route53types.RRTypeA, "192.0.2.3"), "light")
+	weighted.Weight = aws.Int64(1)
+	additions := []route53types.Change{
+		change(route53types.ChangeActionCreate, testRRSet("WWW.example.com.", route53types.RRTypeA, "192.0.2.1", "192.0.2.2")),
+		change(route53types.ChangeActionCreate, testAlias("example.com.", "www.example.com.")),
+		change(route53types.ChangeActionCreate, weighted),
+	}
+	deletions := []route53types.Change{
+		change(route53types.ChangeActionDelete, testRRSet("www.example.com.", route53types.RRTypeA, "192.0.2.1")),
+		change(route53types.ChangeActionDelete, testRRSet("old.example.com.", route53types.RRTypeTxt, `"gone"`)),
+	}
+	checks := verifyChecks(additions, deletions)
+	require.Len(t, checks, 4)
+
+	assert.Equal(t, "example.com. A", checks[0].String())
+	assert.Equal(t, "alias answers depend on the target", checks[0].skip)
+	assert.Equal(t, "old.example.com. TXT", checks[1].String())
+	assert.Empty(t, checks[1].skip)
+	assert.Empty(t, checks[1].expected)
+	assert.Equal(t, "w.example.com. A", checks[2].String())
+	assert.Equal(t, "routed answers depend on the client", checks[2].skip)
+	assert.Equal(t, "www.example.com. A", checks[3].String())
+	assert.Equal(t, []string{"www.example.com. 3600 IN A 192.0.2.1", "www.example.com. 3600 IN A 192.0.2.2"}, recordStrings(checks[3].expected))
+}
+
+func TestSameAnswer(t *testing.T) {
+	a := testRR(t, "www.example.com. 300 IN A 192.0.2.1")
+	b := testRR(t, "www.example.com. 300 IN A 192.0.2.2")
+	assert.True(t, sameAnswer(nil, nil))
+	assert.True(t, sameAnswer([]dns.RR{a, b}, []dns.RR{b, testRR(t, "WWW.example.com. 60 IN A 192.0.2.1")}))
+	assert.False(t, sameAnswer([]dns.RR{a, b}, []dns.RR{a}))
+	assert.False(t, sameAnswer([]dns.RR{a, a}, []dns.RR{a, b}))
+	assert.Equal(t, "192.0.2.1, 192.0.2.2", answerString([]dns.RR{b, a}))
+	assert.Equal(t, "no records", answerString(nil))
+}
+
+func TestPollVerify(t *testing.T) {
+	defer func(interval time.Duration) { verifyInterval = interval }(verifyInterval)
+	verifyInterval = 10 * time.Millisecond
+
+	expected := testRR(t, "www.example.com. 3600 IN A 192.0.2.1")
+	checks := []*verifyCheck{
+		{name: "www.example.com.", rrtype: dns.TypeA, expected: []dns.RR{expected}},
+		{name: "old.example.com.", rrtype: dns.TypeTXT},
+		{name: "w.example.com.", rrtype: dns.TypeA, skip: "routed answers depend on the client"},
+	}
+	var mu sync.Mutex
+	queries := map[string]int{}
+	query := func(ctx context.Context, server, name string, rrtype uint16) ([]dns.RR, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		queries[server]++
+		if name == "old.example.com." {
+			return nil, nil
+		}
+		switch {
+		case server == "ns1" || server == "ns2" && queries[server] > 2:
+			return []dns.RR{expected}, nil
+		case server == "ns3":
+			return []dns.RR{testRR(t, "www.example.com. 3600 IN A 192.0.2.9")}, nil
+		}
+		return nil, nil
+	}
+
+	w := &bytes.Buffer{}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.True(t, pollVerify(ctx, []string{"ns1", "ns2", "ns1"}, checks, query, w))
+	out := w.String()
+	assert.Contains(t, out, "Not verifying w.example.com. A: routed answers depend on the client\n")
+	assert.Contains(t, out, "Verifying 2 record sets on 2 name servers\n")
+	assert.Contains(t, out, "ns1: all 2 verified\n")
+	assert.Contains(t, out, "ns2: 1/2 verified\n")
+	assert.Contains(t, out, "ns2: all 2 verified\n")
+	assert.Contains(t, out, "Verified\n")
+
+	w.Reset()
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.False(t, pollVerify(ctx, []string{"ns1", "ns3"}, checks, query, w))
+	out = w.String()
+	assert.Contains(t, out, "ns3: 1/2 verified, gave up: context deadline exceeded\n")
+	assert.Contains(t, out, "Mismatch on ns3: www.example.com. A: expected 192.0.2.1, got 192.0.2.9\n")
+	assert.NotContains(t, out, "Verified\n")
+}
+
+func TestQueryNameServer(t *testing.T) {
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		m := &dns.Msg{}
+		m.SetReply(req)
+		m.Authoritative = true
+		switch req.Question[0].Name {
+		case "www.example.com.":
+			m.Answer = []dns.RR{
+				testRR(t, "www.example.com. 300 IN CNAME a.example.com."),
+				testRR(t, "a.example.com. 300 IN A 192.0.2.1"),
+			}
+		case "a.example.com.":
+			m.Answer = []dns.RR{testRR(t, "a.example.com. 300 IN A 192.0.2.1")}
+		case "nope.example.com.":
+			m.Rcode = dns.RcodeNameError
+		default:
+			m.Rcode = dns.RcodeRefused
+		}
+		w.WriteMsg(m)
+	})
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := &dns.Server{PacketConn: pc, Handler: handler}
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+	addr := pc.LocalAddr().String()
+	ctx := context.Background()
+
+	records, err := queryNameServer(ctx, addr, "a.example.com.", dns.TypeA)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a.example.com. 300 IN A 192.0.2.1"}, recordStrings(records))
+
+	records, err = queryNameServer(ctx, addr, "www.example.com.", dns.TypeA)
+	require.NoError(t, err)
+	assert.Empty(t, records)
+
+	records, err = queryNameServer(ctx, addr, "nope.example.com.", dns.TypeA)
+	require.NoError(t, err)
+	assert.Empty(t, records)
+
+	_, err = queryNameServer(ctx, addr, "example.org.", dns.TypeA)
+	assert.EqualError(t, err, "REFUSED")
+}
@@ -0,0 +1,126 @@
+package cli53
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	route53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+// Polling interval when waiting for changes, doubling up to the maximum.
+var (
+	waitInitialInterval = 1 * time.Second
+	waitMaxInterval     = 30 * time.Second
+)
+
+type changeStatusFunc func(ctx context.Context, id string) (route53types.ChangeStatus, error)
+
+func getChangeStatus(ctx context.Context, id string) (route53types.ChangeStatus, error) {
+	resp, err := r53.GetChange(ctx, &route53.GetChangeInput{Id: &id})
+	if err != nil {
+		return "", err
+	}
+	return resp.ChangeInfo.Status, nil
+}
+
+type changeResult struct {
+	id     string
+	status route53types.ChangeStatus
+	err    error
+}
+
+// pollChange polls a change with exponential backoff until it is no longer
+// pending, or the context is done.
+func pollChange(ctx context.Context, id string, status changeStatusFunc, progress chan<- struct{}) changeResult {
+	interval := waitInitialInterval
+	for {
+		s, err := status(ctx, id)
+		if err != nil {
+			return changeResult{id, "", err}
+		}
+		if s != route53types.ChangeStatusPending {
+			return changeResult{id, s, nil}
+		}
+		progress <- struct{}{}
+		select {
+		case <-ctx.Done():
+			return changeResult{id, s, ctx.Err()}
+		case <-time.After(interval):
+		}
+		interval *= 2
+		if interval > waitMaxInterval {
+			interval = waitMaxInterval
+		}
+	}
+}
+
+// pollChanges waits for all the changes concurrently, writing progress and
+// a summary to w. It returns false if any change failed to sync, along with
+// the first error polling them, if any.
+func pollChanges(ctx context.Context, changes []*route53types.ChangeInfo, status changeStatusFunc, w io.Writer) (bool, error) {
+	if len(changes) == 0 {
+		return true, nil
+	}
+	fmt.Fprintf(w, "Waiting for sync")
+	progress := make(chan struct{})
+	results := make(chan changeResult)
+	for _, change := range changes {
+		go func(id string) {
+			results <- pollChange(ctx, id, status, progress)
+		}(*change.Id)
+	}
+
+	byId := map[string]changeResult{}
+	for len(byId) < len(changes) {
+		select {
+		case <-progress:
+			fmt.Fprintf(w, ".")
+		case result := <-results:
+			byId[result.id] = result
+		}
+	}
+	fmt.Fprintln(w)
+
+	ok := true
+	var err error
+	for _, change := range changes {
+		result := byId[*change.Id]
+		if result.err != nil || result.status != route53types.ChangeStatusInsync {
+			ok = false
+		}
+		if err == nil {
+			err = result.err
+		}
+		if len(changes) > 1 {
+			switch {
+			case result.err != nil:
+				fmt.Fprintf(w, "%s: %s\n", result.id, result.err)
+			default:
+				fmt.Fprintf(w, "%s: %s\n", result.id, result.status)
+			}
+		}
+	}
+	if ok {
+		fmt.Fprintln(w, "Completed")
+	} else if len(changes) == 1 {
+		result := byId[*changes[0].Id]
+		if result.err != nil {
+			fmt.Fprintf(w, "Failed: %s\n", result.err)
+		} else {
+			fmt.Fprintf(w, "Failed: %s\n", result.status)
+		}
+	}
+	return ok, err
+}
+
+// waitForChanges waits for all the changes to become live, polling them
+// concurrently and honouring any --timeout. A change that fails to sync is
+// reported, but only an error polling it is fatal.
+func waitForChanges(ctx context.Context, changes []*route53types.ChangeInfo) {
+	_, err := pollChanges(ctx, changes, getChangeStatus, os.Stdout)
+	fatalIfErr(err)
+}
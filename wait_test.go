@@ -0,0 +1,95 @@
+package cli53
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	route53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func fastPolling(t *testing.T) {
+	initial, max := waitInitialInterval, waitMaxInterval
+	waitInitialInterval, waitMaxInterval = time.Millisecond, 4*time.Millisecond
+	t.Cleanup(func() {
+		waitInitialInterval, waitMaxInterval = initial, max
+	})
+}
+
+// fakeStatus reports changes as pending for a number of polls, then in sync.
+func fakeStatus(pending map[string]int) changeStatusFunc {
+	var mu sync.Mutex
+	return func(ctx context.Context, id string) (route53types.ChangeStatus, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if n, ok := pending[id]; !ok {
+			return "", errors.New("no such change")
+		} else if n > 0 {
+			pending[id] = n - 1
+			return route53types.ChangeStatusPending, nil
+		}
+		return route53types.ChangeStatusInsync, nil
+	}
+}
+
+func changeInfos(ids ...string) []*route53types.ChangeInfo {
+	infos := []*route53types.ChangeInfo{}
+	for _, id := range ids {
+		infos = append(infos, &route53types.ChangeInfo{Id: aws.String(id)})
+	}
+	return infos
+}
+
+func TestPollChangesSingle(t *testing.T) {
+	fastPolling(t)
+	w := &bytes.Buffer{}
+	ok, _ := pollChanges(context.Background(), changeInfos("/change/1"), fakeStatus(map[string]int{"/change/1": 2}), w)
+	assert.True(t, ok)
+	assert.Equal(t, "Waiting for sync..\nCompleted\n", w.String())
+}
+
+func TestPollChangesMultiple(t *testing.T) {
+	fastPolling(t)
+	w := &bytes.Buffer{}
+	status := fakeStatus(map[string]int{"/change/1": 1, "/change/2": 3})
+	ok, _ := pollChanges(context.Background(), changeInfos("/change/1", "/change/2"), status, w)
+	assert.True(t, ok)
+	assert.Equal(t, "Waiting for sync....\n/change/1: INSYNC\n/change/2: INSYNC\nCompleted\n", w.String())
+}
+
+func TestPollChangesError(t *testing.T) {
+	fastPolling(t)
+	w := &bytes.Buffer{}
+	status := fakeStatus(map[string]int{"/change/1": 0})
+	ok, err := pollChanges(context.Background(), changeInfos("/change/1", "/change/2"), status, w)
+	assert.False(t, ok)
+	assert.EqualError(t, err, "no such change")
+	assert.Equal(t, "Waiting for sync\n/change/1: INSYNC\n/change/2: no such change\n", w.String())
+}
+
+func TestPollChangesFailedStatus(t *testing.T) {
+	fastPolling(t)
+	w := &bytes.Buffer{}
+	status := func(ctx context.Context, id string) (route53types.ChangeStatus, error) {
+		return "FAILED", nil
+	}
+	ok, err := pollChanges(context.Background(), changeInfos("/change/1"), status, w)
+	assert.False(t, ok)
+	assert.NoError(t, err)
+	assert.Equal(t, "Waiting for sync\nFailed: FAILED\n", w.String())
+}
+
+func TestPollChangesTimeout(t *testing.T) {
+	fastPolling(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	w := &bytes.Buffer{}
+	ok, _ := pollChanges(ctx, changeInfos("/change/1"), fakeStatus(map[string]int{"/change/1": 1000}), w)
+	assert.False(t, ok)
+	assert.Contains(t, w.String(), "Failed: context deadline exceeded\n")
+}